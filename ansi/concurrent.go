@@ -0,0 +1,40 @@
+package ansi
+
+import (
+	"io"
+	"sync"
+)
+
+// A ConcurrentDecoder is a Reader whose Next method may be called from
+// multiple goroutines.  Each sequence is returned to exactly one caller.
+type ConcurrentDecoder struct {
+	mu sync.Mutex
+	r  *Reader
+}
+
+// NewConcurrent returns a new ConcurrentDecoder that reads from r with a
+// default read buffer size.
+func NewConcurrent(r io.Reader) *ConcurrentDecoder {
+	return &ConcurrentDecoder{r: NewReader(r)}
+}
+
+// Next returns either the next sequence in c or an error.
+func (c *ConcurrentDecoder) Next() (S, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.r.Next()
+}
+
+// Send calls Next on c and sends the results to ch until Next returns an
+// error.  ch is closed when Send returns.  Any error other than io.EOF is
+// returned by subsequent calls to Next.
+func (c *ConcurrentDecoder) Send(ch chan<- S) {
+	defer close(ch)
+	for {
+		s, err := c.Next()
+		if err != nil {
+			return
+		}
+		ch <- s
+	}
+}
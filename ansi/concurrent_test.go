@@ -0,0 +1,70 @@
+package ansi
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentDecoder(t *testing.T) {
+	const n = 1000
+	var in strings.Builder
+	for i := 0; i < n; i++ {
+		in.WriteString("\033[1mtext\033[0m")
+	}
+	c := NewConcurrent(strings.NewReader(in.String()))
+
+	var mu sync.Mutex
+	var codes []string
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				s, err := c.Next()
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				codes = append(codes, string(s.Code)+s.Text)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(codes) != 3*n {
+		t.Fatalf("got %d sequences, want %d", len(codes), 3*n)
+	}
+	count := map[string]int{}
+	for _, c := range codes {
+		count[c]++
+	}
+	var got []string
+	for c, cnt := range count {
+		if cnt != n {
+			t.Errorf("%q seen %d times, want %d", c, cnt, n)
+		}
+		got = append(got, c)
+	}
+	sort.Strings(got)
+	if len(got) != 3 {
+		t.Errorf("got sequences %q, want 3 distinct sequences", got)
+	}
+}
+
+func TestConcurrentDecoderSend(t *testing.T) {
+	const in = "\033[1mtext\033[0m"
+	c := NewConcurrent(strings.NewReader(in))
+	ch := make(chan S)
+	go c.Send(ch)
+	var got []string
+	for s := range ch {
+		got = append(got, s.Text)
+	}
+	if out := strings.Join(got, ""); out != in {
+		t.Errorf("got %q, want %q", out, in)
+	}
+}
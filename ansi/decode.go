@@ -90,7 +90,12 @@ func isValidFinalByte(b byte) bool { return b >= 0x40 && b <= 0x7e }
 func isOneByteEscape(b byte) bool  { return b >= 0x80 && b <= 0x9f }
 
 func isescape1(b byte) bool { return b == escape }
-func isescape2(b byte) bool { return b == escape || isOneByteEscape(b) }
+
+// isescape2 reports if b starts an escape sequence when single byte C1
+// codes are allowed.  C1 codes not found in Table are treated as text.
+func isescape2(b byte) bool {
+	return b == escape || (isOneByteEscape(b) && Table[Name([]byte{b})] != nil)
+}
 
 // bufferSize is the size of the default buffer.
 const bufferSize = 32768
@@ -113,6 +118,13 @@ func NewReader(r io.Reader) *Reader {
 	return NewWithBuffer(r, make([]byte, bufferSize))
 }
 
+// NewReaderSize returns a new escape decoder that reads from r with a read
+// buffer of size bytes.  A larger buffer reduces the number of calls to the
+// Read method of r.  The buffer must be larger than the longest sequence.
+func NewReaderSize(r io.Reader, size int) *Reader {
+	return NewWithBuffer(r, make([]byte, size))
+}
+
 // NewWithBuffer returns a new escape decoder that reads from r with the
 // provided buffer.
 func NewWithBuffer(r io.Reader, buf []byte) *Reader {
@@ -147,26 +159,53 @@ func (bp *Reader) Read(buf []byte) (int, error) {
 	}
 }
 
-// Send calls Next on bp and sends the results to ch.
+// sendBatch is the number of sequences Send decodes at a time.
+const sendBatch = 128
+
+// Send calls NextN on bp and sends the results to ch.
 func (bp *Reader) Send(ch chan S) error {
 	for {
-		s, err := bp.Next()
+		ss, err := bp.NextN(sendBatch)
+		for _, s := range ss {
+			ch <- s
+		}
 		if err != nil {
 			if err == io.EOF {
 				return nil
 			}
 			return err
 		}
-		ch <- s
 	}
 }
 
 // AllowOneByteSequences turns on processing of single byte escape
-// sequences (not UNICODE safe).
+// sequences (not UNICODE safe).  A byte in the range 0x80 - 0x9f that is
+// found in Table is decoded the same as the equivalent two byte sequence,
+// e.g., 0x9b is decoded as ESC [.
 func (bp *Reader) AllowOneByteSequences() {
 	bp.isescape = isescape2
 }
 
+// Tokenize splits data into its escape sequences and plain text, in order.
+// Plain text is returned as an S with an empty Code.  Single byte C1 codes
+// found in Table are decoded as by AllowOneByteSequences.  Tokenize works
+// directly on data, without an io.Reader or a read buffer, so it is faster
+// than a Reader for data that is already in memory.  A sequence truncated by
+// the end of data has an Error of io.EOF.
+func Tokenize(data []byte) []S {
+	bp := &Reader{
+		buf:      data,
+		t:        len(data),
+		e:        len(data),
+		isescape: isescape2,
+	}
+	var ss []S
+	for bp.h < bp.t {
+		ss = append(ss, bp.next())
+	}
+	return ss
+}
+
 // trailingByte maps a character to true if it needs one more byte
 // following the code byte.
 var trailingByte = [256]bool{
@@ -198,6 +237,25 @@ func (bp *Reader) Next() (S, error) {
 	return bp.next(), nil
 }
 
+// NextN returns up to n sequences from bp.  Once at least one sequence has
+// been decoded NextN does not read more input, it returns the sequences
+// already decoded when the buffered input is used up.  An error is only
+// returned if no sequences were decoded.
+func (bp *Reader) NextN(n int) ([]S, error) {
+	var ss []S
+	for len(ss) < n {
+		if len(ss) > 0 && (bp.err != nil || bp.h == bp.t) {
+			break
+		}
+		s, err := bp.Next()
+		if err != nil {
+			return ss, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
 func (bp *Reader) next() S {
 	bp.b = bp.h
 
@@ -290,33 +348,36 @@ func (bp *Reader) processCSI() S {
 
 	s := S{Type: "CSI", Code: CSI}
 
+	// Filling the buffer may move the sequence to the start of the
+	// buffer so p0 and p1 are relative to the start of the sequence.
+
 	// (0x30 - 0x3f) "0123456789:;<=>?"
-	p0 := bp.h
+	p0 := bp.h - bp.b
 	if err := bp.run(0x30, 0x3f); err != nil {
 		s.Text = bp.text(bp.t)
 		s.Error = err
 		return s
 	}
-	if bp.h > p0 {
+	if bp.h > bp.b+p0 {
 		// By the standard we should only split on ; if the
 		// all the bytes are no greater than 0x3b (;).
 		// Parameters that start with one of <, =, >, or ?
 		// are experimental.  We will split them anyhow
 		// as the caller can put them back together in the
 		// off chance they didn't want them split.
-		s.Params = strings.Split(string(bp.buf[p0:bp.h]), ";")
+		s.Params = strings.Split(string(bp.buf[bp.b+p0:bp.h]), ";")
 	}
 
 	// (0x20 - 0x2f) " !"#$%&'()*+,-./"
-	p1 := bp.h
+	p1 := bp.h - bp.b
 	if err := bp.run(0x20, 0x2f); err != nil {
 		s.Text = bp.text(bp.t)
 		s.Error = err
 		return s
 	}
-	if bp.h > p1 {
+	if bp.h > bp.b+p1 {
 		// Add the intermediate byte(s) to the Code
-		s.Code += Name(bp.buf[p1:bp.h])
+		s.Code += Name(bp.buf[bp.b+p1 : bp.h])
 	}
 	if err := bp.fill(1); err != nil {
 		s.Text = bp.text(bp.t)
@@ -353,6 +414,10 @@ func (bp *Reader) processCSI() S {
 // Fill0 extends buf by one read from r.  It returns an error if there is an
 // input error (such as EOF).
 func (bp *Reader) fill0() error {
+	if bp.r == nil {
+		// All the input is already in buf (see Tokenize).
+		return io.EOF
+	}
 	if bp.t == bp.e {
 		if bp.b == 0 {
 			return BufferFull
@@ -422,17 +487,19 @@ func (bp *Reader) code() Name {
 }
 
 func (bp *Reader) findST(code Name) S {
+	// n is the length of the introducer, 2 for ESC ] and 1 for 0x9d.
+	n := bp.h - bp.b
 	for {
 		// It seems xterm allows terminating with a BEL
 		if err := bp.fill(1); err != nil {
 			txt := bp.text(bp.t)
-			return S{Text: txt, Code: code, Params: []string{txt[2:]}, Type: "CS", Error: NoST}
+			return S{Text: txt, Code: code, Params: []string{txt[n:]}, Type: "CS", Error: NoST}
 		}
 		switch bp.buf[bp.h] {
 		case escape:
 		case bell, st1:
 			txt := bp.text(bp.h + 1)
-			return S{Text: txt, Code: code, Params: []string{txt[2:]}, Type: "CS"}
+			return S{Text: txt, Code: code, Params: []string{txt[n:]}, Type: "CS"}
 		default:
 			bp.h++
 			continue
@@ -441,15 +508,15 @@ func (bp *Reader) findST(code Name) S {
 		// We have seen an escape. We need another byte.
 		if err := bp.fill(2); err != nil {
 			txt := bp.text(bp.t)
-			return S{Text: txt, Code: code, Params: []string{txt[2:]}, Type: "CS", Error: NoST}
+			return S{Text: txt, Code: code, Params: []string{txt[n:]}, Type: "CS", Error: NoST}
 		}
 		switch bp.buf[bp.h+1] {
 		case 'X': // SOS
 			txt := bp.text(bp.h)
-			return S{Text: txt, Code: code, Params: []string{txt[2:]}, Type: "CS", Error: FoundSOS}
+			return S{Text: txt, Code: code, Params: []string{txt[n:]}, Type: "CS", Error: FoundSOS}
 		case '\\': // ST
 			txt := bp.text(bp.h + 2)
-			return S{Text: txt, Code: code, Params: []string{txt[2:]}, Type: "CS"}
+			return S{Text: txt, Code: code, Params: []string{txt[n:]}, Type: "CS"}
 		default:
 			bp.h++
 		}
@@ -0,0 +1,7 @@
+package ansi
+
+// Exported for the tests in package ansi_test.
+var (
+	Input  = input
+	Input2 = input2
+)
@@ -0,0 +1,4 @@
+package ansi
+
+//go:generate sh -c "go run util/mkansi.go -bench | gofmt > ansi_bench_test.go"
+//go:generate sh -c "go run util/mkansi.go -descriptions | gofmt > ansi_descriptions.go"
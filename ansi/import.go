@@ -1,7 +1,8 @@
 package ansi
 
-// Import adds the provided table to the list of known sequences.
-// Duplicated entries are ignored and returned as the list of Names.
+// Import adds the provided table to the list of known sequences, both Table
+// and DefaultTrie.  Duplicated entries are ignored and returned as the list of
+// Names.
 func Import(table map[Name]*Sequence) []Name {
 	var dups []Name
 	for name, seq := range table {
@@ -10,6 +11,7 @@ func Import(table map[Name]*Sequence) []Name {
 			continue
 		}
 		Table[name] = seq
+		DefaultTrie.Insert(string(name), seq)
 	}
 	return dups
 }
@@ -0,0 +1,173 @@
+// Package kitty provides the escape sequences of the kitty keyboard protocol
+// that are not included in ansi.Table or xterm.Table.  Normally the only direct
+// reference to the kitty package is:
+//
+//	if err := kitty.Import(); err != nil {
+//		// This should not happen.
+//		// err contains the list of duplicated entries
+//	}
+//
+// The kitty keyboard protocol reports keys as CSI sequences with a final byte
+// of u.  Since the xterm SCORC sequence also uses the final byte u, the names
+// in this table include their distinguishing parameter bytes.
+//
+// See https://sw.kovidgoyal.net/kitty/keyboard-protocol/.
+package kitty
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pborman/pty/ansi"
+)
+
+const ESC = 033
+
+// Import imports the kitty code tables into the ansi table.
+func Import() error {
+	dups := ansi.Import(Table)
+	if len(dups) == 0 {
+		return nil
+	}
+	return fmt.Errorf("duplicated codes: %q", dups)
+}
+
+// A Modifier is a bit in the modifier parameter of a key event.  The encoded
+// parameter is 1 plus the bitwise OR of the modifiers.
+type Modifier int
+
+const (
+	Shift    = Modifier(1 << iota) // Shift key
+	Alt                            // Alt/Option key
+	Ctrl                           // Control key
+	Super                          // Windows/Linux key or Command key
+	Hyper                          // Hyper key
+	Meta                           // Meta key
+	CapsLock                       // Caps Lock is on
+	NumLock                        // Num Lock is on
+)
+
+// A Flag is a bit in the progressive enhancement flags.
+type Flag int
+
+const (
+	Disambiguate     = Flag(1 << iota) // Disambiguate escape codes
+	ReportEvents                       // Report press, repeat and release events
+	ReportAlternates                   // Report alternate keys
+	ReportAll                          // Report all keys as escape codes
+	ReportText                         // Report associated text
+)
+
+// Key returns the escape sequence reporting the key with the unicode code
+// point code pressed with the modifiers mods, e.g., Key('a', Ctrl) returns
+// "\033[97;5u".
+func Key(code rune, mods Modifier) []byte {
+	buf := []byte{ESC, '['}
+	buf = strconv.AppendInt(buf, int64(code), 10)
+	if mods != 0 {
+		buf = append(buf, ';')
+		buf = strconv.AppendInt(buf, int64(mods)+1, 10)
+	}
+	return append(buf, 'u')
+}
+
+// Mode "Progressive enhancement" Functions using CSI
+
+var KITTY_PUSH_ = ansi.Sequence{
+	Name:     "KITTY_PUSH",
+	Desc:     "Push Keyboard Enhancement Flags",
+	Notation: "Pn",
+	Type:     ansi.CSI,
+	NParam:   1,
+	Defaults: []string{"0"},
+	Code:     []byte{ESC, '[', '>', 'u'},
+}
+
+var KITTY_POP_ = ansi.Sequence{
+	Name:     "KITTY_POP",
+	Desc:     "Pop Keyboard Enhancement Flags",
+	Notation: "Pn",
+	Type:     ansi.CSI,
+	NParam:   1,
+	Defaults: []string{"1"},
+	Code:     []byte{ESC, '[', '<', 'u'},
+}
+
+var KITTY_QUERY_ = ansi.Sequence{
+	Name: "KITTY_QUERY",
+	Desc: "Query Keyboard Enhancement Flags",
+	Type: ansi.CSI,
+	Code: []byte{ESC, '[', '?', 'u'},
+}
+
+var KITTY_SET_ = ansi.Sequence{
+	Name:     "KITTY_SET",
+	Desc:     "Set Keyboard Enhancement Flags",
+	Notation: "Pn1;Pn2",
+	Type:     ansi.CSI,
+	NParam:   2,
+	MinParam: 1,
+	Defaults: []string{"0", "1"},
+	Code:     []byte{ESC, '[', '=', 'u'},
+}
+
+// Mode "Key events" Functions using CSI
+
+var KITTY_TAB_ = ansi.Sequence{
+	Name: "KITTY_TAB",
+	Desc: "Tab Key",
+	Type: ansi.CSI,
+	Code: []byte{ESC, '[', '9', 'u'},
+}
+
+var KITTY_ENTER_ = ansi.Sequence{
+	Name: "KITTY_ENTER",
+	Desc: "Enter Key",
+	Type: ansi.CSI,
+	Code: []byte{ESC, '[', '1', '3', 'u'},
+}
+
+var KITTY_ESCAPE_ = ansi.Sequence{
+	Name: "KITTY_ESCAPE",
+	Desc: "Escape Key",
+	Type: ansi.CSI,
+	Code: []byte{ESC, '[', '2', '7', 'u'},
+}
+
+var KITTY_BACKSPACE_ = ansi.Sequence{
+	Name: "KITTY_BACKSPACE",
+	Desc: "Backspace Key",
+	Type: ansi.CSI,
+	Code: []byte{ESC, '[', '1', '2', '7', 'u'},
+}
+
+var KITTY_KP_ENTER_ = ansi.Sequence{
+	Name: "KITTY_KP_ENTER",
+	Desc: "Keypad Enter Key",
+	Type: ansi.CSI,
+	Code: []byte{ESC, '[', '5', '7', '4', '1', '4', 'u'},
+}
+
+const (
+	KITTY_PUSH      = ansi.Name("\033[>u")
+	KITTY_POP       = ansi.Name("\033[<u")
+	KITTY_QUERY     = ansi.Name("\033[?u")
+	KITTY_SET       = ansi.Name("\033[=u")
+	KITTY_TAB       = ansi.Name("\033[9u")
+	KITTY_ENTER     = ansi.Name("\033[13u")
+	KITTY_ESCAPE    = ansi.Name("\033[27u")
+	KITTY_BACKSPACE = ansi.Name("\033[127u")
+	KITTY_KP_ENTER  = ansi.Name("\033[57414u")
+)
+
+var Table = map[ansi.Name]*ansi.Sequence{
+	KITTY_PUSH:      &KITTY_PUSH_,
+	KITTY_POP:       &KITTY_POP_,
+	KITTY_QUERY:     &KITTY_QUERY_,
+	KITTY_SET:       &KITTY_SET_,
+	KITTY_TAB:       &KITTY_TAB_,
+	KITTY_ENTER:     &KITTY_ENTER_,
+	KITTY_ESCAPE:    &KITTY_ESCAPE_,
+	KITTY_BACKSPACE: &KITTY_BACKSPACE_,
+	KITTY_KP_ENTER:  &KITTY_KP_ENTER_,
+}
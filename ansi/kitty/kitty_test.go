@@ -0,0 +1,40 @@
+package kitty
+
+import (
+	"testing"
+
+	"github.com/pborman/pty/ansi"
+	"github.com/pborman/pty/ansi/xterm"
+)
+
+func TestCollisions(t *testing.T) {
+	for name, seq := range Table {
+		if ansi.Table[name] != nil {
+			t.Errorf("%s collides with ansi.Table", seq.Name)
+		}
+		if xterm.Table[name] != nil {
+			t.Errorf("%s collides with xterm.Table", seq.Name)
+		}
+		if string(name) != string(seq.Code) {
+			t.Errorf("%s: name %q does not match code %q", seq.Name, name, seq.Code)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	for _, tt := range []struct {
+		code rune
+		mods Modifier
+		want string
+	}{
+		{'a', 0, "\033[97u"},
+		{'A', Ctrl, "\033[65;5u"},
+		{'a', Ctrl | Shift, "\033[97;6u"},
+		{13, 0, string(KITTY_ENTER)},
+		{57414, 0, string(KITTY_KP_ENTER)},
+	} {
+		if got := string(Key(tt.code, tt.mods)); got != tt.want {
+			t.Errorf("Key(%d, %d) got %q, want %q", tt.code, tt.mods, got, tt.want)
+		}
+	}
+}
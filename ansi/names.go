@@ -0,0 +1,65 @@
+package ansi
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	byNameOnce sync.Once
+	byName     map[string]*Sequence
+	byNameKey  map[string]Name // the key of byName[name] in Table
+)
+
+// ByName returns the sequence in Table whose Name field is name, such as
+// "CUP", or nil if there is none.  If several sequences share a name the one
+// with the lowest key in Table is returned.  The lookup table is built on the
+// first call so sequences imported after that are not found.
+func ByName(name string) *Sequence {
+	byNameOnce.Do(buildByName)
+	return byName[name]
+}
+
+// Names returns the sorted names of all sequences in Table.  Each name is
+// only returned once.
+func Names() []string {
+	byNameOnce.Do(buildByName)
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the description of the sequence name from Descriptions, or
+// "" if there is none.  name may be either the sequence itself, such as CUP,
+// or its name, such as "CUP".
+func Describe(name Name) string {
+	if desc, ok := Descriptions[name]; ok {
+		return desc
+	}
+	byNameOnce.Do(buildByName)
+	if key, ok := byNameKey[string(name)]; ok {
+		return Descriptions[key]
+	}
+	return ""
+}
+
+// buildByName builds byName and byNameKey from Table.
+func buildByName() {
+	keys := make([]string, 0, len(Table))
+	for key := range Table {
+		keys = append(keys, string(key))
+	}
+	sort.Strings(keys)
+	byName = make(map[string]*Sequence, len(Table))
+	byNameKey = make(map[string]Name, len(Table))
+	for _, key := range keys {
+		seq := Table[Name(key)]
+		if seq != nil && byName[seq.Name] == nil {
+			byName[seq.Name] = seq
+			byNameKey[seq.Name] = Name(key)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package ansi
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestByName(t *testing.T) {
+	seq := ByName("CUP")
+	if seq == nil {
+		t.Fatal("CUP not found")
+	}
+	if string(seq.Code) != "H" {
+		t.Errorf("CUP has code %q, want \"H\"", seq.Code)
+	}
+	if seq := ByName("NONEXISTENT"); seq != nil {
+		t.Errorf("NONEXISTENT returned %s", seq.Name)
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("names are not sorted")
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			t.Errorf("%s returned twice", name)
+		}
+		seen[name] = true
+		if ByName(name) == nil {
+			t.Errorf("ByName(%q) returned nil", name)
+		}
+	}
+	if !seen["CUP"] {
+		t.Errorf("CUP is missing from names")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	desc := strings.ToLower(Describe("CUP"))
+	for _, want := range []string{"cursor", "position"} {
+		if !strings.Contains(desc, want) {
+			t.Errorf("CUP description %q does not contain %q", desc, want)
+		}
+	}
+	if got := Describe(CUP); got != Describe("CUP") {
+		t.Errorf("Describe(CUP) = %q, want %q", got, Describe("CUP"))
+	}
+	if got := Describe("NONEXISTENT"); got != "" {
+		t.Errorf("Describe(NONEXISTENT) = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,254 @@
+package ansi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A ColorKind is the kind of a Color.
+type ColorKind int
+
+const (
+	DefaultColor ColorKind = iota // the terminal's default color
+	IndexedColor                  // one of the 256 xterm colors
+	RGBColor                      // a 24-bit color
+)
+
+// A Color is a foreground or background color set by SGR.  R, G, and B are
+// set for both indexed and 24-bit colors; indexed colors use the xterm
+// palette.
+type Color struct {
+	Kind    ColorKind
+	Index   int // the color index for an IndexedColor
+	R, G, B uint8
+}
+
+// indexedColor returns the Color for xterm color index n.
+func indexedColor(n int) Color {
+	c := Color{Kind: IndexedColor, Index: n}
+	switch {
+	case n < 16:
+		rgb := xtermColors[n]
+		c.R, c.G, c.B = rgb[0], rgb[1], rgb[2]
+	case n < 232:
+		n -= 16
+		c.R, c.G, c.B = cubeLevels[n/36], cubeLevels[n/6%6], cubeLevels[n%6]
+	default:
+		v := uint8(8 + 10*(n-232))
+		c.R, c.G, c.B = v, v, v
+	}
+	return c
+}
+
+// xtermColors are the first 16 colors of the xterm palette.
+var xtermColors = [16][3]uint8{
+	{0, 0, 0},
+	{205, 0, 0},
+	{0, 205, 0},
+	{205, 205, 0},
+	{0, 0, 238},
+	{205, 0, 205},
+	{0, 205, 205},
+	{229, 229, 229},
+	{127, 127, 127},
+	{255, 0, 0},
+	{0, 255, 0},
+	{255, 255, 0},
+	{92, 92, 255},
+	{255, 0, 255},
+	{0, 255, 255},
+	{255, 255, 255},
+}
+
+// cubeLevels are the intensities of the 6x6x6 color cube in colors 16-231.
+var cubeLevels = [6]uint8{0, 95, 135, 175, 215, 255}
+
+// css returns c as a CSS color, or def if c is the default color.
+func (c Color) css(def string) string {
+	if c.Kind == DefaultColor {
+		return def
+	}
+	return fmt.Sprintf("rgb(%d,%d,%d)", c.R, c.G, c.B)
+}
+
+// SGRAttrs are the graphic rendition attributes set by SGR sequences.  The
+// zero value is normal text in the default colors.
+type SGRAttrs struct {
+	Bold            bool
+	Faint           bool
+	Italic          bool
+	Underline       bool
+	DoubleUnderline bool
+	Blink           bool
+	Inverse         bool
+	Hidden          bool
+	Strikeout       bool
+	Overlined       bool
+	FGColor         Color
+	BGColor         Color
+}
+
+// An SGRState accumulates the attributes of successive SGR sequences, as a
+// terminal does.  The zero value is ready to use.
+type SGRState struct {
+	Attrs SGRAttrs
+}
+
+// Apply applies the parameters of a single SGR sequence to s.  Each
+// parameter only changes the attributes it names, so Bold followed by Italics
+// leaves both set.  No parameters is the same as Normal.  Unknown parameters
+// are ignored, as are malformed extended colors along with the rest of
+// params.
+func (s *SGRState) Apply(params []int) {
+	if len(params) == 0 {
+		s.Attrs = SGRAttrs{}
+		return
+	}
+	a := &s.Attrs
+	for i := 0; i < len(params); i++ {
+		p := params[i]
+		switch {
+		case p == Normal:
+			*a = SGRAttrs{}
+		case p == Bold:
+			a.Bold = true
+		case p == Faint:
+			a.Faint = true
+		case p == Italics:
+			a.Italic = true
+		case p == Underline:
+			a.Underline = true
+		case p == Blink, p == FastBlink:
+			a.Blink = true
+		case p == Inverse:
+			a.Inverse = true
+		case p == Hidden:
+			a.Hidden = true
+		case p == Strikeout:
+			a.Strikeout = true
+		case p == DoubleUnderline:
+			a.DoubleUnderline = true
+		case p == NormalColor:
+			a.Bold, a.Faint = false, false
+		case p == NotItalics:
+			a.Italic = false
+		case p == NotUnderlined:
+			a.Underline, a.DoubleUnderline = false, false
+		case p == Steady:
+			a.Blink = false
+		case p == NotInverse:
+			a.Inverse = false
+		case p == NotHidden:
+			a.Hidden = false
+		case p == NotStrikeout:
+			a.Strikeout = false
+		case p >= Black && p <= White:
+			a.FGColor = indexedColor(p - Black)
+		case p == Default:
+			a.FGColor = Color{}
+		case p >= BlackBackground && p <= WhiteBackground:
+			a.BGColor = indexedColor(p - BlackBackground)
+		case p == DefaultBackground:
+			a.BGColor = Color{}
+		case p == Overlined:
+			a.Overlined = true
+		case p == NotOverlined:
+			a.Overlined = false
+		case p >= 90 && p <= 97:
+			a.FGColor = indexedColor(p - 90 + 8)
+		case p >= 100 && p <= 107:
+			a.BGColor = indexedColor(p - 100 + 8)
+		case p == Reserved38, p == Reserved48, p == 58:
+			c, n, ok := extendedColor(params[i+1:])
+			if !ok {
+				return
+			}
+			i += n
+			switch p {
+			case Reserved38:
+				a.FGColor = c
+			case Reserved48:
+				a.BGColor = c
+			}
+			// 58 sets the underline color, which is not tracked.
+		}
+	}
+}
+
+// extendedColor decodes the parameters following 38, 48, or 58: either 5 and
+// a color index or 2 and the red, green, and blue values.  It returns the
+// color and the number of parameters used.  ok is false if params is not a
+// valid color.
+func extendedColor(params []int) (c Color, n int, ok bool) {
+	inRange := func(v ...int) bool {
+		for _, n := range v {
+			if n < 0 || n > 255 {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case len(params) >= 2 && params[0] == 5 && inRange(params[1]):
+		return indexedColor(params[1]), 2, true
+	case len(params) >= 4 && params[0] == 2 && inRange(params[1:4]...):
+		return Color{
+			Kind: RGBColor,
+			R:    uint8(params[1]),
+			G:    uint8(params[2]),
+			B:    uint8(params[3]),
+		}, 4, true
+	}
+	return Color{}, 0, false
+}
+
+// ToCSS returns the attributes of s as a CSS style, such as
+// "color: rgb(255,0,0); font-weight: bold".  The empty string is returned for
+// normal text.  When Inverse is set and a color is the default, the CSS system
+// colors Canvas and CanvasText are used in its place.
+func (s *SGRState) ToCSS() string {
+	a := &s.Attrs
+	var styles []string
+	fg, bg := a.FGColor.css(""), a.BGColor.css("")
+	if a.Inverse {
+		fg, bg = a.BGColor.css("Canvas"), a.FGColor.css("CanvasText")
+	}
+	if fg != "" {
+		styles = append(styles, "color: "+fg)
+	}
+	if bg != "" {
+		styles = append(styles, "background-color: "+bg)
+	}
+	switch {
+	case a.Bold:
+		styles = append(styles, "font-weight: bold")
+	case a.Faint:
+		styles = append(styles, "opacity: 0.5")
+	}
+	if a.Italic {
+		styles = append(styles, "font-style: italic")
+	}
+	var lines []string
+	if a.Underline || a.DoubleUnderline {
+		lines = append(lines, "underline")
+	}
+	if a.Overlined {
+		lines = append(lines, "overline")
+	}
+	if a.Strikeout {
+		lines = append(lines, "line-through")
+	}
+	if a.Blink {
+		lines = append(lines, "blink")
+	}
+	if len(lines) > 0 {
+		styles = append(styles, "text-decoration: "+strings.Join(lines, " "))
+	}
+	if a.DoubleUnderline {
+		styles = append(styles, "text-decoration-style: double")
+	}
+	if a.Hidden {
+		styles = append(styles, "visibility: hidden")
+	}
+	return strings.Join(styles, "; ")
+}
@@ -0,0 +1,81 @@
+package ansi
+
+import "testing"
+
+func TestSGRState(t *testing.T) {
+	var s SGRState
+	s.Apply([]int{Bold})
+	s.Apply([]int{Italics})
+	if !s.Attrs.Bold || !s.Attrs.Italic {
+		t.Errorf("after bold and italics got %+v", s.Attrs)
+	}
+	s.Apply([]int{Normal})
+	if s.Attrs != (SGRAttrs{}) {
+		t.Errorf("after reset got %+v", s.Attrs)
+	}
+
+	s.Apply([]int{38, 2, 255, 128, 1})
+	if c := s.Attrs.FGColor; c.Kind != RGBColor || c.R != 255 || c.G != 128 || c.B != 1 {
+		t.Errorf("got foreground %+v, want rgb(255,128,1)", c)
+	}
+	s.Apply(nil)
+	if s.Attrs != (SGRAttrs{}) {
+		t.Errorf("after empty SGR got %+v", s.Attrs)
+	}
+}
+
+func TestSGRStateApply(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		params [][]int
+		want   SGRAttrs
+	}{
+		{"bold and faint off", [][]int{{Bold, Faint, Italics}, {NormalColor}}, SGRAttrs{Italic: true}},
+		{"underlines", [][]int{{Underline, DoubleUnderline}, {NotUnderlined}}, SGRAttrs{}},
+		{"indexed", [][]int{{Red, 48, 5, 196}}, SGRAttrs{
+			FGColor: Color{Kind: IndexedColor, Index: 1, R: 205},
+			BGColor: Color{Kind: IndexedColor, Index: 196, R: 255},
+		}},
+		{"bright", [][]int{{90, 107}}, SGRAttrs{
+			FGColor: Color{Kind: IndexedColor, Index: 8, R: 127, G: 127, B: 127},
+			BGColor: Color{Kind: IndexedColor, Index: 15, R: 255, G: 255, B: 255},
+		}},
+		{"gray", [][]int{{38, 5, 232}}, SGRAttrs{
+			FGColor: Color{Kind: IndexedColor, Index: 232, R: 8, G: 8, B: 8},
+		}},
+		{"default colors", [][]int{{Red, GreenBackground}, {Default, DefaultBackground}}, SGRAttrs{}},
+		{"underline color", [][]int{{58, 2, 1, 2, 3, Bold}}, SGRAttrs{Bold: true}},
+		{"truncated", [][]int{{Bold, 38, 2, 1}}, SGRAttrs{Bold: true}},
+		{"out of range", [][]int{{38, 5, 256, Bold}}, SGRAttrs{}},
+	} {
+		var s SGRState
+		for _, p := range tt.params {
+			s.Apply(p)
+		}
+		if s.Attrs != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, s.Attrs, tt.want)
+		}
+	}
+}
+
+func TestSGRStateToCSS(t *testing.T) {
+	for _, tt := range []struct {
+		params []int
+		want   string
+	}{
+		{nil, ""},
+		{[]int{Red, Bold}, "color: rgb(205,0,0); font-weight: bold"},
+		{[]int{38, 2, 255, 0, 0, 48, 2, 0, 0, 255}, "color: rgb(255,0,0); background-color: rgb(0,0,255)"},
+		{[]int{Italics, Underline, Strikeout}, "font-style: italic; text-decoration: underline line-through"},
+		{[]int{DoubleUnderline}, "text-decoration: underline; text-decoration-style: double"},
+		{[]int{Inverse}, "color: Canvas; background-color: CanvasText"},
+		{[]int{Red, Inverse}, "color: Canvas; background-color: rgb(205,0,0)"},
+		{[]int{Hidden}, "visibility: hidden"},
+	} {
+		var s SGRState
+		s.Apply(tt.params)
+		if got := s.ToCSS(); got != tt.want {
+			t.Errorf("%v: got %q, want %q", tt.params, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ansi
 
 import (
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -48,3 +49,127 @@ MN Linux => vi pty   main.go
 [56;36H.[57d[57;1H[?1049l[?1l>MN Linux => go build
 MN Linux => clear
 [3;J[H[2JMN Linux => exit`
+
+// countingReader counts the calls to Read and returns at most max bytes
+// per call.
+type countingReader struct {
+	r     *strings.Reader
+	max   int
+	reads int
+}
+
+func (c *countingReader) Read(buf []byte) (int, error) {
+	c.reads++
+	if len(buf) > c.max {
+		buf = buf[:c.max]
+	}
+	return c.r.Read(buf)
+}
+
+// mixedStream returns n bytes of text mixed with escape sequences.
+func mixedStream(n int) string {
+	parts := []string{"hello ", "\033[1;31m", "world", "\033[0m", "\r\n", "\033[2J", "\033[10;20H", "x"}
+	var b strings.Builder
+	for i := 0; b.Len() < n; i++ {
+		b.WriteString(parts[i%len(parts)])
+	}
+	return b.String()[:n]
+}
+
+func TestNextN(t *testing.T) {
+	stream := mixedStream(10000)
+
+	decode := func(batch, size int) ([]S, int) {
+		cr := &countingReader{r: strings.NewReader(stream), max: 4096}
+		d := NewReaderSize(cr, size)
+		var all []S
+		for {
+			ss, err := d.NextN(batch)
+			if len(ss) > batch {
+				t.Fatalf("NextN(%d) returned %d sequences", batch, len(ss))
+			}
+			all = append(all, ss...)
+			if err != nil {
+				break
+			}
+		}
+		return all, cr.reads
+	}
+
+	// Text may be split differently depending on the buffer size so only
+	// compare the escape sequences and the text as a whole.
+	codes := func(ss []S) (codes []S, text string) {
+		var b strings.Builder
+		for _, s := range ss {
+			if s.Code != "" {
+				codes = append(codes, s)
+			}
+			b.WriteString(s.Text)
+		}
+		return codes, b.String()
+	}
+	one, oneReads := decode(1, 1024)
+	batch, batchReads := decode(100, 64*1024)
+	oneCodes, oneText := codes(one)
+	batchCodes, batchText := codes(batch)
+	if !reflect.DeepEqual(oneCodes, batchCodes) {
+		t.Errorf("Next and NextN returned different sequences")
+	}
+	if oneText != stream || batchText != stream {
+		t.Errorf("Next or NextN did not return the whole stream")
+	}
+	if batchReads >= oneReads {
+		t.Errorf("NextN called Read %d times, Next called it %d times", batchReads, oneReads)
+	}
+	t.Logf("Next: %d reads, NextN: %d reads", oneReads, batchReads)
+}
+
+func TestNextNBuffered(t *testing.T) {
+	// NextN does not wait for more input once it has decoded a sequence.
+	cr := &countingReader{r: strings.NewReader("abc\033[Hdef"), max: 3}
+	d := NewReader(cr)
+	ss, err := d.NextN(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ss) != 1 || ss[0].Text != "abc" || cr.reads != 1 {
+		t.Errorf("got %v after %d reads, want [abc] after 1 read", ss, cr.reads)
+	}
+}
+
+func TestOneByteC1(t *testing.T) {
+	for _, tt := range []struct {
+		in, two string
+	}{
+		{"\x9b1;32m", "\033[1;32m"},
+		{"\x9d0;title\x9c", "\033]0;title\x9c"},
+		{"\x84", "\033D"}, // IND is not in Table
+		{"\x85", "\033E"},
+		{"\x8fA", "\033OA"},
+	} {
+		read := func(in string) S {
+			d := NewReader(strings.NewReader(in))
+			d.AllowOneByteSequences()
+			s, err := d.Next()
+			if err != nil {
+				t.Fatalf("%q: %v", in, err)
+			}
+			return s
+		}
+		got, want := read(tt.in), read(tt.two)
+		if Table[Name(tt.in[:1])] == nil {
+			// Unknown C1 codes are plain text.
+			if got.Code != "" || got.Text != tt.in {
+				t.Errorf("%q: got %q, want plain text", tt.in, got)
+			}
+			continue
+		}
+		if got.Text != tt.in {
+			t.Errorf("%q: got text %q", tt.in, got.Text)
+		}
+		got.Text, want.Text = "", ""
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %+v, want %+v", tt.in, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package ansi_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pborman/pty/ansi"
+	"github.com/pborman/pty/ansi/xterm"
+)
+
+func TestTokenize(t *testing.T) {
+	// Input2 also uses sequences that are only in the xterm table.
+	xterm.Import()
+	ss := ansi.Tokenize([]byte(ansi.Input2))
+	var text []string
+	for _, s := range ss {
+		text = append(text, s.Text)
+		if s.Code == "" {
+			continue
+		}
+		if ansi.Table[s.Code] == nil {
+			t.Errorf("%q: code %q is not in Table", s.Text, s.Code)
+		}
+	}
+	if got := strings.Join(text, ""); got != ansi.Input2 {
+		t.Errorf("got text:\n%q\nwant:\n%q", got, ansi.Input2)
+	}
+}
+
+func TestTokenizeReader(t *testing.T) {
+	// Tokenize returns the same sequences as a Reader that allows one
+	// byte sequences.
+	for _, in := range []string{
+		ansi.Input + ansi.Input2,
+		"text\x9b1;2Hmore",
+		"\033[1;2",         // truncated CSI
+		"\033]0;title",     // missing ST
+		"\033",             // lone escape
+		"\x9d0;title\x9c.", // one byte OSC and ST
+		"",
+	} {
+		r := ansi.NewReader(strings.NewReader(in))
+		r.AllowOneByteSequences()
+		var want []ansi.S
+		for {
+			s, err := r.Next()
+			if err != nil {
+				break
+			}
+			want = append(want, s)
+		}
+		if got := ansi.Tokenize([]byte(in)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q:\ngot  %q\nwant %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ansi
+
+// A Trie maps escape sequences to their Sequence, one byte at a time.  Unlike
+// Table, a Trie can report that some data is the start of a sequence before
+// the whole sequence has been seen, and that data matches no sequence as soon
+// as a byte does not match.  The zero value is an empty Trie.
+type Trie struct {
+	root trieNode
+}
+
+type trieNode struct {
+	seq  *Sequence
+	next map[byte]*trieNode
+}
+
+// DefaultTrie contains the sequences in Table.  Sequences added to Table with
+// Import are also added to DefaultTrie.
+var DefaultTrie = &Trie{}
+
+func init() {
+	for name, seq := range Table {
+		DefaultTrie.Insert(string(name), seq)
+	}
+}
+
+// Insert adds seq, the escape sequence s, to t, replacing any Sequence
+// previously inserted for s.
+func (t *Trie) Insert(s string, seq *Sequence) {
+	n := &t.root
+	for i := 0; i < len(s); i++ {
+		next := n.next[s[i]]
+		if next == nil {
+			if n.next == nil {
+				n.next = map[byte]*trieNode{}
+			}
+			next = &trieNode{}
+			n.next[s[i]] = next
+		}
+		n = next
+	}
+	n.seq = seq
+}
+
+// Match returns the longest sequence in t that data starts with, and prefix,
+// the bytes of data that make up that sequence.  If no sequence matches then
+// seq is nil and prefix is empty.  Match returns complete as false if all of
+// data was consumed and a longer sequence might still match, that is, more
+// data is needed to be sure of the match.
+func (t *Trie) Match(data []byte) (prefix []byte, seq *Sequence, complete bool) {
+	n := &t.root
+	for i, b := range data {
+		n = n.next[b]
+		if n == nil {
+			return prefix, seq, true
+		}
+		if n.seq != nil {
+			prefix, seq = data[:i+1], n.seq
+		}
+	}
+	return prefix, seq, len(n.next) == 0
+}
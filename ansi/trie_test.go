@@ -0,0 +1,45 @@
+package ansi
+
+import "testing"
+
+func TestTrieTable(t *testing.T) {
+	for name, want := range Table {
+		prefix, seq, _ := DefaultTrie.Match([]byte(name))
+		if string(prefix) != string(name) || seq != want {
+			t.Errorf("Match(%q) got %q, %v, want %q, %v", name, prefix, seq, name, want)
+		}
+	}
+}
+
+func TestTrieMatch(t *testing.T) {
+	var tr Trie
+	tr.Insert("\033[", &CSI_)
+	tr.Insert("\033[H", &CUP_)
+	tr.Insert("\033[J", &ED_)
+	for _, tt := range []struct {
+		data     string
+		prefix   string
+		seq      *Sequence
+		complete bool
+	}{
+		{"", "", nil, false},
+		{"\033", "", nil, false},
+		{"\033[", "\033[", &CSI_, false},
+		{"\033[H", "\033[H", &CUP_, true},
+		{"\033[Hxyz", "\033[H", &CUP_, true},
+		{"\033[K", "\033[", &CSI_, true},
+		{"\033x", "", nil, true},
+		{"abc", "", nil, true},
+	} {
+		prefix, seq, complete := tr.Match([]byte(tt.data))
+		if string(prefix) != tt.prefix || seq != tt.seq || complete != tt.complete {
+			t.Errorf("Match(%q) got %q, %v, %v, want %q, %v, %v", tt.data, prefix, seq, complete, tt.prefix, tt.seq, tt.complete)
+		}
+	}
+
+	// Inserting a sequence again replaces it.
+	tr.Insert("\033[H", &ED_)
+	if _, seq, _ := tr.Match([]byte("\033[H")); seq != &ED_ {
+		t.Errorf("Match after replacing CUP got %v, want ED", seq)
+	}
+}
@@ -1,8 +1,11 @@
 // go run mkansi.go | gofmt > ../ansi.go
+// go run mkansi.go -bench | gofmt > ../ansi_bench_test.go
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -242,9 +245,20 @@ func crack(in string) {
 }
 
 func main() {
+	bench := flag.Bool("bench", false, "generate the benchmarks rather than the table")
+	descriptions := flag.Bool("descriptions", false, "generate the descriptions rather than the table")
+	flag.Parse()
 	for _, line := range codes {
 		crack(line)
 	}
+	if *bench {
+		mkbench()
+		return
+	}
+	if *descriptions {
+		mkdescriptions()
+		return
+	}
 
 	fmt.Println(`// Package ansi provides ansi escape sequence processing as defined by the
 // ECMA-48 standard "Control Functions for Coded Character Sets - Fifth Edition"
@@ -420,6 +434,138 @@ var Table = map[string]*Sequence {`)
 	fmt.Printf("}\n")
 }
 
+// controlStrings are the sequences that start a control string, which is
+// terminated by ST.
+var controlStrings = map[string]bool{
+	"APC": true,
+	"DCS": true,
+	"OSC": true,
+	"PM":  true,
+	"SOS": true,
+}
+
+// mkbench writes benchmarks that decode every sequence in the table.
+func mkbench() {
+	var seqs []*Code
+	for _, c := range append(L1[:], Other...) {
+		if c != nil {
+			seqs = append(seqs, c)
+		}
+	}
+
+	fmt.Println(`// Code generated by mkansi.go -bench; DO NOT EDIT.
+
+package ansi
+
+import (
+	"strings"
+	"testing"
+)
+
+// benchNames are the names of the sequences in Table.
+var benchNames = []Name{`)
+	for _, c := range seqs {
+		fmt.Printf("\t%s,\n", c.Name)
+	}
+	fmt.Println(`}
+
+// benchInput contains one instance of each sequence in benchNames, each
+// followed by a byte of text.  Control strings are terminated by ST.
+var benchInput = "" +`)
+	for i, c := range seqs {
+		fmt.Printf("\tstring(%s) + ", c.Name)
+		if controlStrings[c.Name] {
+			fmt.Printf("\"string\" + string(ST) + ")
+		}
+		if i < len(seqs)-1 {
+			fmt.Printf("\"x\" +\n")
+		} else {
+			fmt.Printf("\"x\"\n")
+		}
+	}
+	io.WriteString(os.Stdout, `
+// BenchmarkDecodeAll measures how fast a Reader decodes benchInput.
+func BenchmarkDecodeAll(b *testing.B) {
+	b.SetBytes(int64(len(benchInput)))
+	n := 0
+	for i := 0; i < b.N; i++ {
+		d := NewReader(strings.NewReader(benchInput))
+		for {
+			if _, err := d.Next(); err != nil {
+				break
+			}
+			n++
+		}
+	}
+	b.ReportMetric(float64(n)/b.Elapsed().Seconds(), "seqs/s")
+}
+
+// BenchmarkTableLookup measures looking up sequences in Table.
+func BenchmarkTableLookup(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if Table[benchNames[i%len(benchNames)]] == nil {
+			b.Fatalf("%q not in Table", benchNames[i%len(benchNames)])
+		}
+	}
+}
+
+// BenchmarkTrieMatch measures matching sequences with DefaultTrie.
+func BenchmarkTrieMatch(b *testing.B) {
+	codes := make([][]byte, len(benchNames))
+	for i, name := range benchNames {
+		codes[i] = []byte(name)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, seq, _ := DefaultTrie.Match(codes[i%len(codes)]); seq == nil {
+			b.Fatalf("%q not in DefaultTrie", codes[i%len(codes)])
+		}
+	}
+}
+`)
+}
+
+// mkdescriptions writes the Descriptions map.
+func mkdescriptions() {
+	fmt.Println(`// Code generated by mkansi.go -descriptions; DO NOT EDIT.
+
+package ansi
+
+// Descriptions maps each sequence to its long name followed by the first two
+// sentences of its description in the ECMA-48 standard.
+var Descriptions = map[Name]string{`)
+	for _, c := range append(L1[:], Other...) {
+		if c == nil {
+			continue
+		}
+		desc := c.Desc
+		if text := sentences(c.Text, 2); text != "" {
+			desc += ": " + text
+		}
+		fmt.Printf("\t%s: %q,\n", c.Name, desc)
+	}
+	fmt.Println("}")
+}
+
+// sentences returns the first n sentences of text with its white space
+// collapsed.  A period followed by a lower case letter, as in "i.e. the",
+// does not end a sentence.
+func sentences(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	end := 0
+	for n > 0 {
+		x := strings.Index(text[end:], ". ")
+		if x < 0 {
+			return text
+		}
+		end += x + 1
+		if c := text[end+1]; c < 'a' || c > 'z' {
+			n--
+		}
+	}
+	return text[:end]
+}
+
 func breakup(in string) (out []string) {
 	for len(in) > 77 {
 		x := strings.LastIndex(in[:77], " ")
@@ -0,0 +1,181 @@
+// Package vt52 provides the escape sequences of the VT52 compatibility mode
+// described in the xterm ctlseqs documentation.  Normally the only direct
+// reference to the vt52 package is:
+//
+//	if err := vt52.Import(); err != nil {
+//		// This should not happen.
+//		// err contains the list of duplicated entries
+//	}
+//
+// VT52 sequences are an ESC followed by a single final byte.  Most of these
+// final bytes are also ECMA-48 C1 controls (e.g., ESC H is HTS in ANSI mode
+// but cursor home in VT52 mode), so the names in this table are the codes
+// prefixed by Mode.  Importing the table never shadows the ANSI meaning of a
+// sequence.  The Code of each sequence is the actual bytes sent.
+package vt52
+
+import (
+	"fmt"
+
+	"github.com/pborman/pty/ansi"
+)
+
+const ESC = 033
+
+// Mode prefixes the names of the sequences in Table.
+const Mode = "VT52 "
+
+// Import imports the vt52 code tables into the ansi table.
+func Import() error {
+	dups := ansi.Import(Table)
+	if len(dups) == 0 {
+		return nil
+	}
+	return fmt.Errorf("duplicated codes: %q", dups)
+}
+
+// Mode "VT52 Mode" Controls beginning with ESC
+
+var VT52_CUU_ = ansi.Sequence{
+	Name: "VT52_CUU",
+	Desc: "Cursor Up",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'A'},
+}
+
+var VT52_CUD_ = ansi.Sequence{
+	Name: "VT52_CUD",
+	Desc: "Cursor Down",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'B'},
+}
+
+var VT52_CUF_ = ansi.Sequence{
+	Name: "VT52_CUF",
+	Desc: "Cursor Forward",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'C'},
+}
+
+var VT52_CUB_ = ansi.Sequence{
+	Name: "VT52_CUB",
+	Desc: "Cursor Backward",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'D'},
+}
+
+var VT52_EGM_ = ansi.Sequence{
+	Name: "VT52_EGM",
+	Desc: "Enter Graphics Mode",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'F'},
+}
+
+var VT52_XGM_ = ansi.Sequence{
+	Name: "VT52_XGM",
+	Desc: "Exit Graphics Mode",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'G'},
+}
+
+var VT52_HOME_ = ansi.Sequence{
+	Name: "VT52_HOME",
+	Desc: "Cursor Home",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'H'},
+}
+
+var VT52_RI_ = ansi.Sequence{
+	Name: "VT52_RI",
+	Desc: "Reverse Line Feed",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'I'},
+}
+
+var VT52_ED_ = ansi.Sequence{
+	Name: "VT52_ED",
+	Desc: "Erase to End of Screen",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'J'},
+}
+
+var VT52_EL_ = ansi.Sequence{
+	Name: "VT52_EL",
+	Desc: "Erase to End of Line",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'K'},
+}
+
+var VT52_DCA_ = ansi.Sequence{
+	Name:     "VT52_DCA",
+	Desc:     "Direct Cursor Address",
+	Notation: "Pl Pc",
+	NParam:   2,
+	MinParam: 2,
+	Type:     ansi.ESC,
+	Code:     []byte{ESC, 'Y'},
+}
+
+var VT52_IDENT_ = ansi.Sequence{
+	Name: "VT52_IDENT",
+	Desc: "Identify",
+	Type: ansi.ESC,
+	Code: []byte{ESC, 'Z'},
+}
+
+var VT52_DECKPAM_ = ansi.Sequence{
+	Name: "VT52_DECKPAM",
+	Desc: "Enter Alternate Keypad Mode",
+	Type: ansi.ESC,
+	Code: []byte{ESC, '='},
+}
+
+var VT52_DECKPNM_ = ansi.Sequence{
+	Name: "VT52_DECKPNM",
+	Desc: "Exit Alternate Keypad Mode",
+	Type: ansi.ESC,
+	Code: []byte{ESC, '>'},
+}
+
+var VT52_ANSI_ = ansi.Sequence{
+	Name: "VT52_ANSI",
+	Desc: "Exit VT52 Mode",
+	Type: ansi.ESC,
+	Code: []byte{ESC, '<'},
+}
+
+const (
+	VT52_CUU     = ansi.Name(Mode + "\033A")
+	VT52_CUD     = ansi.Name(Mode + "\033B")
+	VT52_CUF     = ansi.Name(Mode + "\033C")
+	VT52_CUB     = ansi.Name(Mode + "\033D")
+	VT52_EGM     = ansi.Name(Mode + "\033F")
+	VT52_XGM     = ansi.Name(Mode + "\033G")
+	VT52_HOME    = ansi.Name(Mode + "\033H")
+	VT52_RI      = ansi.Name(Mode + "\033I")
+	VT52_ED      = ansi.Name(Mode + "\033J")
+	VT52_EL      = ansi.Name(Mode + "\033K")
+	VT52_DCA     = ansi.Name(Mode + "\033Y")
+	VT52_IDENT   = ansi.Name(Mode + "\033Z")
+	VT52_DECKPAM = ansi.Name(Mode + "\033=")
+	VT52_DECKPNM = ansi.Name(Mode + "\033>")
+	VT52_ANSI    = ansi.Name(Mode + "\033<")
+)
+
+var Table = map[ansi.Name]*ansi.Sequence{
+	VT52_CUU:     &VT52_CUU_,
+	VT52_CUD:     &VT52_CUD_,
+	VT52_CUF:     &VT52_CUF_,
+	VT52_CUB:     &VT52_CUB_,
+	VT52_EGM:     &VT52_EGM_,
+	VT52_XGM:     &VT52_XGM_,
+	VT52_HOME:    &VT52_HOME_,
+	VT52_RI:      &VT52_RI_,
+	VT52_ED:      &VT52_ED_,
+	VT52_EL:      &VT52_EL_,
+	VT52_DCA:     &VT52_DCA_,
+	VT52_IDENT:   &VT52_IDENT_,
+	VT52_DECKPAM: &VT52_DECKPAM_,
+	VT52_DECKPNM: &VT52_DECKPNM_,
+	VT52_ANSI:    &VT52_ANSI_,
+}
@@ -0,0 +1,45 @@
+package vt52
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pborman/pty/ansi"
+	"github.com/pborman/pty/ansi/xterm"
+)
+
+func TestCollisions(t *testing.T) {
+	for name, seq := range Table {
+		if ansi.Table[name] != nil && ansi.Table[name] != seq {
+			t.Errorf("%s collides with ansi.Table", seq.Name)
+		}
+		if xterm.Table[name] != nil {
+			t.Errorf("%s collides with xterm.Table", seq.Name)
+		}
+		if string(name) != Mode+string(seq.Code) {
+			t.Errorf("%s: name %q does not match code %q", seq.Name, name, seq.Code)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	before := ansi.Table["\033H"]
+	if err := Import(); err != nil {
+		t.Fatal(err)
+	}
+	// Importing a second time reports every entry as a duplicate.
+	if err := Import(); err == nil || !strings.Contains(err.Error(), "duplicated codes") {
+		t.Errorf("second Import got %v, want duplicated codes", err)
+	}
+	if s := ansi.Table["\033A"]; s != nil {
+		t.Errorf("ansi.Table[ESC A] got %s, want nil", s.Name)
+	}
+	if s := ansi.Table["\033H"]; s != before {
+		t.Errorf("ansi.Table[ESC H] changed to %s", s.Name)
+	}
+	for name, seq := range Table {
+		if ansi.Table[name] != seq {
+			t.Errorf("%s not imported", seq.Name)
+		}
+	}
+}
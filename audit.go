@@ -0,0 +1,71 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pborman/pty/mutex"
+)
+
+// An auditLog records the messages clients send to a server.  The audit log
+// is never rotated.
+type auditLog struct {
+	mu *mutex.Mutex
+	f  *os.File
+}
+
+// An auditEntry is a single line in an audit log.
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Client string    `json:"client"`
+	Kind   string    `json:"kind"`
+	Bytes  int       `json:"bytes"`
+}
+
+// openAuditLog opens the audit log at path for appending.
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{
+		mu: mutex.New("auditLog"),
+		f:  f,
+	}, nil
+}
+
+// Record records that client sent a message of kind with n bytes of data.
+// The contents of the message are not recorded.
+func (a *auditLog) Record(client string, kind messageKind, n int) error {
+	data, err := json.Marshal(&auditEntry{
+		Time:   time.Now(),
+		Client: client,
+		Kind:   kind.String(),
+		Bytes:  n,
+	})
+	if err != nil {
+		return err
+	}
+	defer a.mu.Lock("Record")()
+	_, err = a.f.Write(append(data, '\n'))
+	return err
+}
+
+func (a *auditLog) Close() error {
+	return a.f.Close()
+}
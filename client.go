@@ -15,11 +15,14 @@
 package main
 
 import (
-	"fmt"
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/pborman/pty/log"
 	"github.com/pborman/pty/mutex"
@@ -32,17 +35,26 @@ type mBuffer struct {
 
 // A Client represents an incoming client for a shell.
 type Client struct {
-	mu      *mutex.Mutex
-	name    string
-	buffers []mBuffer
-	ready   chan struct{}
-	done    chan struct{}
-	quit    chan struct{}
-	out     io.Writer
-	primary bool
-	pid     int
+	mu       *mutex.Mutex
+	name     string
+	buffers  []mBuffer
+	ready    chan struct{}
+	done     chan struct{}
+	quit     chan struct{}
+	out      io.Writer
+	primary  bool
+	priority int
+	pid      int
+	notify   bool // send bellMessages to the client
+
+	lastWrite time.Time     // time of the last successful write to out
+	wrote     chan struct{} // signaled after each successful write to out
 }
 
+// clientActiveTimeout is how long a client's connection may go without a
+// successful write before IsActive pings it.
+var clientActiveTimeout = 5 * time.Second // so tests can change it
+
 // NewClient returns a freshly initialized client that writes output to out.
 func NewClient(out io.Writer) *Client {
 	c := &Client{
@@ -51,8 +63,9 @@ func NewClient(out io.Writer) *Client {
 		ready: make(chan struct{}, 1),
 		done:  make(chan struct{}),
 		quit:  make(chan struct{}),
+		wrote: make(chan struct{}, 1),
 	}
-	go c.runout()
+	go c.runout(c.ready)
 	return c
 }
 
@@ -160,12 +173,47 @@ func (c *Client) Name() string {
 	return c.name
 }
 
+// IsActive returns true if c is an attached client whose connection is not
+// stuck.  If nothing has been successfully written to c within
+// clientActiveTimeout then c is sent a pingMessage, and c is only active if
+// the ping is written within clientActiveTimeout.
 func (c *Client) IsActive() bool {
-	defer c.mu.Lock("IsActive")()
+	unlock := c.mu.Lock("IsActive")
 	// The pid is only set once the client has sent us a ttynameMessage.
 	// Clients that are just requesting information do not send a
 	// ttynameMessage.
-	return c.pid != 0
+	pid, lastWrite := c.pid, c.lastWrite
+	unlock()
+	if pid == 0 {
+		return false
+	}
+	if time.Since(lastWrite) < clientActiveTimeout {
+		return true
+	}
+	select {
+	case <-c.wrote:
+	default:
+	}
+	c.Send(pingMessage, nil)
+	timer := time.NewTimer(clientActiveTimeout)
+	defer timer.Stop()
+	select {
+	case <-c.wrote:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// written records a successful write to c.
+func (c *Client) written() {
+	unlock := c.mu.Lock("written")
+	c.lastWrite = time.Now()
+	unlock()
+	select {
+	case c.wrote <- struct{}{}:
+	default:
+	}
 }
 
 func (c *Client) SetPid(pid int) {
@@ -173,15 +221,44 @@ func (c *Client) SetPid(pid int) {
 	c.pid = pid
 }
 
+// SetPriority sets the priority of c.  A client only takes the session from
+// a primary client with the same or a lower priority.  When the primary
+// client detaches, the remaining client with the highest priority becomes
+// primary.
+func (c *Client) SetPriority(p int) {
+	defer c.mu.Lock("SetPriority")()
+	c.priority = p
+}
+
+// SetNotify sets whether c is sent a bellMessage when the shell rings the
+// bell.
+func (c *Client) SetNotify(notify bool) {
+	defer c.mu.Lock("SetNotify")()
+	c.notify = notify
+}
+
+// Notify returns true if c is sent a bellMessage when the shell rings the
+// bell.
+func (c *Client) Notify() bool {
+	defer c.mu.Lock("Notify")()
+	return c.notify
+}
+
+// Priority returns the priority of c.
+func (c *Client) Priority() int {
+	defer c.mu.Lock("Priority")()
+	return c.priority
+}
+
 func (c *Client) SetName(name string) {
 	defer c.mu.Lock("SetName")()
 	c.name = name
 }
 
-// runout writes queued output from Output to the client's io.Writer.
-func (c *Client) runout() {
+// runout writes queued output from Output to the client's io.Writer.  ready
+// is passed in as Close sets c.ready to nil.
+func (c *Client) runout(ready chan struct{}) {
 	defer close(c.done)
-	ready := c.ready
 	for {
 		select {
 		case _, ok := <-ready:
@@ -196,30 +273,62 @@ func (c *Client) runout() {
 			if m.kind == 0 && m.data == nil {
 				break
 			}
+			var err error
 			if m.kind == 0 {
-				if _, err := c.out.Write(m.data); err != nil {
-					log.Infof("%v", err)
-				}
+				_, err = c.out.Write(m.data)
 			} else if w, ok := c.out.(*MessengerWriter); ok {
-				w.Send(m.kind, m.data)
+				_, err = w.Send(m.kind, m.data)
+			}
+			if err != nil {
+				log.Infof("%v", err)
+			} else {
+				c.written()
 			}
 		}
 	}
 }
 
-func displayMotd() {
+// motdData is the data available to the message of the day template.
+type motdData struct {
+	SessionName string
+	ClientCount int       // as of the last call to Check
+	LastActive  time.Time // zero if the session has never been active
+}
+
+// displayMotd writes the message of the day for session s to w and then waits
+// for ENTER to be read from r, so the message is not immediately replaced by
+// the session's screen.  The message is read from ~/.pty/motd and expanded as
+// a text/template with a motdData.  Nothing is written, and r is not read, if
+// the file does not exist.  The terminal is expected to be in raw mode so
+// newlines are written as \r\n.
+func displayMotd(w io.Writer, r io.Reader, s *Session) {
 	path := filepath.Join(user.HomeDir, rcdir, "motd")
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		return
 	}
-	if _, err := os.Stdout.Write(data); err != nil {
+	tmpl, err := template.New("motd").Parse(string(data))
+	if err != nil {
+		log.Warnf("motd: %v", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, motdData{
+		SessionName: s.Name,
+		ClientCount: s.cnt,
+		LastActive:  s.LastActive(),
+	}); err != nil {
+		log.Warnf("motd: %v", err)
+		return
+	}
+	motd := strings.ReplaceAll(buf.String(), "\r\n", "\n")
+	motd = strings.ReplaceAll(motd, "\n", "\r\n")
+	if _, err := io.WriteString(w, motd+"Press ENTER to continue: "); err != nil {
 		log.Infof("%v", err)
 	}
-	fmt.Printf("Press ENTER to continue: ")
-	var buf [1]byte
+	var b [1]byte
 	for {
-		if n, _ := os.Stdin.Read(buf[:]); n == 0 || buf[0] == '\n' || buf[0] == '\r' {
+		if n, _ := r.Read(b[:]); n == 0 || b[0] == '\n' || b[0] == '\r' {
 			return
 		}
 	}
@@ -0,0 +1,76 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDisplayMotd(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(user.HomeDir, rcdir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	s, err := MakeSession("", "work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cnt = 2
+	active := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := s.writefile("last_active", active.Format(time.RFC3339Nano)); err != nil {
+		t.Fatal(err)
+	}
+
+	// No motd file displays nothing and does not wait.
+	var buf bytes.Buffer
+	in := strings.NewReader("x\ry")
+	displayMotd(&buf, in, s)
+	if buf.Len() != 0 {
+		t.Errorf("got %q with no motd file", buf.String())
+	}
+	if in.Len() != 3 {
+		t.Errorf("read %d bytes with no motd file", 3-in.Len())
+	}
+
+	motd := "Welcome to {{.SessionName}}\n{{.ClientCount}} clients, last active {{.LastActive.Format \"2006-01-02\"}}\r\n"
+	if err := ioutil.WriteFile(filepath.Join(user.HomeDir, rcdir, "motd"), []byte(motd), 0600); err != nil {
+		t.Fatal(err)
+	}
+	displayMotd(&buf, in, s)
+	if got, want := buf.String(), "Welcome to work\r\n2 clients, last active 2023-05-01\r\nPress ENTER to continue: "; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Only the input up to ENTER is read.
+	if in.Len() != 1 {
+		t.Errorf("%d bytes left after ENTER, want 1", in.Len())
+	}
+
+	// A bad template displays nothing.
+	if err := ioutil.WriteFile(filepath.Join(user.HomeDir, rcdir, "motd"), []byte("{{.Bad"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	displayMotd(&buf, in, s)
+	if buf.Len() != 0 {
+		t.Errorf("got %q with a bad template", buf.String())
+	}
+}
@@ -15,17 +15,49 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
-var config = struct {
-	Forward []string
-}{}
+// A Config holds the settings read from ~/.pty/config.yaml.
+type Config struct {
+	Forward          []string                  // environment variables forwarded to new shells
+	RateLimit        BytesPerSecond            // default output rate limit
+	RateLimits       map[string]BytesPerSecond // output rate limit by session name
+	AllowedNameChars string                    `yaml:"allowed_name_chars"` // non-alphanumeric characters allowed in session names
+	WriteRateLimit   BytesPerSecond            // client input rate limit
+	WriteQueueSize   int                       // maximum queued client input
+	NotifyCommand    string                    `yaml:"notify_command"` // shell command run when the bell rings
+	MaxClients       int                       `yaml:"max_clients"`    // maximum attached clients (0 for no limit)
+	Escape           string                    // default escape character
+	GCThreshold      time.Duration             `yaml:"gc_threshold"` // age of the pid file of a dead session before it is removed
+	SaveFormat       string                    `yaml:"save_format"`  // file name used by save without arguments
+	TeeMaxSize       int64                     `yaml:"tee_max_size"` // bytes written to a tee file before rotating it (0 for no limit)
+	Priority         int                       // default priority of attaching clients
+}
+
+var config Config
+
+// maxConfigClients is the largest allowed value of max_clients.
+const maxConfigClients = 1000
+
+// rateLimit returns the configured output rate limit for the named session.
+func rateLimit(name string) BytesPerSecond {
+	if limit, ok := config.RateLimits[name]; ok {
+		return limit
+	}
+	return config.RateLimit
+}
 
+// ReadConfig reads ~/.pty/config.yaml, if it exists, into config.  An error
+// is returned if the file cannot be read or fails ValidateConfig.
 func ReadConfig() error {
 	data, err := ioutil.ReadFile(filepath.Join(user.HomeDir, rcdir, "config.yaml"))
 	if err != nil {
@@ -34,5 +66,54 @@ func ReadConfig() error {
 		}
 		return err
 	}
-	return yaml.Unmarshal(data, &config)
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	return ValidateConfig(&config)
+}
+
+// ValidateConfig checks the fields of c.  All the problems found are
+// returned, joined into a single error.
+func ValidateConfig(c *Config) error {
+	var errs []error
+	for _, name := range c.Forward {
+		if !envName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("forward: invalid environment variable name %q", name))
+		}
+	}
+	if strings.ContainsRune(c.AllowedNameChars, 0) {
+		errs = append(errs, errors.New("allowed_name_chars: may not contain NUL"))
+	}
+	if strings.ContainsRune(c.AllowedNameChars, '/') {
+		errs = append(errs, errors.New("allowed_name_chars: may not contain /"))
+	}
+	if c.RateLimit < 0 {
+		errs = append(errs, fmt.Errorf("ratelimit: %d is negative", c.RateLimit))
+	}
+	for name, limit := range c.RateLimits {
+		if limit < 0 {
+			errs = append(errs, fmt.Errorf("ratelimits: %s: %d is negative", name, limit))
+		}
+	}
+	if c.WriteRateLimit < 0 {
+		errs = append(errs, fmt.Errorf("writeratelimit: %d is negative", c.WriteRateLimit))
+	}
+	if c.WriteQueueSize < 0 {
+		errs = append(errs, fmt.Errorf("writequeuesize: %d is negative", c.WriteQueueSize))
+	}
+	if c.MaxClients != 0 && (c.MaxClients < 1 || c.MaxClients > maxConfigClients) {
+		errs = append(errs, fmt.Errorf("max_clients: %d is not between 1 and %d", c.MaxClients, maxConfigClients))
+	}
+	if c.GCThreshold < 0 {
+		errs = append(errs, fmt.Errorf("gc_threshold: %v is negative", c.GCThreshold))
+	}
+	if c.TeeMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("tee_max_size: %d is negative", c.TeeMaxSize))
+	}
+	if c.Escape != "" {
+		if _, ok := parseEscapeChar(c.Escape); !ok {
+			errs = append(errs, fmt.Errorf("escape: invalid escape character %q", c.Escape))
+		}
+	}
+	return errors.Join(errs...)
 }
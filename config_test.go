@@ -0,0 +1,96 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateConfig(t *testing.T) {
+	if err := ValidateConfig(&Config{
+		Forward:    []string{"SSH_AUTH_SOCK", "DISPLAY"},
+		MaxClients: 10,
+		Escape:     "^A",
+	}); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	if err := ValidateConfig(&Config{}); err != nil {
+		t.Errorf("empty config: %v", err)
+	}
+
+	err := ValidateConfig(&Config{
+		Forward:    []string{"SSH_AUTH_SOCK", "BAD-NAME"},
+		MaxClients: 1001,
+	})
+	if err == nil {
+		t.Fatal("invalid config did not return an error")
+	}
+	for _, want := range []string{"forward:", "BAD-NAME", "max_clients:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "SSH_AUTH_SOCK") {
+		t.Errorf("error %q mentions a valid name", err)
+	}
+
+	if err := ValidateConfig(&Config{AllowedNameChars: "/-"}); err == nil || !strings.Contains(err.Error(), "allowed_name_chars:") {
+		t.Errorf("allowed_name_chars with / got error %v", err)
+	}
+	if err := ValidateConfig(&Config{Escape: "^AB"}); err == nil || !strings.Contains(err.Error(), "escape:") {
+		t.Errorf("bad escape got error %v", err)
+	}
+	if err := ValidateConfig(&Config{GCThreshold: -time.Second}); err == nil || !strings.Contains(err.Error(), "gc_threshold:") {
+		t.Errorf("negative gc_threshold got error %v", err)
+	}
+	if err := ValidateConfig(&Config{TeeMaxSize: -1}); err == nil || !strings.Contains(err.Error(), "tee_max_size:") {
+		t.Errorf("negative tee_max_size got error %v", err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	defer func(c Config) { config = c }(config)
+	user.HomeDir = t.TempDir()
+	dir := filepath.Join(user.HomeDir, rcdir)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadConfig(); err != nil {
+		t.Errorf("missing config: %v", err)
+	}
+
+	data := "forward:\n  - 1BAD\nmax_clients: 0\nescape: \"^]\"\ngc_threshold: 90s\npriority: -2\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadConfig(); err == nil || !strings.Contains(err.Error(), "1BAD") {
+		t.Errorf("got error %v, want one mentioning 1BAD", err)
+	}
+	if config.Escape != "^]" {
+		t.Errorf("got escape %q, want \"^]\"", config.Escape)
+	}
+	if config.GCThreshold != 90*time.Second {
+		t.Errorf("got gc_threshold %v, want 1m30s", config.GCThreshold)
+	}
+	if config.Priority != -2 {
+		t.Errorf("got priority %d, want -2", config.Priority)
+	}
+}
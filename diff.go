@@ -0,0 +1,192 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pborman/pty/ansi"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells limits the size of the table used to find the longest
+// common subsequence of two lists of lines.  Larger differences are shown
+// as all of the old lines being removed and all of the new lines added.
+const maxDiffCells = 1 << 22
+
+// A diffOp is a single line of a line-level diff.  Kind is ' ' for a line
+// in both lists, '-' for a line only in the old list, and '+' for a line
+// only in the new list.  a and b are the number of old and new lines that
+// precede the line.
+type diffOp struct {
+	kind byte
+	line string
+	a, b int
+}
+
+// diffLines returns the operations that turn the lines in a into the lines
+// in b.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	// Lines common to the start and end of both lists are trimmed off
+	// before finding the longest common subsequence of the rest.
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		ops = append(ops, diffOp{' ', a[p], p, p})
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+	ma, mb := a[p:len(a)-s], b[p:len(b)-s]
+
+	if len(ma)*len(mb) > maxDiffCells {
+		for x, line := range ma {
+			ops = append(ops, diffOp{'-', line, p + x, p})
+		}
+		for x, line := range mb {
+			ops = append(ops, diffOp{'+', line, p + len(ma), p + x})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence
+		// of ma[i:] and mb[j:].
+		lcs := make([][]int, len(ma)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(mb)+1)
+		}
+		for i := len(ma) - 1; i >= 0; i-- {
+			for j := len(mb) - 1; j >= 0; j-- {
+				if ma[i] == mb[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(ma) || j < len(mb) {
+			switch {
+			case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+				ops = append(ops, diffOp{' ', ma[i], p + i, p + j})
+				i++
+				j++
+			case j == len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, diffOp{'-', ma[i], p + i, p + j})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', mb[j], p + i, p + j})
+				j++
+			}
+		}
+	}
+	for x := 0; x < s; x++ {
+		ops = append(ops, diffOp{' ', a[len(a)-s+x], len(a) - s + x, len(b) - s + x})
+	}
+	return ops
+}
+
+// unifiedDiff returns the differences between the lines in a and b in
+// unified diff format, or "" if they are the same.  Lines end in "\n".
+func unifiedDiff(aname, bname string, a, b []string) string {
+	ops := diffLines(a, b)
+	var sb strings.Builder
+	for x := 0; x < len(ops); {
+		if ops[x].kind == ' ' {
+			x++
+			continue
+		}
+		// Changes separated by no more than twice the context are
+		// shown in the same hunk.
+		start := max(x-diffContext, 0)
+		end := x
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				end = min(end+diffContext, len(ops))
+				break
+			}
+			end = next
+		}
+		hunk := ops[start:end]
+		x = end
+
+		alen, blen := 0, 0
+		for _, op := range hunk {
+			if op.kind != '+' {
+				alen++
+			}
+			if op.kind != '-' {
+				blen++
+			}
+		}
+		astart, bstart := hunk[0].a, hunk[0].b
+		if alen > 0 {
+			astart++
+		}
+		if blen > 0 {
+			bstart++
+		}
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aname, bname)
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", astart, alen, bstart, blen)
+		for _, op := range hunk {
+			fmt.Fprintf(&sb, "%c%s\n", op.kind, op.line)
+		}
+	}
+	return sb.String()
+}
+
+// screenLines returns the text of the screen buffer buf, stripped of escape
+// sequences, as a list of lines.
+func screenLines(buf []byte) []string {
+	// Strip still removes sequences it reports as invalid.
+	text, _ := ansi.Strip(buf)
+	s := strings.ReplaceAll(string(text), "\r", "")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// lastLine returns the last line of the screen buffer buf that is not blank,
+// stripped of escape sequences and surrounding white space.
+func lastLine(buf []byte) string {
+	lines := screenLines(buf)
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// screenDiff returns the differences between the screen saved in the file
+// name, whose contents are saved, and the screen buffer screen.
+func screenDiff(name string, saved, screen []byte) string {
+	return unifiedDiff(name, "screen", screenLines(saved), screenLines(screen))
+}
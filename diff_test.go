@@ -0,0 +1,133 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "same",
+			a:    "a b c",
+			b:    "a b c",
+		},
+		{
+			name: "added",
+			a:    "a b c",
+			b:    "a b x c",
+			want: `--- old
++++ new
+@@ -1,3 +1,4 @@
+ a
+ b
++x
+ c
+`,
+		},
+		{
+			name: "removed",
+			a:    "1 2 3 4 5 6 7 8",
+			b:    "1 2 3 4 6 7 8",
+			want: `--- old
++++ new
+@@ -2,7 +2,6 @@
+ 2
+ 3
+ 4
+-5
+ 6
+ 7
+ 8
+`,
+		},
+		{
+			name: "changed",
+			a:    "a b c",
+			b:    "a B c",
+			want: `--- old
++++ new
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		},
+		{
+			name: "hunks",
+			a:    "1 2 3 4 5 6 7 8 9 10 11 12",
+			b:    "x 1 2 3 4 5 6 7 8 9 10 11 12 y",
+			want: `--- old
++++ new
+@@ -1,3 +1,4 @@
++x
+ 1
+ 2
+ 3
+@@ -10,3 +11,4 @@
+ 10
+ 11
+ 12
++y
+`,
+		},
+		{
+			name: "empty",
+			a:    "",
+			b:    "a",
+			want: `--- old
++++ new
+@@ -0,0 +1,1 @@
++a
+`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("old", "new", strings.Fields(tt.a), strings.Fields(tt.b))
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScreenLines(t *testing.T) {
+	got := screenLines([]byte("\033[1mbold\033[m\r\nplain\r\n"))
+	if want := []string{"bold", "plain"}; strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"\r\n  \r\n", ""},
+		{"one\r\ntwo", "two"},
+		{"one\r\n\033[1mtwo\033[m  \r\n\r\n   \r\n", "two"},
+	} {
+		if got := lastLine([]byte(tt.in)); got != tt.want {
+			t.Errorf("lastLine(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
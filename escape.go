@@ -21,9 +21,13 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/pborman/pty/ansi"
+	"github.com/pborman/pty/ansi/vt52"
 	"github.com/pborman/pty/ansi/xterm"
+	"github.com/pborman/pty/log"
+	"github.com/pborman/pty/mutex"
 )
 
 func init() {
@@ -44,29 +48,118 @@ type seqCall struct {
 	callback func(*EscapeBuffer, []byte) bool
 }
 
+// An EscapeBuffer keeps the output of a shell so it can be replayed to newly
+// attached clients.  Bytes that might be the start of a registered sequence
+// are held until the sequence is complete, but never more than
+// MaxPartialBytes of them.  Once the limit is reached the held bytes are
+// added to the buffer as is.
 type EscapeBuffer struct {
-	normal     []byte
-	alt        []byte
-	partial    []byte
-	inalt      bool
-	firstBytes string
-	sequences  []seqCall
-	inseq      *seqCall
+	MaxPartialBytes int // most bytes held for an incomplete sequence
+
+	mu          *mutex.Mutex
+	normal      []byte
+	alt         []byte
+	partial     []byte
+	utfPartial  []byte // trailing bytes of an incomplete UTF-8 rune
+	inalt       bool
+	inSync      bool   // in a synchronized update
+	syncBuf     []byte // output held during a synchronized update
+	firstBytes  string
+	sequences   []seqCall
+	passthru    [][]byte // prefixes of sequences that are not stored
+	inseq       *seqCall
+	metrics     EscapeBufferMetrics
+	prefix      []byte // written before the buffer by the next replay
+	suffix      []byte // written after the buffer by the next replay
+	cursorRow   int    // 1 based row of the cursor
+	cursorCol   int    // 1 based column of the cursor
+	hasCursor   bool   // true if the cursor position is known
+	cursorSeq   []byte // incomplete control sequence seen by trackCursor
+	inString    bool   // trackCursor is in a string, such as an OSC
+	wrapNext    bool   // the next printed character wraps to the next line
+	savedRow    int    // cursorRow saved by ESC 7 or CSI s
+	savedCol    int    // cursorCol saved by ESC 7 or CSI s
+	savedCursor bool   // hasCursor saved by ESC 7 or CSI s
+	rows        int    // rows on the screen, 0 if not known
+	cols        int    // columns on the screen, 0 if not known
+}
+
+// EscapeBufferMetrics are counters kept by an EscapeBuffer.
+type EscapeBufferMetrics struct {
+	SequencesMatched uint64 // Number of escape sequences matched
+	BytesProcessed   uint64 // Number of bytes passed to Write
+	PartialWaits     uint64 // Times a partial match was held for more data
+	BytesDropped     uint64 // Bytes evicted from the screen buffers
+}
+
+// EscapeBufferOptions are the options passed to NewEscapeBuffer.
+type EscapeBufferOptions struct {
+	// MaxBytes is the maximum number of bytes kept in each of the normal
+	// and alternate screen buffers.  If 0, 1MB is used.  When a buffer
+	// is full, whole lines are evicted from the front of the buffer.
+	MaxBytes int
+
+	// VT52 registers the VT52 mode sequences so they are recognized
+	// (and counted in the metrics) as whole sequences.  The sequences
+	// are passed through to the buffer unchanged.
+	VT52 bool
 }
 
-func NewEscapeBuffer(n int) *EscapeBuffer {
+// defaultMaxPartialBytes is the initial MaxPartialBytes of an EscapeBuffer.
+const defaultMaxPartialBytes = 4096
+
+// maxSequenceLength is the longest sequence that may be registered with an
+// EscapeBuffer.
+const maxSequenceLength = 256
+
+func NewEscapeBuffer(opts EscapeBufferOptions) *EscapeBuffer {
+	n := opts.MaxBytes
 	if n <= 0 {
 		n = 1024 * 1024
 	}
-	return &EscapeBuffer{
-		normal: make([]byte, 0, n),
-		alt:    make([]byte, 0, n),
+	e := &EscapeBuffer{
+		MaxPartialBytes: defaultMaxPartialBytes,
+		mu:              mutex.New("EscapeBuffer"),
+		normal:          make([]byte, 0, n),
+		alt:             make([]byte, 0, n),
+	}
+	if opts.VT52 {
+		for _, seq := range vt52.Table {
+			if err := e.AddSequence(string(seq.Code), passthrough); err != nil {
+				log.Errorf("adding VT52 sequence %q: %v", seq.Code, err)
+			}
+		}
+	}
+	return e
+}
+
+// passthrough is a sequence callback that keeps the sequence in the buffer.
+func passthrough(*EscapeBuffer) bool { return true }
+
+// Metrics returns a copy of e's metrics.
+func (e *EscapeBuffer) Metrics() EscapeBufferMetrics {
+	defer e.mu.Lock("Metrics")()
+	return e.metrics
+}
+
+// Len returns the number of bytes in the current screen buffer.
+func (e *EscapeBuffer) Len() int {
+	defer e.mu.Lock("Len")()
+	if e.inalt {
+		return len(e.alt)
 	}
+	return len(e.normal)
 }
 
-func (e *EscapeBuffer) AddSequence(seq string, f func(*EscapeBuffer) bool) {
+// AddSequence causes f to be called when the sequence seq is written to e.
+// The sequence is kept in the buffer if f returns true.  An error is returned
+// if seq is longer than 256 bytes.
+func (e *EscapeBuffer) AddSequence(seq string, f func(*EscapeBuffer) bool) error {
 	if len(seq) == 0 {
-		return
+		return nil
+	}
+	if len(seq) > maxSequenceLength {
+		return fmt.Errorf("sequence of %d bytes is longer than %d", len(seq), maxSequenceLength)
 	}
 	if strings.IndexByte(e.firstBytes, seq[0]) < 0 {
 		e.firstBytes += string(seq[:1])
@@ -77,17 +170,22 @@ func (e *EscapeBuffer) AddSequence(seq string, f func(*EscapeBuffer) bool) {
 			return f(e)
 		},
 	})
+	return nil
 }
 
-func (e *EscapeBuffer) AddReportSequence(seq, term string, f func(*EscapeBuffer, []byte) bool) {
+// AddReportSequence is like AddSequence but the sequence continues until
+// term.  The bytes between seq and term are passed to f.
+func (e *EscapeBuffer) AddReportSequence(seq, term string, f func(*EscapeBuffer, []byte) bool) error {
 	if len(seq) == 0 {
-		return
+		return nil
 	}
 	if len(term) == 0 {
-		e.AddSequence(seq, func(*EscapeBuffer) bool {
+		return e.AddSequence(seq, func(*EscapeBuffer) bool {
 			return f(e, nil)
 		})
-		return
+	}
+	if len(seq) > maxSequenceLength || len(term) > maxSequenceLength {
+		return fmt.Errorf("sequence is longer than %d bytes", maxSequenceLength)
 	}
 
 	if strings.IndexByte(e.firstBytes, seq[0]) < 0 {
@@ -98,8 +196,104 @@ func (e *EscapeBuffer) AddReportSequence(seq, term string, f func(*EscapeBuffer,
 		term:     []byte(term),
 		callback: f,
 	})
+	return nil
+}
+
+// AddPassthroughPrefix causes every sequence that starts with prefix, such as
+// "\033[?", to be dropped rather than kept in the buffer.  The end of the
+// sequence is found using the ECMA-48 rules for the kind of sequence prefix
+// starts: a control sequence (ESC [) ends with a final byte, a control string
+// (ESC ], ESC P, ESC X, ESC ^ or ESC _) ends with BEL or ST, and any other
+// escape sequence ends with the first byte that is not an intermediate byte.
+// Sequences registered with AddSequence or AddReportSequence take precedence.
+func (e *EscapeBuffer) AddPassthroughPrefix(prefix string) {
+	if len(prefix) == 0 {
+		return
+	}
+	if strings.IndexByte(e.firstBytes, prefix[0]) < 0 {
+		e.firstBytes += prefix[:1]
+	}
+	e.passthru = append(e.passthru, []byte(prefix))
+}
+
+// matchPassthrough returns the length of the sequence at the start of buf if
+// it starts with a passthrough prefix.  It returns -1 if buf ends before the
+// sequence does and 0 if buf does not start with a passthrough sequence.
+func (e *EscapeBuffer) matchPassthrough(buf []byte) int {
+	for _, prefix := range e.passthru {
+		if len(buf) < len(prefix) {
+			if bytes.HasPrefix(prefix, buf) {
+				return -1
+			}
+			continue
+		}
+		if !bytes.HasPrefix(buf, prefix) {
+			continue
+		}
+		if n := sequenceLength(buf); n < 0 || n >= len(prefix) {
+			return n
+		}
+	}
+	return 0
+}
+
+// sequenceLength returns the length of the escape sequence at the start of
+// buf, -1 if buf ends before the sequence does, or 0 if buf does not start
+// with a valid escape sequence.
+func sequenceLength(buf []byte) int {
+	if len(buf) < 2 {
+		return -1
+	}
+	if buf[0] != '\033' {
+		return 0
+	}
+	switch buf[1] {
+	case '[':
+		// Parameter bytes and intermediate bytes followed by a
+		// final byte.
+		for i := 2; i < len(buf); i++ {
+			switch c := buf[i]; {
+			case c >= 0x20 && c <= 0x3f:
+			case c >= 0x40 && c <= 0x7e:
+				return i + 1
+			default:
+				return 0
+			}
+		}
+	case ']', 'P', 'X', '^', '_':
+		// A control string is terminated by BEL or ST.
+		for i := 2; i < len(buf); i++ {
+			switch buf[i] {
+			case '\007':
+				return i + 1
+			case '\033':
+				if i+1 == len(buf) {
+					return -1
+				}
+				if buf[i+1] == '\\' {
+					return i + 2
+				}
+				return 0
+			}
+		}
+	default:
+		for i := 1; i < len(buf); i++ {
+			switch c := buf[i]; {
+			case c >= 0x20 && c <= 0x2f:
+			case c >= 0x30 && c <= 0x7e:
+				return i + 1
+			default:
+				return 0
+			}
+		}
+	}
+	return -1
 }
 
+// appendto appends new to old without growing old past its capacity.  If
+// there is not enough room then bytes are evicted from the front of old.
+// Whole lines are evicted so the buffer always starts at the beginning of a
+// line unless the buffer contains no newlines.
 func appendto(old, new []byte) []byte {
 	nl := len(new)
 	ol := len(old)
@@ -107,8 +301,11 @@ func appendto(old, new []byte) []byte {
 	switch {
 	case nl == 0:
 	case nl >= oc:
-		old = old[:oc]
-		copy(old, new[nl-oc:])
+		new = new[nl-oc:]
+		if x := bytes.IndexByte(new, '\n'); x >= 0 && x < len(new)-1 {
+			new = new[x+1:]
+		}
+		old = old[:copy(old[:oc], new)]
 	case nl+ol < oc:
 		old = append(old, new...)
 	default:
@@ -120,31 +317,522 @@ func appendto(old, new []byte) []byte {
 			}
 		}
 		extra = nl + ol - oc + extra
+		if extra > ol {
+			extra = ol
+		}
+		if x := bytes.IndexByte(old[extra:], '\n'); x >= 0 {
+			extra += x + 1
+		}
 		old = old[:copy(old[:oc], old[extra:])]
 		old = append(old, new...)
 	}
 	return old
 }
 
+// An EscapeSnapshot is a point in time copy of an EscapeBuffer.  It must not
+// be modified.
+type EscapeSnapshot struct {
+	Normal []byte // The normal screen buffer
+	Alt    []byte // The alternate screen buffer
+	InAlt  bool   // True if the alternate screen buffer was in use
+}
+
+// Snapshot returns a copy of the current state of e.
+func (e *EscapeBuffer) Snapshot() *EscapeSnapshot {
+	defer e.mu.Lock("Snapshot")()
+	return &EscapeSnapshot{
+		Normal: append([]byte{}, e.normal...),
+		Alt:    append([]byte{}, e.alt...),
+		InAlt:  e.inalt,
+	}
+}
+
+// Bytes returns the screen buffer that was in use when the snapshot was taken.
+func (snap *EscapeSnapshot) Bytes() []byte {
+	if snap.InAlt {
+		return snap.Alt
+	}
+	return snap.Normal
+}
+
+// WriteTo writes the screen buffer that was in use when the snapshot was
+// taken to w.
+func (snap *EscapeSnapshot) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(snap.Bytes())
+	return int64(n), err
+}
+
+// WriteTo writes the screen buffer currently in use to w without copying it.
+// WriteTo implements io.WriterTo.  The buffer is locked until w.Write
+// returns, so w must not retain the buffer nor block for long.  Any injected
+// prefix and suffix are written before and after the buffer.
+func (e *EscapeBuffer) WriteTo(w io.Writer) (int64, error) {
+	defer e.mu.Lock("WriteTo")()
+	buf := e.normal
+	if e.inalt {
+		buf = e.alt
+	}
+	var cnt int64
+	err := e.writeInjected(w, &cnt, func() error {
+		return writeCount(w, &cnt, buf)
+	})
+	return cnt, err
+}
+
+// Replay writes the normal screen buffer to w followed, if the alternate
+// screen is in use, by the sequence to switch to the alternate screen and the
+// alternate screen buffer.  This recreates the current screen for a new
+// client.  Any injected prefix and suffix are written before and after the
+// buffers.
+func (e *EscapeBuffer) Replay(w io.Writer) (int64, error) {
+	defer e.mu.Lock("Replay")()
+	var cnt int64
+	err := e.replay(w, &cnt)
+	return cnt, err
+}
+
+// ReplayAfter is like Replay but first writes seq to w.  Unlike calling
+// InjectPrefix and then Replay, no output can be added to the buffers
+// between writing seq and the replay.
+func (e *EscapeBuffer) ReplayAfter(w io.Writer, seq []byte) (int64, error) {
+	defer e.mu.Lock("ReplayAfter")()
+	var cnt int64
+	if err := writeCount(w, &cnt, seq); err != nil {
+		return cnt, err
+	}
+	err := e.replay(w, &cnt)
+	return cnt, err
+}
+
+// RestoreAfter is like ReplayAfter but, when the cursor position is known,
+// also moves the cursor to that position after the replay.  The replay
+// starts from a different screen than the shell's output did, e.g., after
+// bytes were dropped from the buffers, so it may leave the cursor elsewhere.
+func (e *EscapeBuffer) RestoreAfter(w io.Writer, seq []byte) (int64, error) {
+	defer e.mu.Lock("RestoreAfter")()
+	var cnt int64
+	if err := writeCount(w, &cnt, seq); err != nil {
+		return cnt, err
+	}
+	if err := e.replay(w, &cnt); err != nil || !e.hasCursor {
+		return cnt, err
+	}
+	err := writeCount(w, &cnt, []byte(fmt.Sprintf("\033[%d;%dH", e.cursorRow, e.cursorCol)))
+	return cnt, err
+}
+
+// replay does the work of Replay.  e.mu must be held.
+func (e *EscapeBuffer) replay(w io.Writer, cnt *int64) error {
+	return e.writeInjected(w, cnt, func() error {
+		if err := writeCount(w, cnt, e.normal); err != nil || !e.inalt {
+			return err
+		}
+		if err := writeCount(w, cnt, []byte(scasb)); err != nil {
+			return err
+		}
+		return writeCount(w, cnt, e.alt)
+	})
+}
+
+// writeInjected writes e.prefix to w, calls write, and then writes e.suffix
+// to w.  The prefix and suffix are only written once.  The number of bytes
+// written is added to cnt.
+func (e *EscapeBuffer) writeInjected(w io.Writer, cnt *int64, write func() error) error {
+	prefix, suffix := e.prefix, e.suffix
+	e.prefix, e.suffix = nil, nil
+	if err := writeCount(w, cnt, prefix); err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	return writeCount(w, cnt, suffix)
+}
+
+// writeCount writes buf, if not empty, to w and adds the number of bytes
+// written to cnt.
+func writeCount(w io.Writer, cnt *int64, buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	n, err := w.Write(buf)
+	*cnt += int64(n)
+	return err
+}
+
+// InjectPrefix arranges for seq to be written before the screen buffer by
+// the next call to WriteTo or Replay.  The screen buffer is not changed.
+func (e *EscapeBuffer) InjectPrefix(seq []byte) {
+	defer e.mu.Lock("InjectPrefix")()
+	e.prefix = append(e.prefix, seq...)
+}
+
+// InjectSuffix arranges for seq to be written after the screen buffer by the
+// next call to WriteTo or Replay.  The screen buffer is not changed.
+func (e *EscapeBuffer) InjectSuffix(seq []byte) {
+	defer e.mu.Lock("InjectSuffix")()
+	e.suffix = append(e.suffix, seq...)
+}
+
+// Cursor returns the 1 based row and column of the cursor in the current
+// screen buffer.  The ok is false if the position is not known, i.e., there
+// has not been a cursor position (CUP) sequence, or a call to
+// SetCursorPosition, since the screen was last switched.
+func (e *EscapeBuffer) Cursor() (row, col int, ok bool) {
+	defer e.mu.Lock("Cursor")()
+	return e.cursorRow, e.cursorCol, e.hasCursor
+}
+
+// SetCursorPosition sets the 1 based row and column of the cursor in the
+// current screen buffer.
+func (e *EscapeBuffer) SetCursorPosition(row, col int) {
+	defer e.mu.Lock("SetCursorPosition")()
+	e.cursorRow, e.cursorCol = max(row, 1), max(col, 1)
+	e.hasCursor = true
+	e.wrapNext = false
+}
+
+// SetSize sets the size of the screen used to wrap printed text and to keep
+// the tracked cursor on the screen.  A size of 0 is not limited.
+func (e *EscapeBuffer) SetSize(rows, cols int) {
+	defer e.mu.Lock("SetSize")()
+	e.rows, e.cols = rows, cols
+}
+
+// trackCursor updates the cursor position from the text printed and the
+// control characters and sequences in buf.  Printed text advances the
+// column, wrapping at the width of the screen, and CR, LF, BS, and TAB move
+// the cursor as a terminal does.  The cursor position (CUP), relative
+// movement, column and row, and save and restore sequences are followed.
+// Strings, such as OSC, and character set designations do not move the
+// cursor.  Each UTF-8 rune is counted as a single column and scrolling
+// regions are not tracked.  Relative movements are tracked even when the
+// position is not known as a later CUP replaces the position.  An incomplete
+// control sequence at the end of buf is saved and prepended to the next buf.
+func (e *EscapeBuffer) trackCursor(buf []byte) {
+	if len(e.cursorSeq) > 0 {
+		buf = append(e.cursorSeq, buf...)
+		e.cursorSeq = nil
+	}
+	for i := 0; i < len(buf); i++ {
+		c := buf[i]
+		if e.inString {
+			// A string ends with BEL or ST (ESC \).
+			switch {
+			case c == '\a':
+				e.inString = false
+			case c != '\033':
+			case i+1 >= len(buf):
+				e.cursorSeq = append(e.cursorSeq, c)
+				return
+			case buf[i+1] == '\\':
+				e.inString = false
+				i++
+			}
+			continue
+		}
+		switch {
+		case c == '\r':
+			e.moveCursor(e.cursorRow, 1)
+		case c == '\n', c == '\v', c == '\f':
+			e.moveCursor(e.cursorRow+1, e.cursorCol)
+		case c == '\b':
+			e.moveCursor(e.cursorRow, e.cursorCol-1)
+		case c == '\t':
+			e.moveCursor(e.cursorRow, (e.cursorCol-1)/8*8+9)
+		case c == '\033':
+			n, more := e.trackEscape(buf[i+1:])
+			if more {
+				if len(buf)-i <= maxCursorSeq {
+					e.cursorSeq = append(e.cursorSeq, buf[i:]...)
+				}
+				return
+			}
+			i += n
+		case c < 0x20, c == 0x7f, c&0xc0 == 0x80:
+			// Other control characters and UTF-8 continuation bytes
+			// do not move the cursor.
+		default:
+			e.print()
+		}
+	}
+}
+
+// trackEscape updates the cursor position from the escape sequence in buf,
+// which follows the ESC.  The number of bytes of buf that were consumed is
+// returned in n.  If buf ends before the end of the sequence then more is
+// returned as true.
+func (e *EscapeBuffer) trackEscape(buf []byte) (n int, more bool) {
+	if len(buf) == 0 {
+		return 0, true
+	}
+	switch buf[0] {
+	case '[':
+		final, params, n, more := csi(buf[1:])
+		if more {
+			return 0, true
+		}
+		e.trackCSI(final, params)
+		return n + 1, false
+	case ']', 'P', 'X', '^', '_':
+		// OSC, DCS, SOS, PM, and APC strings
+		e.inString = true
+	case '7':
+		e.saveCursor()
+	case '8':
+		e.restoreCursor()
+	case 'D': // IND
+		e.moveCursor(e.cursorRow+1, e.cursorCol)
+	case 'E': // NEL
+		e.moveCursor(e.cursorRow+1, 1)
+	case 'M': // RI
+		e.moveCursor(e.cursorRow-1, e.cursorCol)
+	default:
+		// Skip any intermediate bytes, e.g., ESC ( B, and the
+		// final byte.
+		for i, c := range buf {
+			if c < 0x20 || c > 0x2f {
+				return i + 1, false
+			}
+		}
+		return 0, true
+	}
+	return 1, false
+}
+
+// trackCSI updates the cursor position from the control sequence with the
+// final byte final and the parameters params.
+func (e *EscapeBuffer) trackCSI(final byte, params [2]int) {
+	// n is the CSI parameter, where 0 means 1.
+	n := max(params[0], 1)
+	row, col := e.cursorRow, e.cursorCol
+	switch final {
+	case 'H', 'f': // CUP, HVP
+		e.hasCursor = true
+		e.moveCursor(n, max(params[1], 1))
+	case 'A': // CUU
+		e.moveCursor(row-n, col)
+	case 'B', 'e': // CUD, VPR
+		e.moveCursor(row+n, col)
+	case 'C', 'a': // CUF, HPR
+		e.moveCursor(row, col+n)
+	case 'D': // CUB
+		e.moveCursor(row, col-n)
+	case 'E': // CNL
+		e.moveCursor(row+n, 1)
+	case 'F': // CPL
+		e.moveCursor(row-n, 1)
+	case 'G', '`': // CHA, HPA
+		e.moveCursor(row, n)
+	case 'd': // VPA
+		e.moveCursor(n, col)
+	case 's': // SCOSC
+		e.saveCursor()
+	case 'u': // SCORC
+		e.restoreCursor()
+	}
+}
+
+// print advances the cursor over a printed character.  As with a terminal,
+// a character printed in the last column leaves the cursor there and the
+// next character printed wraps to the next line.
+func (e *EscapeBuffer) print() {
+	if e.wrapNext {
+		e.moveCursor(e.cursorRow+1, 1)
+	}
+	if e.cols > 0 && e.cursorCol >= e.cols {
+		e.wrapNext = true
+		return
+	}
+	e.cursorCol++
+}
+
+// moveCursor moves the cursor to row and col, keeping it on the screen.
+func (e *EscapeBuffer) moveCursor(row, col int) {
+	if e.rows > 0 {
+		row = min(row, e.rows)
+	}
+	if e.cols > 0 {
+		col = min(col, e.cols)
+	}
+	e.cursorRow, e.cursorCol = max(row, 1), max(col, 1)
+	e.wrapNext = false
+}
+
+// saveCursor saves the cursor position for restoreCursor.
+func (e *EscapeBuffer) saveCursor() {
+	e.savedRow, e.savedCol, e.savedCursor = e.cursorRow, e.cursorCol, e.hasCursor
+}
+
+// restoreCursor restores the cursor position saved by saveCursor.
+func (e *EscapeBuffer) restoreCursor() {
+	e.hasCursor = e.savedCursor
+	e.moveCursor(e.savedRow, e.savedCol)
+}
+
+// maxCursorSeq is the longest incomplete control sequence saved by
+// trackCursor.
+const maxCursorSeq = 32
+
+// csi parses the parameters and final byte of the control sequence in buf,
+// which follows the ESC [.  Only sequences with up to two numeric parameters
+// are parsed, all others return a final of 0.  The number of bytes of buf that
+// were consumed is returned in n.  If buf ends before the final byte then more
+// is returned as true.
+func csi(buf []byte) (final byte, params [2]int, n int, more bool) {
+	p := 0
+	for i, c := range buf {
+		switch {
+		case c >= '0' && c <= '9':
+			if p < len(params) {
+				params[p] = params[p]*10 + int(c-'0')
+			}
+		case c == ';':
+			p++
+		case c >= 0x40 && c <= 0x7e:
+			if p >= len(params) {
+				return 0, [2]int{}, i + 1, false
+			}
+			return c, params, i + 1, false
+		case c >= 0x20 && c <= 0x3f:
+			// private or intermediate bytes
+			p = len(params)
+		default:
+			// not a control sequence
+			return 0, [2]int{}, i, false
+		}
+	}
+	return 0, [2]int{}, len(buf), true
+}
+
 func (e *EscapeBuffer) Flush() {
+	defer e.mu.Lock("Flush")()
+	e.flushSync()
+	e.add(e.partial)
+	e.add(e.utfPartial)
+}
+
+// inOSC returns true if the output so far ends in an unterminated operating
+// system command (OSC) sequence.  An OSC is terminated by either BEL or ST
+// (ESC \\), so a BEL in an OSC is not a bell.
+func (e *EscapeBuffer) inOSC() bool {
+	buf := e.normal
+	switch {
+	case e.inSync:
+		buf = e.syncBuf
+	case e.inalt:
+		buf = e.alt
+	}
+	x := bytes.LastIndex(buf, []byte("\033]"))
+	if x < 0 {
+		return false
+	}
+	buf = buf[x:]
+	return bytes.IndexByte(buf, '\007') < 0 && !bytes.Contains(buf, []byte("\033\\"))
+}
+
+// InAlt returns true if the alternate screen buffer is in use.
+func (e *EscapeBuffer) InAlt() bool {
+	defer e.mu.Lock("InAlt")()
+	return e.inalt
+}
+
+// InSync returns true if e is in the middle of a synchronized update.
+func (e *EscapeBuffer) InSync() bool {
+	defer e.mu.Lock("InSync")()
+	return e.inSync
+}
+
+// beginSync starts a synchronized update.  Output is held in syncBuf until
+// endSync is called so the screen buffers never contain a partial update.
+func (e *EscapeBuffer) beginSync() {
+	e.inSync = true
+}
+
+// endSync ends a synchronized update, adding the held output to the current
+// screen buffer.
+func (e *EscapeBuffer) endSync() {
+	e.flushSync()
+	e.inSync = false
+}
+
+// flushSync adds any output held by a synchronized update to the current
+// screen buffer.  Callbacks that change the screen buffers must call
+// flushSync first.
+func (e *EscapeBuffer) flushSync() {
+	e.store(e.syncBuf)
+	e.syncBuf = e.syncBuf[:0]
+}
+
+// add appends buf to the current screen buffer, or to syncBuf during a
+// synchronized update.  A synchronized update that grows larger than the
+// screen buffer is flushed early.
+func (e *EscapeBuffer) add(buf []byte) {
+	if e.inSync {
+		e.syncBuf = append(e.syncBuf, buf...)
+		if len(e.syncBuf) >= cap(e.normal) {
+			e.flushSync()
+		}
+		return
+	}
+	e.store(buf)
+}
+
+// store appends buf to the current screen buffer, counting any bytes that are
+// evicted.  A sequence may switch screens so inalt is checked on each call.
+func (e *EscapeBuffer) store(buf []byte) {
+	e.trackCursor(buf)
 	if e.inalt {
-		e.alt = appendto(e.alt, e.partial)
+		n := len(e.alt) + len(buf)
+		e.alt = appendto(e.alt, buf)
+		e.metrics.BytesDropped += uint64(n - len(e.alt))
 	} else {
-		e.normal = appendto(e.normal, e.partial)
+		n := len(e.normal) + len(buf)
+		e.normal = appendto(e.normal, buf)
+		e.metrics.BytesDropped += uint64(n - len(e.normal))
 	}
 }
 
 func (e *EscapeBuffer) Write(buf []byte) (int, error) {
+	defer e.mu.Lock("Write")()
 	n := len(buf)
+	e.metrics.BytesProcessed += uint64(n)
 
-	add := func(buf []byte) {
-		e.normal = appendto(e.normal, buf)
+	// Hold back any incomplete UTF-8 rune at the end of buf until
+	// the rest of it is written.
+	if len(e.utfPartial) > 0 {
+		buf = append(e.utfPartial, buf...)
+		e.utfPartial = nil
 	}
-	if e.inalt {
-		add = func(buf []byte) {
-			e.alt = appendto(e.alt, buf)
+	if x := incompleteRune(buf); x > 0 {
+		e.utfPartial = append([]byte{}, buf[len(buf)-x:]...)
+		buf = buf[:len(buf)-x]
+	}
+	e.write(buf)
+	return n, nil
+}
+
+// incompleteRune returns the number of bytes at the end of buf that are the
+// start of a UTF-8 encoded rune that is not yet complete.
+func incompleteRune(buf []byte) int {
+	for i := 1; i < utf8.UTFMax && i <= len(buf); i++ {
+		c := buf[len(buf)-i]
+		if c < utf8.RuneSelf {
+			return 0
+		}
+		if utf8.RuneStart(c) {
+			if utf8.FullRune(buf[len(buf)-i:]) {
+				return 0
+			}
+			return i
 		}
 	}
+	return 0
+}
+
+func (e *EscapeBuffer) write(buf []byte) (int, error) {
+	n := len(buf)
+	add := e.add
 
 	if e.firstBytes == "" {
 		add(buf)
@@ -164,7 +852,7 @@ func (e *EscapeBuffer) Write(buf []byte) (int, error) {
 		ep := e.partial[:pl+i]
 		tlog("partial[%d:%d] write: %q, leaving %q", len(e.partial), cap(e.partial), ep, buf)
 		e.partial = nil
-		e.Write(ep)
+		e.write(ep)
 	}
 
 	// If e.partial is still not empty then we can't know if
@@ -182,14 +870,24 @@ Loop:
 			// there is a bug here if the terminating
 			// sequence is more than one byte.
 			x := bytes.Index(buf, e.inseq.term)
+			if x < 0 && len(e.inseq.seen)+len(buf) > e.MaxPartialBytes {
+				// Give up on the sequence and keep
+				// what we have seen as is.
+				add(e.inseq.seq)
+				add(e.inseq.seen)
+				e.inseq = nil
+				continue
+			}
 			if x < 0 {
 				e.inseq.seen = append(e.inseq.seen, buf...)
 				return n, nil
 			}
 			e.inseq.seen = append(e.inseq.seen, buf[:x]...)
-			x += len(e.inseq.term)
+			buf = buf[x+len(e.inseq.term):]
 			if e.inseq.callback(e, e.inseq.seen) {
+				add(e.inseq.seq)
 				add(e.inseq.seen)
+				add(e.inseq.term)
 			}
 			e.inseq = nil
 		}
@@ -213,6 +911,7 @@ Loop:
 						add(s.seq)
 					}
 					buf = buf[len(s.seq):]
+					e.metrics.SequencesMatched++
 					continue Loop
 				}
 				continue
@@ -226,11 +925,21 @@ Loop:
 				}
 			}
 		}
+		switch seqlen := e.matchPassthrough(buf); {
+		case seqlen > 0:
+			buf = buf[seqlen:]
+			e.metrics.SequencesMatched++
+			continue Loop
+		case seqlen < 0 && len(buf) < e.MaxPartialBytes:
+			// We don't know how long the sequence is.
+			maxPartial = e.MaxPartialBytes
+		}
 		// If we got a partial match then we will have to save
 		// this buffer for the next call to write.
-		if maxPartial > 0 {
+		if maxPartial > 0 && maxPartial <= e.MaxPartialBytes {
 			e.partial = make([]byte, len(buf), maxPartial)
 			copy(e.partial, buf)
+			e.metrics.PartialWaits++
 			return n, nil
 		}
 		add(buf[:1])
@@ -238,22 +947,25 @@ Loop:
 	}
 }
 
-func (e *EscapeBuffer) sendEscapes(w io.Writer, alt bool) {
-	var buf []byte
+// sendEscapes writes the distinct escape sequences found in the normal, or if
+// alt is set the alternate, screen buffer to w.  If describe is set each known
+// sequence is followed by its description from the ECMA-48 standard.
+func (e *EscapeBuffer) sendEscapes(w io.Writer, alt, describe bool) {
+	snap := e.Snapshot()
+	buf := snap.Normal
 	if alt {
-		buf = e.alt
-	} else {
-		buf = e.normal
-	}
-	r := ansi.NewReader(bytes.NewBuffer(buf))
-	ch := make(chan ansi.S)
-	go func() {
-		r.Send(ch)
-		close(ch)
-	}()
+		buf = snap.Alt
+	}
+	r := ansi.NewReaderSize(bytes.NewReader(buf), 64*1024)
 	seen := map[string]bool{}
-	for s := range ch {
-		seen[string(s.Code)] = true
+	for {
+		ss, err := r.NextN(256)
+		for _, s := range ss {
+			seen[string(s.Code)] = true
+		}
+		if err != nil {
+			break
+		}
 	}
 	codes := make([]string, 0, len(seen))
 	for code := range seen {
@@ -274,6 +986,9 @@ func (e *EscapeBuffer) sendEscapes(w io.Writer, alt bool) {
 		seq := ansi.Table[ansi.Name(code)]
 		if seq != nil {
 			fmt.Fprintf(w, "Code: %-*q %s\r\n", maxlen, code, seq.Name)
+			if desc := ansi.Describe(ansi.Name(seq.Name)); describe && desc != "" {
+				fmt.Fprintf(w, "      %s\r\n", desc)
+			}
 		} else {
 			fmt.Fprintf(w, "Code: %q\r\n", code)
 		}
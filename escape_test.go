@@ -14,7 +14,14 @@
 
 package main
 
-import "testing"
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+)
 
 func TestEscapeBuffer(t *testing.T) {
 	for _, tt := range []struct {
@@ -86,7 +93,7 @@ func TestEscapeBuffer(t *testing.T) {
 		if tt.size == 0 {
 			tt.size = 64
 		}
-		e := NewEscapeBuffer(tt.size)
+		e := NewEscapeBuffer(EscapeBufferOptions{MaxBytes: tt.size})
 		count := 0
 		for _, seq := range tt.seqs {
 			e.AddSequence(seq, func(e *EscapeBuffer) bool {
@@ -112,3 +119,454 @@ func TestEscapeBuffer(t *testing.T) {
 		})
 	}
 }
+
+func TestEscapeBufferEviction(t *testing.T) {
+	const max = 64
+	e := NewEscapeBuffer(EscapeBufferOptions{MaxBytes: max})
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(e, "line %d\n", i)
+		if n := e.Len(); n > max {
+			t.Fatalf("line %d: Len is %d, want no more than %d", i, n, max)
+		}
+		if !bytes.HasPrefix(e.normal, []byte("line ")) {
+			t.Fatalf("line %d: buffer does not start on a line: %q", i, e.normal)
+		}
+	}
+	if !bytes.HasSuffix(e.normal, []byte("line 99\n")) {
+		t.Errorf("buffer does not end with the last line: %q", e.normal)
+	}
+}
+
+func TestEscapeBufferVT52(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{VT52: true})
+	const data = "a\033Hb\033Y  c\033<"
+	e.Write([]byte(data))
+	if got := string(e.normal); got != data {
+		t.Errorf("got %q, want %q", got, data)
+	}
+	if got := e.Metrics().SequencesMatched; got != 3 {
+		t.Errorf("matched %d sequences, want 3", got)
+	}
+}
+
+func TestEscapeBufferSnapshot(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	e.AddSequence(scasb, func(e *EscapeBuffer) bool {
+		e.inalt = true
+		return false
+	})
+	e.AddSequence(nsbrc, func(e *EscapeBuffer) bool {
+		e.inalt = false
+		return false
+	})
+
+	// Each write adds one A to the alternate buffer and one N to the
+	// normal buffer, leaving us in the normal buffer.
+	const count = 1000
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			e.Write([]byte(scasb + "A" + nsbrc + "N"))
+		}
+	}()
+	for i := 0; i < count; i++ {
+		snap := e.Snapshot()
+		if snap.InAlt {
+			t.Fatalf("snapshot in alternate buffer")
+		}
+		a := bytes.Count(snap.Alt, []byte("A"))
+		n := bytes.Count(snap.Normal, []byte("N"))
+		if a != n {
+			t.Fatalf("snapshot has %d As and %d Ns", a, n)
+		}
+		if !bytes.Equal(snap.Bytes(), snap.Normal) {
+			t.Fatalf("snapshot Bytes did not return the normal buffer")
+		}
+	}
+	wg.Wait()
+}
+
+func TestEscapeBufferWriteTo(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{MaxBytes: 128 * 1024})
+	line := bytes.Repeat([]byte("x"), 63)
+	for e.Len() < 64*1024 {
+		e.Write(append(line, '\n'))
+	}
+
+	var buf bytes.Buffer
+	if _, err := e.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), e.normal) {
+		t.Errorf("WriteTo did not write the normal buffer")
+	}
+
+	writeTo := testing.AllocsPerRun(100, func() {
+		e.WriteTo(ioutil.Discard)
+	})
+	copied := testing.AllocsPerRun(100, func() {
+		e.Snapshot().WriteTo(ioutil.Discard)
+	})
+	if writeTo >= copied {
+		t.Errorf("WriteTo made %v allocations, copying made %v", writeTo, copied)
+	}
+}
+
+func TestEscapeBufferInject(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	e.Write([]byte("hello\033[5;10Hworld"))
+	e.InjectPrefix([]byte(home + edall))
+	e.InjectSuffix([]byte("\033[5;10H"))
+
+	var buf bytes.Buffer
+	e.WriteTo(&buf)
+	if got, want := buf.String(), home+edall+"hello\033[5;10Hworld\033[5;10H"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if bytes.Contains(e.normal, []byte(edall)) {
+		t.Errorf("injected prefix stored in the buffer: %q", e.normal)
+	}
+
+	// The injected sequences are only written once.
+	buf.Reset()
+	e.WriteTo(&buf)
+	if got, want := buf.String(), "hello\033[5;10Hworld"; got != want {
+		t.Errorf("second WriteTo got %q, want %q", got, want)
+	}
+
+	if row, col, ok := e.Cursor(); !ok || row != 5 || col != 15 {
+		t.Errorf("Cursor returned %d, %d, %v, want 5, 15, true", row, col, ok)
+	}
+}
+
+func TestEscapeBufferReplayAfter(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	e.Write([]byte("hello"))
+	e.InjectSuffix([]byte("!"))
+
+	var buf bytes.Buffer
+	e.ReplayAfter(&buf, []byte(home+edall))
+	if got, want := buf.String(), home+edall+"hello!"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	buf.Reset()
+	e.Replay(&buf)
+	if got, want := buf.String(), "hello"; got != want {
+		t.Errorf("Replay got %q, want %q", got, want)
+	}
+}
+
+func TestEscapeBufferRestoreAfter(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	e.Write([]byte("hello"))
+
+	// The cursor position is not known.
+	var buf bytes.Buffer
+	e.RestoreAfter(&buf, []byte(home+edall))
+	if got, want := buf.String(), home+edall+"hello"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	e.Write([]byte("\033[5;1Hworld"))
+	buf.Reset()
+	e.RestoreAfter(&buf, []byte(home+edall))
+	if got, want := buf.String(), home+edall+"hello\033[5;1Hworld\033[5;6H"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTrackCursor(t *testing.T) {
+	for _, tt := range []struct {
+		in       string
+		row, col int
+		ok       bool
+	}{
+		{in: "no sequence"},
+		{in: "\033[2J"},
+		{in: "\033[H", row: 1, col: 1, ok: true},
+		{in: "\033[12;40H", row: 12, col: 40, ok: true},
+		{in: "\033[7f", row: 7, col: 1, ok: true},
+		{in: "\033[;3H", row: 1, col: 3, ok: true},
+		{in: "\033[1;2Hx\033[3;4Hy\033[K", row: 3, col: 5, ok: true},
+		{in: "\033[1;2;3H"},
+		{in: "\033[5;10H\033[2A", row: 3, col: 10, ok: true},
+		{in: "\033[5;10H\033[B\033[3C", row: 6, col: 13, ok: true},
+		{in: "\033[5;10H\033[20D\033[9A", row: 1, col: 1, ok: true},
+		{in: "\033[5;10H\r\n\n", row: 7, col: 1, ok: true},
+		{in: "\033[5;10H\033[?25h\033[A", row: 4, col: 10, ok: true},
+		{in: "\033[5;10H\033[\n", row: 6, col: 10, ok: true},
+		{in: "\033[5;10Hhello", row: 5, col: 15, ok: true},
+		{in: "\033[5;10H\u00e9t\u00e9", row: 5, col: 13, ok: true},
+		{in: "\033[5;10Hab\b\b\bc", row: 5, col: 10, ok: true},
+		{in: "\033[5;10H\t", row: 5, col: 17, ok: true},
+		{in: "\033[5;10H\033]0;title\a\033]7;dir\033\\x", row: 5, col: 11, ok: true},
+		{in: "\033[5;10H\033(Bx", row: 5, col: 11, ok: true},
+		{in: "\033[5;10H\0337\033[1;1Hx\0338", row: 5, col: 10, ok: true},
+		{in: "\033[5;10H\033[s\033[1;1Hx\033[u", row: 5, col: 10, ok: true},
+		{in: "\033[5;10H\033[3G\033[2d", row: 2, col: 3, ok: true},
+		{in: "\033[5;10H\033[2E", row: 7, col: 1, ok: true},
+		{in: "\033[5;10H\033M\033E", row: 5, col: 1, ok: true},
+	} {
+		e := NewEscapeBuffer(EscapeBufferOptions{})
+		e.Write([]byte(tt.in))
+		row, col, ok := e.Cursor()
+		if row != tt.row && tt.ok || col != tt.col && tt.ok || ok != tt.ok {
+			t.Errorf("%q: got %d, %d, %v, want %d, %d, %v", tt.in, row, col, ok, tt.row, tt.col, tt.ok)
+		}
+	}
+}
+
+func TestTrackCursorSize(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	e.SetSize(24, 10)
+	e.Write([]byte("\033[23;1H0123456789"))
+	// The cursor stays in the last column until the next character.
+	if row, col, ok := e.Cursor(); !ok || row != 23 || col != 10 {
+		t.Errorf("got %d, %d, %v, want 23, 10, true", row, col, ok)
+	}
+	e.Write([]byte("abc"))
+	if row, col, ok := e.Cursor(); !ok || row != 24 || col != 4 {
+		t.Errorf("after wrapping got %d, %d, %v, want 24, 4, true", row, col, ok)
+	}
+	// The screen scrolls at the last row.
+	e.Write([]byte("\r\n\n\033[20C"))
+	if row, col, ok := e.Cursor(); !ok || row != 24 || col != 10 {
+		t.Errorf("after scrolling got %d, %d, %v, want 24, 10, true", row, col, ok)
+	}
+}
+
+func TestSetCursorPosition(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	e.SetCursorPosition(5, 10)
+	if row, col, ok := e.Cursor(); !ok || row != 5 || col != 10 {
+		t.Errorf("got %d, %d, %v, want 5, 10, true", row, col, ok)
+	}
+	e.Write([]byte("\033[2B\r"))
+	if row, col, ok := e.Cursor(); !ok || row != 7 || col != 1 {
+		t.Errorf("after moving got %d, %d, %v, want 7, 1, true", row, col, ok)
+	}
+
+	// A sequence split across writes.
+	e.Write([]byte("\033"))
+	e.Write([]byte("[3;"))
+	e.Write([]byte("4H"))
+	if row, col, ok := e.Cursor(); !ok || row != 3 || col != 4 {
+		t.Errorf("after split sequence got %d, %d, %v, want 3, 4, true", row, col, ok)
+	}
+
+	// A string split across writes.
+	e.Write([]byte("\033]0;a long title"))
+	e.Write([]byte(" that is written in two parts\033"))
+	e.Write([]byte("\\x"))
+	if row, col, ok := e.Cursor(); !ok || row != 3 || col != 5 {
+		t.Errorf("after split string got %d, %d, %v, want 3, 5, true", row, col, ok)
+	}
+}
+
+func TestEscapeBufferMetrics(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{MaxBytes: 16})
+	e.AddSequence("\033[?1049h", func(*EscapeBuffer) bool { return true })
+
+	// The trailing bytes are a prefix of the sequence.
+	e.Write([]byte("abc\033[?10"))
+	m := e.Metrics()
+	if m.PartialWaits != 1 {
+		t.Errorf("PartialWaits got %d, want 1", m.PartialWaits)
+	}
+	if m.SequencesMatched != 0 {
+		t.Errorf("SequencesMatched got %d, want 0", m.SequencesMatched)
+	}
+
+	e.Write([]byte("49hdef\n0123456789\n"))
+	m = e.Metrics()
+	want := EscapeBufferMetrics{
+		SequencesMatched: 1,
+		BytesProcessed:   26,
+		PartialWaits:     1,
+		BytesDropped:     11,
+	}
+	if m != want {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+}
+
+func TestEscapeBufferUTF8(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{
+			name:   "whole",
+			writes: []string{"a世b"},
+			want:   "a世b",
+		},
+		{
+			name:   "split1",
+			writes: []string{"a\xe4", "\xb8\x96b"},
+			want:   "a世b",
+		},
+		{
+			name:   "split2",
+			writes: []string{"a\xe4\xb8", "\x96b"},
+			want:   "a世b",
+		},
+		{
+			name:   "bytewise",
+			writes: []string{"a", "\xe4", "\xb8", "\x96", "b"},
+			want:   "a世b",
+		},
+		{
+			name:   "held",
+			writes: []string{"a\xe4\xb8"},
+			want:   "a",
+		},
+		{
+			name:   "invalid",
+			writes: []string{"a\xb8\x96b"},
+			want:   "a\xb8\x96b",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEscapeBuffer(EscapeBufferOptions{})
+			for _, w := range tt.writes {
+				e.Write([]byte(w))
+			}
+			if got := string(e.normal); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeBufferMaxPartial(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	if err := e.AddSequence(strings.Repeat("x", maxSequenceLength+1), passthrough); err == nil {
+		t.Errorf("AddSequence accepted a %d byte sequence", maxSequenceLength+1)
+	}
+
+	// A prefix of a sequence longer than MaxPartialBytes is not held.
+	e.MaxPartialBytes = 8
+	long := "\033P" + strings.Repeat("q", 198)
+	if err := e.AddSequence(long, passthrough); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []byte(long[:100]) {
+		e.Write([]byte{c})
+		if len(e.partial) > e.MaxPartialBytes {
+			t.Fatalf("holding %d bytes, limit is %d", len(e.partial), e.MaxPartialBytes)
+		}
+	}
+	if got := string(e.Snapshot().Normal); got != long[:100] {
+		t.Errorf("got %q, want %q", got, long[:100])
+	}
+
+	// An unterminated report sequence is given up on at the limit.
+	e = NewEscapeBuffer(EscapeBufferOptions{})
+	called := false
+	e.AddReportSequence("\033]X", "\007", func(*EscapeBuffer, []byte) bool {
+		called = true
+		return true
+	})
+	chunk := []byte(strings.Repeat("r", 100))
+	for i := 0; i < 1000; i++ {
+		if i == 0 {
+			e.Write([]byte("\033]X"))
+		}
+		e.Write(chunk)
+		if e.inseq != nil && len(e.inseq.seen) > e.MaxPartialBytes {
+			t.Fatalf("holding %d bytes, limit is %d", len(e.inseq.seen), e.MaxPartialBytes)
+		}
+	}
+	e.Write([]byte("\007"))
+	if called {
+		t.Errorf("callback called for an abandoned sequence")
+	}
+	if got, want := e.Len(), 3+100*1000+1; got != want {
+		t.Errorf("buffer has %d bytes, want %d", got, want)
+	}
+}
+
+func TestSendEscapesDescribe(t *testing.T) {
+	e := NewEscapeBuffer(EscapeBufferOptions{})
+	e.Write([]byte("a\033[2;3Hb"))
+
+	var buf bytes.Buffer
+	e.sendEscapes(&buf, false, false)
+	if !strings.Contains(buf.String(), "CUP") {
+		t.Errorf("escapes %q do not include CUP", buf.String())
+	}
+	if strings.Contains(buf.String(), "Cursor Position") {
+		t.Errorf("escapes %q include a description", buf.String())
+	}
+
+	buf.Reset()
+	e.sendEscapes(&buf, false, true)
+	if !strings.Contains(buf.String(), "Cursor Position: ") {
+		t.Errorf("escapes %q do not describe CUP", buf.String())
+	}
+}
+
+func TestEscapeBufferPassthrough(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		writes []string
+		want   string
+		alt    string
+	}{
+		{"decset", []string{"a\033[?25lb\033[?2004hc"}, "abc", ""},
+		{"split", []string{"a\033[", "?2", "5", "lb"}, "ab", ""},
+		{"explicit", []string{"a" + scasb + "b" + nsbrc + "c"}, "ac", "b"},
+		{"other csi", []string{"a\033[1mb"}, "a\033[1mb", ""},
+		{"osc bel", []string{"a\033]0;title\007b"}, "ab", ""},
+		{"osc st", []string{"a\033]0;ti", "tle\033", "\\b"}, "ab", ""},
+		{"invalid", []string{"a\033[?\001b"}, "a\033[?\001b", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEscapeBuffer(EscapeBufferOptions{})
+			e.AddSequence(scasb, func(e *EscapeBuffer) bool {
+				e.inalt = true
+				return false
+			})
+			e.AddSequence(nsbrc, func(e *EscapeBuffer) bool {
+				e.inalt = false
+				return false
+			})
+			e.AddPassthroughPrefix("\033[?")
+			e.AddPassthroughPrefix("\033]0;")
+			for _, w := range tt.writes {
+				e.Write([]byte(w))
+			}
+			if got := string(e.normal); got != tt.want {
+				t.Errorf("normal buffer got %q, want %q", got, tt.want)
+			}
+			if got := string(e.alt); got != tt.alt {
+				t.Errorf("alternate buffer got %q, want %q", got, tt.alt)
+			}
+		})
+	}
+}
+
+func TestEscapeBufferReportSequence(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		e := NewEscapeBuffer(EscapeBufferOptions{})
+		var got string
+		e.AddReportSequence("\033]X", "\007", func(_ *EscapeBuffer, data []byte) bool {
+			got = string(data)
+			return keep
+		})
+		e.Write([]byte("a\033]Xhello\007b"))
+		if got != "hello" {
+			t.Errorf("callback got %q, want \"hello\"", got)
+		}
+		want := "ab"
+		if keep {
+			want = "a\033]Xhello\007b"
+		}
+		if string(e.normal) != want {
+			t.Errorf("keep %v: got %q, want %q", keep, e.normal, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFiles are the files in a session's directory included by Export.
+var exportFiles = []string{"pid", "addr", "title", "ttysize", "auth"}
+
+// importFiles are the files restored by ImportSession.  The pid and addr
+// files describe the server of the exported session and are not restored.
+var importFiles = map[string]bool{
+	"title":   true,
+	"ttysize": true,
+	"auth":    true,
+	"screen":  true,
+}
+
+const (
+	metadataFile = "session.json" // name of the metadata in an export
+	screenFile   = "screen"       // name of the screen buffer in an export
+)
+
+// A sessionMetadata describes an exported session.
+type sessionMetadata struct {
+	Name      string
+	Namespace string
+	Created   time.Time
+	Clients   int // as of the last call to Check
+}
+
+// sessionScreen returns the screen buffer of a running session.
+var sessionScreen = (*Session).screen // so tests can change it
+
+// screen asks the server of s to save its screen buffer and returns it.
+func (s *Session) screen() ([]byte, error) {
+	f, err := ioutil.TempFile("", "pty-screen")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	msg, err := s.Request(saveMessage, serverMessage, []byte(f.Name()))
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(msg, "ERROR") {
+		return nil, errors.New(strings.TrimSpace(msg))
+	}
+	return ioutil.ReadFile(f.Name())
+}
+
+// Export writes s to w as a gzipped tar archive.  The archive contains the
+// session's files, the screen buffer if the session is running, and the
+// metadata of the session.  ImportSession reads the archive.
+func (s *Session) Export(w io.Writer) error {
+	var screen []byte
+	if s.Ping() {
+		var err error
+		if screen, err = sessionScreen(s); err != nil {
+			return fmt.Errorf("saving screen: %v", err)
+		}
+	}
+	meta, err := json.MarshalIndent(sessionMetadata{
+		Name:      s.Name,
+		Namespace: s.Namespace,
+		Created:   s.CreatedAt(),
+		Clients:   s.cnt,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0600,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(metadataFile, meta); err != nil {
+		return err
+	}
+	for _, name := range exportFiles {
+		data, err := s.readfile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := add(name, []byte(data)); err != nil {
+			return err
+		}
+	}
+	if screen != nil {
+		if err := add(screenFile, screen); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// ImportSession reads an archive written by Export from r and creates a
+// session, in the current namespace, from it.  It is an error if the session
+// is already running.  The exported screen buffer is replayed when the
+// session's server starts.
+func ImportSession(r io.Reader) (*Session, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	var meta *sessionMetadata
+	files := map[string][]byte{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Name != metadataFile && !importFiles[h.Name] {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		if h.Name == metadataFile {
+			meta = &sessionMetadata{}
+			if err := json.Unmarshal(data, meta); err != nil {
+				return nil, fmt.Errorf("%s: %v", metadataFile, err)
+			}
+			continue
+		}
+		files[h.Name] = data
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("archive has no %s", metadataFile)
+	}
+	if !ValidSessionName(meta.Name) {
+		return nil, fmt.Errorf("invalid session name %q", meta.Name)
+	}
+
+	s, err := MakeSession(namespace, meta.Name, "")
+	if err != nil {
+		return nil, err
+	}
+	if s.Check() {
+		return nil, fmt.Errorf("session %s already exists", meta.Name)
+	}
+	for name, data := range files {
+		if err := s.writefile(name, string(data)); err != nil {
+			return nil, err
+		}
+	}
+	if !meta.Created.IsZero() {
+		if err := s.writefile("created_at", strconv.FormatInt(meta.Created.Unix(), 10)); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,170 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(user.HomeDir, rcdir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer func(f func(*Session) ([]byte, error)) { sessionScreen = f }(sessionScreen)
+	sessionScreen = func(*Session) ([]byte, error) {
+		return []byte("$ echo hi\r\nhi\r\n"), nil
+	}
+
+	created := time.Unix(1700000000, 0)
+	s, err := MakeSession("", "work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.cnt = 2
+	for name, data := range map[string]string{
+		"created_at": strconv.FormatInt(created.Unix(), 10),
+		"title":      "my title",
+		"ttysize":    "24 80",
+		"pid":        strconv.Itoa(os.Getpid()), // so the session looks alive
+		"addr":       "127.0.0.1:1",
+	} {
+		if err := s.writefile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	if err := s.Export(&archive); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check the metadata in the archive.
+	zr, err := gzip.NewReader(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	names := map[string]bool{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names[h.Name] = true
+		if h.Name != metadataFile {
+			continue
+		}
+		data, _ := ioutil.ReadAll(tr)
+		var meta sessionMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			t.Fatal(err)
+		}
+		want := sessionMetadata{Name: "work", Created: created, Clients: 2}
+		if meta.Name != want.Name || meta.Namespace != want.Namespace || !meta.Created.Equal(want.Created) || meta.Clients != want.Clients {
+			t.Errorf("got metadata %+v, want %+v", meta, want)
+		}
+	}
+	for _, name := range []string{metadataFile, "pid", "addr", "title", "ttysize", screenFile} {
+		if !names[name] {
+			t.Errorf("archive is missing %s", name)
+		}
+	}
+
+	// Import the session into a different namespace.
+	defer func(ns string) { namespace = ns }(namespace)
+	namespace = "moved"
+	is, err := ImportSession(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.Name != "work" || is.Namespace != "moved" {
+		t.Errorf("imported session %s in namespace %q, want work in moved", is.Name, is.Namespace)
+	}
+	if is.path == s.path {
+		t.Errorf("imported session uses the exported directory %s", is.path)
+	}
+	if got := is.Title(); got != "my title" {
+		t.Errorf("got title %q, want \"my title\"", got)
+	}
+	if got := is.TTYSize(); got != "24 80" {
+		t.Errorf("got size %q, want \"24 80\"", got)
+	}
+	if got := is.CreatedAt(); !got.Equal(created) {
+		t.Errorf("got created %v, want %v", got, created)
+	}
+	if _, ok := is.Pid(); ok {
+		t.Errorf("imported session has a pid")
+	}
+	if is.Addr() != "" {
+		t.Errorf("imported session has an address")
+	}
+
+	// The server replays the exported screen.
+	shell := newSessionShell(is)
+	if got, want := string(shell.eb.Snapshot().Bytes()), "$ echo hi\r\nhi\r\n"; got != want {
+		t.Errorf("got screen %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(is.path, screenFile)); !os.IsNotExist(err) {
+		t.Errorf("screen file was not removed: %v", err)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(user.HomeDir, rcdir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	archive := func(meta string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(zw)
+		if meta != "" {
+			tw.WriteHeader(&tar.Header{Name: metadataFile, Mode: 0600, Size: int64(len(meta))})
+			tw.Write([]byte(meta))
+		}
+		tw.Close()
+		zw.Close()
+		return &buf
+	}
+	for _, tt := range []struct {
+		name string
+		in   io.Reader
+	}{
+		{"not gzip", bytes.NewBufferString("not an archive")},
+		{"no metadata", archive("")},
+		{"bad metadata", archive("{")},
+		{"bad name", archive(`{"Name": "../x"}`)},
+	} {
+		if s, err := ImportSession(tt.in); err == nil {
+			t.Errorf("%s: imported session %s", tt.name, s.Name)
+		}
+	}
+}
@@ -15,19 +15,47 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/pborman/pty/log"
 	"github.com/pborman/pty/mutex"
 )
 
+// A ForwarderStatus is the state of a forwarder.
+type ForwarderStatus int
+
+const (
+	ForwarderIdle   ForwarderStatus = iota // no socket has been forwarded
+	ForwarderActive                        // connections are forwarded
+	ForwarderDead                          // the forwarded socket is gone
+)
+
+var forwarderStatusNames = map[ForwarderStatus]string{
+	ForwarderIdle:   "idle",
+	ForwarderActive: "active",
+	ForwarderDead:   "dead",
+}
+
+func (s ForwarderStatus) String() string {
+	if name, ok := forwarderStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("status-%d", s)
+}
+
 type forwarder struct {
 	lconn  net.Listener
 	mu     *mutex.Mutex
 	remote *Session
+	socket string // the forwarded socket
+	status ForwarderStatus
+	conns  map[net.Conn]struct{} // open forwarded connections
 }
 
 var (
@@ -35,6 +63,10 @@ var (
 	forwarders   = map[string]*forwarder{}
 )
 
+// forwardWatchInterval is how often Watch checks that the forwarded socket
+// still exists.
+var forwardWatchInterval = 5 * time.Second // so tests can change it
+
 func SetForwarder(name, remote string) error {
 	forwardersMu.Lock()
 	f := forwarders[name]
@@ -42,13 +74,98 @@ func SetForwarder(name, remote string) error {
 	if f == nil {
 		return fmt.Errorf("no such socket: %s", name)
 	}
-	defer f.mu.Lock("SetForwarder")()
-	f.remote = MakeSession(remote, "")
+	f.forward(remote)
 	return nil
 }
 
+// forward forwards future connections to f to socket.  A dead forwarder is
+// restarted.
+func (f *forwarder) forward(socket string) {
+	defer f.mu.Lock("forward")()
+	if f.status == ForwarderDead {
+		log.Infof("restarting forwarder to %s", socket)
+	}
+	remote, err := MakeSession(namespace, socket, "")
+	if err != nil {
+		log.Errorf("forwarding to %s: %v", socket, err)
+		return
+	}
+	f.remote = remote
+	f.socket = socket
+	f.status = ForwarderActive
+}
+
+// Status returns the status of f.
+func (f *forwarder) Status() ForwarderStatus {
+	defer f.mu.Lock("Status")()
+	return f.status
+}
+
+// Watch checks that the socket forwarded by f exists every
+// forwardWatchInterval until ctx is done.  When the socket disappears all
+// forwarded connections are closed and f is marked dead until a new socket
+// is forwarded.
+func (f *forwarder) Watch(ctx context.Context) {
+	tick := time.NewTicker(forwardWatchInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		f.check()
+	}
+}
+
+// check marks f dead and closes its connections if the forwarded socket no
+// longer exists.
+func (f *forwarder) check() {
+	unlock := f.mu.Lock("check")
+	socket, status := f.socket, f.status
+	unlock()
+	if status != ForwarderActive {
+		return
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		return
+	}
+	unlock = f.mu.Lock("check")
+	if f.socket != socket {
+		// A new socket was forwarded while we were looking.
+		unlock()
+		return
+	}
+	log.Warnf("forwarded socket %s is gone", socket)
+	f.status = ForwarderDead
+	conns := f.conns
+	f.conns = map[net.Conn]struct{}{}
+	unlock()
+	for c := range conns {
+		checkClose(c)
+	}
+}
+
+// track adds c to, or removes c from, the open connections of f.  Tracking a
+// connection on a dead forwarder fails.
+func (f *forwarder) track(c net.Conn, add bool) bool {
+	defer f.mu.Lock("track")()
+	if !add {
+		delete(f.conns, c)
+		return true
+	}
+	if f.status == ForwarderDead {
+		return false
+	}
+	f.conns[c] = struct{}{}
+	return true
+}
+
 func NewForwarder(name, socket string) error {
-	s := MakeSession(socket, "")
+	s, err := MakeSession(namespace, socket, "")
+	if err != nil {
+		return err
+	}
 	s.Remove()
 	conn, err := s.Listen()
 	if err != nil {
@@ -57,11 +174,13 @@ func NewForwarder(name, socket string) error {
 	f := &forwarder{
 		mu:    mutex.New("Forwarder: " + name),
 		lconn: conn,
+		conns: map[net.Conn]struct{}{},
 	}
 	forwardersMu.Lock()
 	forwarders[name] = f
 	forwardersMu.Unlock()
 	go f.server()
+	go f.Watch(context.Background())
 	return nil
 }
 
@@ -74,11 +193,19 @@ func (f *forwarder) server() {
 			return
 		}
 		go func() {
+			defer checkClose(c)
+			if !f.track(c, true) {
+				log.Warnf("forwarder is dead, refusing connection")
+				return
+			}
+			defer f.track(c, false)
 			unlock := f.mu.Lock("server")
 			remote := f.remote
 			unlock()
+			if remote == nil {
+				return
+			}
 			f.session(c, remote)
-			checkClose(c)
 		}()
 	}
 }
@@ -88,6 +215,11 @@ func (f *forwarder) session(c net.Conn, s *Session) error {
 	if err != nil {
 		return err
 	}
+	if !f.track(rc, true) {
+		checkClose(rc)
+		return fmt.Errorf("forwarder is dead")
+	}
+	defer f.track(rc, false)
 
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -0,0 +1,81 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pborman/pty/mutex"
+)
+
+func TestForwarderWatch(t *testing.T) {
+	defer func(d time.Duration) { forwardWatchInterval = d }(forwardWatchInterval)
+	forwardWatchInterval = 10 * time.Millisecond
+
+	socket := filepath.Join(t.TempDir(), "agent")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	f := &forwarder{
+		mu:    mutex.New("test forwarder"),
+		conns: map[net.Conn]struct{}{},
+	}
+	if s := f.Status(); s != ForwarderIdle {
+		t.Errorf("new forwarder is %v, want idle", s)
+	}
+	f.forward(socket)
+	c, pc := net.Pipe()
+	defer pc.Close()
+	if !f.track(c, true) {
+		t.Fatal("could not track a connection")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.Watch(ctx)
+
+	time.Sleep(5 * forwardWatchInterval)
+	if s := f.Status(); s != ForwarderActive {
+		t.Fatalf("forwarder is %v, want active", s)
+	}
+
+	os.Remove(socket)
+	for start := time.Now(); f.Status() != ForwarderDead; time.Sleep(forwardWatchInterval) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("forwarder is %v, want dead", f.Status())
+		}
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := pc.Read(make([]byte, 1)); err == nil || os.IsTimeout(err) {
+		t.Errorf("forwarded connection was not closed: %v", err)
+	}
+	if f.track(c, true) {
+		t.Errorf("dead forwarder accepted a connection")
+	}
+
+	cancel()
+	f.forward(socket + "2")
+	if s := f.Status(); s != ForwarderActive {
+		t.Errorf("forwarder is %v after forwarding a new socket, want active", s)
+	}
+}
@@ -6,11 +6,12 @@ require (
 	github.com/kr/pty v1.1.8
 	github.com/pborman/getopt v1.1.0
 	golang.org/x/crypto v0.8.0
+	golang.org/x/term v0.7.0
+	golang.org/x/time v0.3.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
 	github.com/creack/pty v1.1.7 // indirect
 	golang.org/x/sys v0.7.0 // indirect
-	golang.org/x/term v0.7.0 // indirect
 )
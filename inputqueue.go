@@ -0,0 +1,96 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import "github.com/pborman/pty/mutex"
+
+// defaultInputQueueSize is the default maximum number of bytes held in an
+// inputQueue.
+const defaultInputQueueSize = 1024 * 1024
+
+// An inputQueue holds input from a client that has not yet been written to
+// the shell.  An inputQueue holds at most max bytes.  When full, the oldest
+// bytes are discarded.
+type inputQueue struct {
+	mu     *mutex.Mutex
+	buf    []byte
+	max    int
+	closed bool
+	ready  chan struct{}
+}
+
+func newInputQueue(max int) *inputQueue {
+	if max <= 0 {
+		max = defaultInputQueueSize
+	}
+	return &inputQueue{
+		mu:    mutex.New("inputQueue"),
+		max:   max,
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Write adds buf to the end of q and returns the number of bytes discarded
+// from the front of q to make room.
+func (q *inputQueue) Write(buf []byte) (dropped int) {
+	unlock := q.mu.Lock("Write")
+	q.buf = append(q.buf, buf...)
+	if len(q.buf) > q.max {
+		dropped = len(q.buf) - q.max
+		q.buf = append(q.buf[:0], q.buf[dropped:]...)
+	}
+	unlock()
+	q.signal()
+	return dropped
+}
+
+// Close causes next to return false once q is empty.
+func (q *inputQueue) Close() {
+	unlock := q.mu.Lock("Close")
+	q.closed = true
+	unlock()
+	q.signal()
+}
+
+func (q *inputQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next removes and returns up to n bytes from the front of q, waiting for
+// bytes to be written if q is empty.  It returns false if q is closed and
+// empty.
+func (q *inputQueue) next(n int) ([]byte, bool) {
+	for {
+		unlock := q.mu.Lock("next")
+		if len(q.buf) > 0 {
+			if n > len(q.buf) {
+				n = len(q.buf)
+			}
+			buf := append([]byte{}, q.buf[:n]...)
+			q.buf = q.buf[:copy(q.buf, q.buf[n:])]
+			unlock()
+			return buf, true
+		}
+		closed := q.closed
+		unlock()
+		if closed {
+			return nil, false
+		}
+		<-q.ready
+	}
+}
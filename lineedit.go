@@ -0,0 +1,279 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxHistory is the maximum number of lines kept in the command history.
+const maxHistory = 500
+
+// A lineEditor reads a line from a terminal in raw mode.  It supports moving
+// the cursor with the left and right arrows, recalling earlier lines with the
+// up and down arrows, deleting with backspace and delete, and completing the
+// first word of the line with tab.
+type lineEditor struct {
+	in       io.Reader // read a byte at a time so no input is lost
+	out      io.Writer
+	history  []string
+	histPath string   // file the history is saved in, if not ""
+	words    []string // words completed by tab
+
+	line []rune // line being edited
+	pos  int    // position of the cursor in line
+}
+
+// newLineEditor returns a lineEditor that reads from in and echos to out.
+// The history is read from, and saved to, the file histPath if it is not "".
+func newLineEditor(in io.Reader, out io.Writer, histPath string, words []string) *lineEditor {
+	le := &lineEditor{
+		in:       in,
+		out:      out,
+		histPath: histPath,
+		words:    words,
+	}
+	if histPath != "" {
+		if data, err := ioutil.ReadFile(histPath); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if line != "" {
+					le.history = append(le.history, line)
+				}
+			}
+		}
+		if len(le.history) > maxHistory {
+			le.history = le.history[len(le.history)-maxHistory:]
+			ioutil.WriteFile(histPath, []byte(strings.Join(le.history, "\n")+"\n"), 0600)
+		}
+	}
+	return le
+}
+
+// commandEditor returns the lineEditor used by the command prompt.
+func commandEditor() *lineEditor {
+	words := []string{"help"}
+	for _, c := range commandHelp {
+		words = append(words, c.name)
+	}
+	sort.Strings(words)
+	return newLineEditor(os.Stdin, os.Stdout, filepath.Join(user.HomeDir, rcdir, "history"), words)
+}
+
+// ReadLine displays prompt and returns the line that is entered.  The line is
+// added to the history.  Typing ^C returns an empty line.  io.EOF is returned
+// if ^D is typed on an empty line.
+func (le *lineEditor) ReadLine(prompt string) (string, error) {
+	le.line, le.pos = le.line[:0], 0
+	hist := len(le.history) // index of the history line being displayed
+	fmt.Fprint(le.out, prompt)
+	for {
+		r, err := le.readRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(le.out, "\r\n")
+			line := strings.TrimSpace(string(le.line))
+			le.addHistory(line)
+			return line, nil
+		case 3: // ^C
+			fmt.Fprint(le.out, "^C\r\n")
+			return "", nil
+		case 4: // ^D
+			if len(le.line) == 0 {
+				fmt.Fprint(le.out, "\r\n")
+				return "", io.EOF
+			}
+			le.delete()
+		case 0x7f, '\b':
+			if le.pos > 0 {
+				le.pos--
+				le.delete()
+			}
+		case '\t':
+			le.complete(prompt)
+		case '\033':
+			switch le.escape() {
+			case 'A': // up
+				if hist > 0 {
+					hist--
+					le.setLine(le.history[hist])
+				}
+			case 'B': // down
+				if hist < len(le.history) {
+					hist++
+					if hist == len(le.history) {
+						le.setLine("")
+					} else {
+						le.setLine(le.history[hist])
+					}
+				}
+			case 'C': // right
+				if le.pos < len(le.line) {
+					le.pos++
+				}
+			case 'D': // left
+				if le.pos > 0 {
+					le.pos--
+				}
+			case '~': // delete
+				le.delete()
+			}
+		default:
+			if r < ' ' || r == utf8.RuneError {
+				continue
+			}
+			le.line = append(le.line, 0)
+			copy(le.line[le.pos+1:], le.line[le.pos:])
+			le.line[le.pos] = r
+			le.pos++
+		}
+		le.redraw(prompt)
+	}
+}
+
+// escape reads the remainder of an escape sequence and returns its final
+// byte.  The arrow keys are ESC [ X or ESC O X and delete is ESC [ 3 ~.
+func (le *lineEditor) escape() byte {
+	c, err := le.readByte()
+	if err != nil || (c != '[' && c != 'O') {
+		return 0
+	}
+	for {
+		c, err = le.readByte()
+		if err != nil {
+			return 0
+		}
+		if (c < '0' || c > '9') && c != ';' {
+			return c
+		}
+	}
+}
+
+// readByte reads a single byte from le.in.
+func (le *lineEditor) readByte() (byte, error) {
+	var buf [1]byte
+	for {
+		n, err := le.in.Read(buf[:])
+		if n == 1 {
+			return buf[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readRune reads a single UTF-8 encoded rune from le.in.
+func (le *lineEditor) readRune() (rune, error) {
+	c, err := le.readByte()
+	if err != nil || c < utf8.RuneSelf {
+		return rune(c), err
+	}
+	buf := []byte{c}
+	for !utf8.FullRune(buf) {
+		if c, err = le.readByte(); err != nil {
+			return 0, err
+		}
+		buf = append(buf, c)
+	}
+	r, _ := utf8.DecodeRune(buf)
+	return r, nil
+}
+
+// delete deletes the rune under the cursor.
+func (le *lineEditor) delete() {
+	if le.pos < len(le.line) {
+		le.line = append(le.line[:le.pos], le.line[le.pos+1:]...)
+	}
+}
+
+// setLine replaces the line with line and moves the cursor to the end.
+func (le *lineEditor) setLine(line string) {
+	le.line = append(le.line[:0], []rune(line)...)
+	le.pos = len(le.line)
+}
+
+// redraw redisplays the prompt and line and positions the cursor.
+func (le *lineEditor) redraw(prompt string) {
+	fmt.Fprintf(le.out, "\r%s%s\033[K", prompt, string(le.line))
+	if n := len(le.line) - le.pos; n > 0 {
+		fmt.Fprintf(le.out, "\033[%dD", n)
+	}
+}
+
+// complete completes the first word of the line when the cursor is in it.
+// If there are several possible completions then the word is extended to
+// their common prefix and, if that does not change the word, they are listed.
+func (le *lineEditor) complete(prompt string) {
+	prefix := string(le.line[:le.pos])
+	if strings.ContainsRune(prefix, ' ') {
+		return
+	}
+	var matches []string
+	for _, w := range le.words {
+		if strings.HasPrefix(w, prefix) {
+			matches = append(matches, w)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	if common == prefix {
+		fmt.Fprintf(le.out, "\r\n%s\r\n", strings.Join(matches, "  "))
+		return
+	}
+	rest := []rune(common[len(prefix):])
+	le.line = append(le.line[:le.pos], append(rest, le.line[le.pos:]...)...)
+	le.pos += len(rest)
+}
+
+// addHistory adds line to the history unless it is empty or the same as the
+// last line in the history.  The line is also appended to the history file.
+func (le *lineEditor) addHistory(line string) {
+	if line == "" || (len(le.history) > 0 && le.history[len(le.history)-1] == line) {
+		return
+	}
+	le.history = append(le.history, line)
+	if len(le.history) > maxHistory {
+		le.history = le.history[len(le.history)-maxHistory:]
+	}
+	if le.histPath == "" {
+		return
+	}
+	f, err := os.OpenFile(le.histPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
@@ -0,0 +1,53 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	hist := filepath.Join(t.TempDir(), "history")
+	words := []string{"escapes", "escstats", "help", "title"}
+	le := newLineEditor(strings.NewReader(
+		"ls\r"+ // a command
+			"tx\x7fi\ttab\r"+ // backspace and completion
+			"ac\033[Db\r"+ // left arrow
+			"\033[A\033[A\r"+ // history
+			"esc\t\r", // ambiguous completion
+	), ioutil.Discard, hist, words)
+	for _, want := range []string{"ls", "title tab", "abc", "title tab", "esc"} {
+		got, err := le.ReadLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	// The history is saved across editors.
+	le = newLineEditor(strings.NewReader("\033[A\r"), ioutil.Discard, hist, words)
+	got, err := le.ReadLine("> ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "esc"; got != want {
+		t.Errorf("got %q from history, want %q", got, want)
+	}
+}
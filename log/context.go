@@ -0,0 +1,77 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx that carries the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a new random request ID formatted like a UUID.
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// outputCtx is Outputf with the message prefixed by the request ID in ctx,
+// if any.
+func (l *Logger) outputCtx(ctx context.Context, depth int, prefix, format string, v ...interface{}) {
+	id := RequestID(ctx)
+	if id == "" {
+		l.Outputf(depth+1, prefix, format, v...)
+		return
+	}
+	l.Outputf(depth+1, prefix, "[%s] %s", id, fmt.Sprintf(format, v...))
+}
+
+func ErrorfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.outputCtx(ctx, 1, "E", format, v...)
+}
+func WarnfCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.outputCtx(ctx, 1, "W", format, v...)
+}
+func InfofCtx(ctx context.Context, format string, v ...interface{}) {
+	logger.outputCtx(ctx, 1, "I", format, v...)
+}
+
+func (l *Logger) ErrorfCtx(ctx context.Context, format string, v ...interface{}) {
+	l.outputCtx(ctx, 1, "E", format, v...)
+}
+func (l *Logger) WarnfCtx(ctx context.Context, format string, v ...interface{}) {
+	l.outputCtx(ctx, 1, "W", format, v...)
+}
+func (l *Logger) InfofCtx(ctx context.Context, format string, v ...interface{}) {
+	l.outputCtx(ctx, 1, "I", format, v...)
+}
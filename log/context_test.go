@@ -0,0 +1,97 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	ctx := context.Background()
+	if id := RequestID(ctx); id != "" {
+		t.Errorf("RequestID of Background got %q", id)
+	}
+	if id := RequestID(WithRequestID(ctx, "abc")); id != "abc" {
+		t.Errorf("RequestID got %q, want abc", id)
+	}
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := NewRequestID(), NewRequestID()
+	if !uuid.MatchString(a) {
+		t.Errorf("NewRequestID got %q", a)
+	}
+	if a == b {
+		t.Errorf("NewRequestID returned %q twice", a)
+	}
+}
+
+func TestLogCtx(t *testing.T) {
+	l, err := NewLogger(filepath.Join(t.TempDir(), "ctx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx1 := WithRequestID(context.Background(), "request-1")
+	ctx2 := WithRequestID(context.Background(), "request-2")
+	const n = 100
+	var wg sync.WaitGroup
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				switch i % 3 {
+				case 0:
+					l.InfofCtx(ctx, "message %d from %s", i, RequestID(ctx))
+				case 1:
+					l.WarnfCtx(ctx, "message %d from %s", i, RequestID(ctx))
+				case 2:
+					l.ErrorfCtx(ctx, "message %d from %s", i, RequestID(ctx))
+				}
+			}
+		}(ctx)
+	}
+	wg.Wait()
+	l.InfofCtx(context.Background(), "no id")
+
+	data, err := ioutil.ReadFile(l.last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := regexp.MustCompile(`^[IWE][0-9:.]+ .*\] \[(request-[12])\] message [0-9]+ from (request-[12])$`)
+	counts := map[string]int{}
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'})
+	for _, ln := range lines[:len(lines)-1] {
+		m := line.FindSubmatch(ln)
+		if m == nil {
+			t.Errorf("bad line %q", ln)
+			continue
+		}
+		if string(m[1]) != string(m[2]) {
+			t.Errorf("line tagged %s logged from %s", m[1], m[2])
+		}
+		counts[string(m[1])]++
+	}
+	if counts["request-1"] != n || counts["request-2"] != n {
+		t.Errorf("got counts %v, want %d of each", counts, n)
+	}
+	if last := lines[len(lines)-1]; bytes.Contains(last, []byte("[request")) || !bytes.HasSuffix(last, []byte("] no id")) {
+		t.Errorf("untagged line got %q", last)
+	}
+}
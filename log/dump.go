@@ -22,6 +22,28 @@ import (
 
 var home = append(append([]byte{'\t'}, []byte(os.Getenv("HOME"))...), '/')
 
+// modulePath is shortened to shortModulePath in function names by CleanStack.
+var (
+	modulePath      = []byte("github.com/pborman/pty/")
+	shortModulePath = []byte("pty/")
+)
+
+// noiseFrames are the functions whose frames CleanStack always removes.
+var noiseFrames = [][]byte{
+	([]byte)("runtime.goexit("),
+	([]byte)("runtime.main("),
+}
+
+func isNoise(line []byte) bool {
+	line = bytes.TrimPrefix(line, ([]byte)("created by "))
+	for _, f := range noiseFrames {
+		if bytes.HasPrefix(line, f) {
+			return true
+		}
+	}
+	return false
+}
+
 var registers = [][]byte{
 	([]byte)("rax "),
 	([]byte)("rbx "),
@@ -65,7 +87,11 @@ func nextLine(buf []byte) (line, rest []byte) {
 	return buf, nil
 }
 
-// CleanStack prunes the stack to only include local frames.
+// CleanStack prunes the stack to only include local frames.  Each goroutine
+// with local frames starts with its ID and status, e.g.,
+// "goroutine 1 [running]:".  The runtime.goexit and runtime.main frames are
+// removed and function names in this module are shortened to start with
+// pty/ rather than github.com/pborman/pty/.
 func CleanStack(buf []byte) []byte {
 	pwd, err := os.Getwd()
 
@@ -103,6 +129,10 @@ func CleanStack(buf []byte) []byte {
 			continue
 		}
 		path, buf = nextLine(buf)
+		if isNoise(line) {
+			continue
+		}
+		line = bytes.Replace(line, modulePath, shortModulePath, 1)
 		if len(wd) > 0 && bytes.HasPrefix(path, wd) {
 			newbuf = append(newbuf, line...)
 			newbuf = append(newbuf, '\t')
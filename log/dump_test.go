@@ -0,0 +1,97 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package log
+
+import (
+	"bytes"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+func TestCleanStack(t *testing.T) {
+	var b bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&b, 2)
+	stack := string(CleanStack(b.Bytes()))
+	if !strings.Contains(stack, "\npty/log.TestCleanStack(") {
+		t.Errorf("stack is missing pty/log.TestCleanStack:\n%s", stack)
+	}
+	if !strings.Contains(stack, "goroutine ") {
+		t.Errorf("stack is missing goroutine headers:\n%s", stack)
+	}
+	for _, s := range []string{"github.com/pborman/pty/", "runtime.goexit", "runtime.main"} {
+		if strings.Contains(stack, s) {
+			t.Errorf("stack contains %s:\n%s", s, stack)
+		}
+	}
+}
+
+func TestCleanStackNoise(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := `goroutine 1 [running]:
+github.com/pborman/pty/log.f()
+	` + wd + `/f.go:10 +0x10
+runtime.main()
+	` + wd + `/proc.go:250 +0x20
+runtime.goexit({})
+	` + wd + `/asm.s:1650 +0x1
+
+goroutine 7 [chan receive, 5 minutes]:
+runtime.gopark(0x0)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+main.g()
+	` + wd + `/g.go:20 +0x30
+created by github.com/pborman/pty/log.h in goroutine 1
+	` + wd + `/h.go:30 +0x40
+`
+	want := `
+goroutine 1 [running]:
+pty/log.f()
+	f.go:10 +0x10
+
+goroutine 7 [chan receive, 5 minutes]:
+main.g()
+	g.go:20 +0x30
+created by pty/log.h in goroutine 1
+	h.go:30 +0x40
+`
+	if got := string(CleanStack([]byte(in))); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDumpGoroutinesTo(t *testing.T) {
+	var b bytes.Buffer
+	if err := (&Logger{}).DumpGoroutinesTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "pty/log.TestDumpGoroutinesTo(") {
+		t.Errorf("dump is missing pty/log.TestDumpGoroutinesTo:\n%s", b.String())
+	}
+}
+
+func TestPackageDumpGoroutinesTo(t *testing.T) {
+	var b bytes.Buffer
+	if err := DumpGoroutinesTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "pty/log.TestPackageDumpGoroutinesTo(") {
+		t.Errorf("dump is missing pty/log.TestPackageDumpGoroutinesTo:\n%s", b.String())
+	}
+}
@@ -16,12 +16,15 @@ package log
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"log/syslog"
 	"os"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -35,13 +38,30 @@ var (
 	Age      = time.Hour * 6
 )
 
+// A Logger writes log messages to a file that is rotated every Duration.  If
+// MaxSize is not 0 then the log is also rotated when it grows to MaxSize
+// bytes.  If MaxFiles is not 0 then when the log is rotated only the newest
+// MaxFiles log files are kept.
 type Logger struct {
-	mu   sync.Mutex
-	fd   io.WriteCloser
-	path string
-	last string
-	quit bool
-	done chan struct{}
+	MaxSize  int64 // maximum size of a log file in bytes
+	MaxFiles int   // maximum number of log files to keep
+
+	mu       sync.Mutex
+	fd       io.WriteCloser
+	writers  []io.Writer // additional destinations
+	path     string
+	last     string
+	size     int64 // bytes written to the current log file
+	rotating bool  // set while rotating due to size
+	quit     bool
+	done     chan struct{}
+	limits   map[string]*rateLimitEntry // used by RateLimitedErrorf
+}
+
+// A rateLimitEntry tracks the messages logged with a single key by
+// RateLimitedErrorf.
+type rateLimitEntry struct {
+	suppressed int // messages not logged since the window opened
 }
 
 var logger *Logger
@@ -98,25 +118,37 @@ func NewLogger(path string) (*Logger, error) {
 	if err := log.open(); err != nil {
 		return nil, err
 	}
+	d := Duration
 	go func() {
-		for _ = range time.Tick(Duration) {
+		for _ = range time.Tick(d) {
 			if log.quit {
 				log.fd.Close()
 				close(log.done)
 				return
 			}
-			if err := log.open(); err != nil {
-				log.Errorf("failed to rotate log: %v", err)
-			}
-			log.mu.Lock()
-			path = filepath.Dir(log.path)
-			log.mu.Unlock()
-			log.prune(filepath.Dir(path))
+			log.rotate()
 		}
 	}()
 	return log, nil
 }
 
+// rotate switches to a new log file and prunes old log files.
+func (log *Logger) rotate() {
+	log.mu.Lock()
+	last := log.last
+	log.mu.Unlock()
+	if err := log.open(); err != nil {
+		log.Errorf("failed to rotate log: %v", err)
+	}
+	log.mu.Lock()
+	path := log.path
+	rotated := log.last != last
+	log.mu.Unlock()
+	if rotated {
+		log.prune(filepath.Dir(path))
+	}
+}
+
 func TakeStderr() {
 	if f, ok := logger.fd.(*os.File); ok {
 		Infof("Taking over stderr")
@@ -130,8 +162,15 @@ func TakeStderr() {
 const pformat = "20060102.150405"
 
 // prune walks through the logging directory removing every file that
-// looks like a logging file and is over Age.
+// looks like a logging file and is over Age.  If log.MaxFiles is not 0 then
+// only the newest MaxFiles of log's own files are kept.
 func (log *Logger) prune(dir string) {
+	log.mu.Lock()
+	prefix := filepath.Base(log.path) + "-"
+	maxFiles := log.MaxFiles
+	log.mu.Unlock()
+	var mine []string // names of our log files, oldest first
+
 	fd, err := os.Open(dir)
 	if err != nil {
 		log.Errorf("pruning: %v", err)
@@ -165,16 +204,39 @@ func (log *Logger) prune(dir string) {
 			continue
 		}
 		if !ts.Before(expire) {
+			if name[:t+1] == prefix {
+				mine = append(mine, name)
+			}
 			continue
 		}
 		log.Infof("removing old log %s", name)
 		os.Remove(filepath.Join(dir, name))
 	}
+	// The current log is not in mine but counts against maxFiles.
+	if maxFiles <= 0 || len(mine) < maxFiles {
+		return
+	}
+	// The timestamp format sorts by time.
+	sort.Strings(mine)
+	for _, name := range mine[:len(mine)-maxFiles+1] {
+		log.Infof("removing old log %s", name)
+		os.Remove(filepath.Join(dir, name))
+	}
 }
 
 func (l *Logger) open() error {
 	os.MkdirAll(filepath.Dir(l.path), 0700)
 	path := fmt.Sprintf("%s-%s.%d", l.path, time.Now().Format(pformat), os.Getpid())
+
+	// Log files are named by the second so we cannot rotate more than
+	// once a second.
+	l.mu.Lock()
+	if path == l.last {
+		l.mu.Unlock()
+		return nil
+	}
+	l.mu.Unlock()
+
 	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
 	if err != nil {
 		return err
@@ -191,6 +253,7 @@ func (l *Logger) open() error {
 		l.fd.Close()
 	}
 	l.fd = fd
+	l.size = 0
 	last := l.last
 	l.last = path
 	l.mu.Unlock()
@@ -227,14 +290,127 @@ func (l *Logger) Outputf(depth int, prefix string, format string, v ...interface
 	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
 		msg = msg[:len(msg)-1]
 	}
-	msg = fmt.Sprintf("%s%s %s: %s:%d] %s\n", prefix, time.Now().Format("15:04:05.000"), Me(), file, line, msg)
+	l.OutputDirect(fmt.Sprintf("%s%s %s: %s:%d] %s\n", prefix, time.Now().Format("15:04:05.000"), Me(), file, line, msg))
+}
+
+// OutputDirect writes msg, which has already been formatted, to the log as
+// is.  A newline is added if msg does not end in one.  Only the write itself
+// is done while holding the log's lock.
+func (l *Logger) OutputDirect(msg string) {
+	if len(msg) == 0 || msg[len(msg)-1] != '\n' {
+		msg += "\n"
+	}
 	if l == nil {
 		fmt.Fprint(os.Stderr, msg)
 		return
 	}
 	l.mu.Lock()
-	fmt.Fprintf(l.fd, msg)
+	io.WriteString(l.fd, msg)
+	for _, w := range l.writers {
+		io.WriteString(w, msg)
+	}
+	l.size += int64(len(msg))
+	rotate := l.MaxSize > 0 && l.size >= l.MaxSize && !l.rotating
+	if rotate {
+		l.rotating = true
+	}
 	l.mu.Unlock()
+	if rotate {
+		l.rotate()
+		l.mu.Lock()
+		l.rotating = false
+		l.mu.Unlock()
+	}
+}
+
+// AddWriter causes all future log messages to also be written to w.
+func (l *Logger) AddWriter(w io.Writer) {
+	l.mu.Lock()
+	l.writers = append(l.writers, w)
+	l.mu.Unlock()
+}
+
+// RemoveWriter stops log messages from being written to w.
+func (l *Logger) RemoveWriter(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, lw := range l.writers {
+		if lw == w {
+			l.writers = append(l.writers[:i:i], l.writers[i+1:]...)
+			return
+		}
+	}
+}
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// AddSyslog causes all future log messages of the standard logger to also be
+// sent to syslog with the provided tag and facility (e.g., "user" or
+// "local0").
+func AddSyslog(tag, facility string) error {
+	if logger == nil {
+		return errors.New("logging not initialized")
+	}
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	w, err := syslog.New(f|syslog.LOG_INFO, tag)
+	if err != nil {
+		return err
+	}
+	logger.AddWriter(w)
+	return nil
+}
+
+// ParseSize parses a size such as "100MB" and returns the number of bytes.
+// The suffixes K, M, G and T, optionally followed by B, are powers of 1024.  A
+// number with no suffix is in bytes.
+func ParseSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "B")
+	scale := int64(1)
+	if n := len(v); n > 0 {
+		switch v[n-1] {
+		case 'K':
+			scale = 1 << 10
+		case 'M':
+			scale = 1 << 20
+		case 'G':
+			scale = 1 << 30
+		case 'T':
+			scale = 1 << 40
+		}
+		if scale != 1 {
+			v = strings.TrimSpace(v[:n-1])
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * scale, nil
 }
 
 func Errorf(format string, v ...interface{})            { logger.Outputf(1, "E", format, v...) }
@@ -256,21 +432,76 @@ func (log *Logger) Errorf(format string, v ...interface{}) { log.Outputf(1, "E",
 func (log *Logger) Warnf(format string, v ...interface{})  { log.Outputf(1, "W", format, v...) }
 func (log *Logger) Infof(format string, v ...interface{})  { log.Outputf(1, "I", format, v...) }
 
+// RateLimitedErrorf logs an error like Errorf unless a message with the same
+// key has been logged within the last rate.  Such messages are suppressed.
+// Once rate has passed since the first message with key was logged, a line
+// reporting the number of suppressed messages, if any, is logged.
+func (l *Logger) RateLimitedErrorf(key string, rate time.Duration, format string, v ...interface{}) {
+	l.rateLimited(2, key, rate, format, v...)
+}
+
+func RateLimitedErrorf(key string, rate time.Duration, format string, v ...interface{}) {
+	logger.rateLimited(2, key, rate, format, v...)
+}
+
+func (l *Logger) rateLimited(depth int, key string, rate time.Duration, format string, v ...interface{}) {
+	if l == nil {
+		l.Outputf(depth, "E", format, v...)
+		return
+	}
+	l.mu.Lock()
+	if e := l.limits[key]; e != nil {
+		e.suppressed++
+		l.mu.Unlock()
+		return
+	}
+	if l.limits == nil {
+		l.limits = map[string]*rateLimitEntry{}
+	}
+	l.limits[key] = &rateLimitEntry{}
+	l.mu.Unlock()
+
+	l.Outputf(depth, "E", format, v...)
+	time.AfterFunc(rate, func() {
+		l.mu.Lock()
+		n := l.limits[key].suppressed
+		delete(l.limits, key)
+		l.mu.Unlock()
+		if n > 0 {
+			l.Outputf(1, "E", "suppressed %d occurrences of [%s]", n, key)
+		}
+	})
+}
+
 func (log *Logger) DumpGoroutines() {
-	if p := pprof.Lookup("goroutine"); p != nil {
-		var b bytes.Buffer
-		p.WriteTo(&b, 2)
-		log.Errorf("Dumping current goroutines")
-		log.mu.Lock()
-		log.fd.Write([]byte{'\n'})
-		log.fd.Write(CleanStack(b.Bytes()))
-		log.fd.Write([]byte{'\n'})
-		log.mu.Unlock()
-	} else {
-		log.Errorf("failed to lookup goroutine profile")
+	log.Errorf("Dumping current goroutines")
+	if log == nil {
+		log.DumpGoroutinesTo(os.Stderr)
+		return
+	}
+	log.mu.Lock()
+	err := log.DumpGoroutinesTo(log.fd)
+	log.mu.Unlock()
+	if err != nil {
+		log.Errorf("%v", err)
 	}
 }
 
+// DumpGoroutinesTo writes the stacks of all goroutines, as cleaned by
+// CleanStack, to w.
+func (log *Logger) DumpGoroutinesTo(w io.Writer) error {
+	p := pprof.Lookup("goroutine")
+	if p == nil {
+		return errors.New("failed to lookup goroutine profile")
+	}
+	var b bytes.Buffer
+	p.WriteTo(&b, 2)
+	w.Write([]byte{'\n'})
+	w.Write(CleanStack(b.Bytes()))
+	_, err := w.Write([]byte{'\n'})
+	return err
+}
+
 func (log *Logger) DumpStack() {
 	n := 15
 	for i := 1; i <= n; i++ {
@@ -290,3 +521,7 @@ func (log *Logger) DumpStack() {
 
 func DumpGoroutines() { logger.DumpGoroutines() }
 func DumpStack()      { logger.DumpStack() }
+
+// DumpGoroutinesTo writes the stacks of all goroutines to w.  Unlike
+// DumpGoroutines, nothing is written to the log file.
+func DumpGoroutinesTo(w io.Writer) error { return logger.DumpGoroutinesTo(w) }
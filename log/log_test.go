@@ -15,7 +15,12 @@
 package log
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -45,3 +50,199 @@ func TestLog(t *testing.T) {
 	// We should look in Dir to see if we have the right
 	// number of files.
 }
+
+func TestAddWriter(t *testing.T) {
+	l, err := NewLogger(filepath.Join(t.TempDir(), "writer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.AddWriter(&buf)
+	l.Infof("message %d", 1)
+	l.RemoveWriter(&buf)
+	l.Infof("message %d", 2)
+
+	data, err := ioutil.ReadFile(l.last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines) < 1 || !bytes.Contains(lines[0], []byte("message 1")) {
+		t.Fatalf("log file got %q", data)
+	}
+	if got, want := buf.String(), string(lines[0]); got != want {
+		t.Errorf("writer got %q, want %q", got, want)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewLogger(filepath.Join(dir, "size"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.MaxSize = 200
+
+	count := func() int {
+		names, err := filepath.Glob(filepath.Join(dir, "size-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(names)
+	}
+	for i := 0; i < 10; i++ {
+		l.Infof("message %d", i)
+	}
+	// Log files are named by the second.
+	time.Sleep(1100 * time.Millisecond)
+	l.Infof("last message")
+	if n := count(); n != 2 {
+		t.Errorf("got %d log files, want 2", n)
+	}
+
+	l.mu.Lock()
+	l.MaxFiles = 1
+	l.mu.Unlock()
+	time.Sleep(1100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		l.Infof("message %d", i)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("got %d log files, want 1", n)
+	}
+}
+
+func TestConcurrentLog(t *testing.T) {
+	l, err := NewLogger(filepath.Join(t.TempDir(), "concurrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		writers  = 10
+		messages = 100
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				l.Infof("writer %d message %d %s", i, j, strings.Repeat("x", 100))
+			}
+		}(i)
+	}
+	wg.Wait()
+	l.OutputDirect("direct")
+
+	data, err := ioutil.ReadFile(l.last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != writers*messages+1 {
+		t.Fatalf("got %d lines, want %d", len(lines), writers*messages+1)
+	}
+	for _, line := range lines[:len(lines)-1] {
+		if !strings.HasPrefix(line, "I") || strings.Count(line, "writer") != 1 || !strings.HasSuffix(line, strings.Repeat("x", 100)) {
+			t.Fatalf("interleaved line %q", line)
+		}
+	}
+	if got := lines[len(lines)-1]; got != "direct" {
+		t.Errorf("got last line %q, want direct", got)
+	}
+}
+
+func BenchmarkConcurrentLog(b *testing.B) {
+	l, err := NewLogger(filepath.Join(b.TempDir(), "bench"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	const (
+		writers  = 10
+		messages = 10000
+	)
+	for n := 0; n < b.N; n++ {
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < messages; j++ {
+					l.Infof("writer %d message %d", i, j)
+				}
+			}(i)
+		}
+		wg.Wait()
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{in: "0", want: 0},
+		{in: "512", want: 512},
+		{in: "10K", want: 10 << 10},
+		{in: "10kb", want: 10 << 10},
+		{in: "100MB", want: 100 << 20},
+		{in: "2G", want: 2 << 30},
+		{in: "1T", want: 1 << 40},
+		{in: "", err: true},
+		{in: "MB", err: true},
+		{in: "-1M", err: true},
+		{in: "ten", err: true},
+	} {
+		got, err := ParseSize(tt.in)
+		switch {
+		case err != nil && !tt.err:
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+		case err == nil && tt.err:
+			t.Errorf("%q: did not get an error", tt.in)
+		case got != tt.want:
+			t.Errorf("%q: got %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitedErrorf(t *testing.T) {
+	l, err := NewLogger(filepath.Join(t.TempDir(), "limit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.AddWriter(&buf)
+	for i := 0; i < 100; i++ {
+		l.RateLimitedErrorf("flap", time.Second/10, "failure %d", i)
+	}
+	l.mu.Lock()
+	lines := bytes.Count(buf.Bytes(), []byte{'\n'})
+	l.mu.Unlock()
+	if lines != 1 {
+		t.Errorf("got %d lines, want 1:\n%s", lines, buf.Bytes())
+	}
+
+	time.Sleep(time.Second / 4)
+	l.mu.Lock()
+	out := buf.String()
+	l.mu.Unlock()
+	if lines := strings.Count(out, "\n"); lines != 2 {
+		t.Errorf("got %d lines, want 2:\n%s", lines, out)
+	}
+	if !strings.Contains(out, "failure 0") {
+		t.Errorf("first message not logged:\n%s", out)
+	}
+	if !strings.Contains(out, "suppressed 99 occurrences of [flap]") {
+		t.Errorf("summary not logged:\n%s", out)
+	}
+
+	// Once the window has passed messages are logged again.
+	l.RateLimitedErrorf("flap", time.Second/10, "failure again")
+	l.mu.Lock()
+	out = buf.String()
+	l.mu.Unlock()
+	if !strings.Contains(out, "failure again") {
+		t.Errorf("message after window not logged:\n%s", out)
+	}
+}
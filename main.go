@@ -17,11 +17,13 @@ package main
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -29,6 +31,7 @@ import (
 
 	"github.com/kr/pty"
 	"github.com/pborman/getopt"
+	"github.com/pborman/pty/ansi/kitty"
 	"github.com/pborman/pty/log"
 	"github.com/pborman/pty/mutex"
 	"github.com/pborman/pty/parse"
@@ -36,7 +39,25 @@ import (
 )
 
 var pprofFd *os.File
-var autoAttach *bool
+var (
+	autoAttach    *bool
+	kittyKeyboard *bool
+	logMaxSize    *string
+	logMaxFiles   *int
+	shutdownGrace *time.Duration
+	noAudit       *bool
+	noCompression *bool
+	noTitleTrack  *bool
+	noMotd        *bool
+)
+
+// defaultShutdownGrace is how long clients have to detach when the server
+// receives SIGTERM.
+const defaultShutdownGrace = 10 * time.Second
+
+// deadlockTimeout is how long a mutex may be held while others wait for it
+// before the server logs a possible deadlock.
+const deadlockTimeout = time.Minute
 
 func main() {
 	os.Setenv("GORACE", "log_path=/tmp/cloud_race")
@@ -52,10 +73,6 @@ func main() {
 	if fi.Mode()&0777 != 0700 {
 		exitf("pty dir has mode %v, want %v", fi.Mode(), os.FileMode(os.ModeDir|0700))
 	}
-	if err := ReadConfig(); err != nil {
-		exitf("reading configuration file: %v", err)
-	}
-
 	internal := getopt.StringLong("internal", 0, "", "internal only flag")
 	internalDebug := getopt.StringLong("internal_debug", 0, "", "internal only flag")
 
@@ -65,16 +82,112 @@ func main() {
 	debugFlag := getopt.BoolLong("debug", 0, "debug mode, leave server in foreground")
 	debugServer := getopt.BoolLong("debug_server", 0, "enable server debugging")
 	detach := getopt.BoolLong("detach", 0, "create and detach new shell, do not connect")
+	runCmd := getopt.StringLong("run", 0, "", "run CMD in the session's shell", "CMD")
 	list := getopt.BoolLong("list", 0, "just list existing sessions")
+	verbose := getopt.BoolLong("verbose", 'v', "with --list, show the age, idle time, and last line of output of each session")
+	filterName := getopt.StringLong("filter-name", 0, "", "only list sessions starting with PREFIX", "PREFIX")
+	filterActive := getopt.BoolLong("filter-active", 0, "only list sessions with attached clients")
 	autoAttach = getopt.BoolLong("auto", 0, "automatically attach to matching session")
 	createSession := getopt.BoolLong("create", 'c', "creatre session if not existing")
+	kittyKeyboard = getopt.BoolLong("kitty-keyboard", 0, "recognize kitty keyboard protocol sequences")
+	logMaxSize = getopt.StringLong("log-max-size", 0, "", "rotate logs when they reach SIZE (e.g., 100MB)", "SIZE")
+	logMaxFiles = getopt.IntLong("log-max-files", 0, 0, "keep only the newest N log files when rotating logs", "N")
+	shutdownGrace = getopt.DurationLong("shutdown-grace", 0, defaultShutdownGrace, "time clients have to detach when the server is terminated")
+	noAudit = getopt.BoolLong("no-audit", 0, "do not write the session audit log")
+	noCompression = getopt.BoolLong("no-compression", 0, "do not compress large messages between client and server")
+	noTitleTrack = getopt.BoolLong("no-title-track", 0, "do not set the session title from the shell's title sequences")
+	noMotd = getopt.BoolLong("no-motd", 0, "do not display the message of the day from ~/.pty/motd")
+	ns := getopt.StringLong("namespace", 0, "", "use the sessions in namespace NS", "NS")
+	importFile := getopt.StringLong("import", 0, "", "create a session from the exported session in ARCHIVE and attach to it", "ARCHIVE")
+	exportFile := getopt.StringLong("export", 0, "", "export the named session to ARCHIVE for --import", "ARCHIVE")
+	checkConfig := getopt.BoolLong("check-config", 0, "check the configuration file and exit")
+	saveFormat := getopt.StringLong("save-format", 0, "", "file name used by save without arguments (overrides save_format)", "FORMAT")
+	gc := getopt.BoolLong("gc", 0, "remove sessions left behind by servers that are no longer running")
+	priority := getopt.IntLong("priority", 0, 0, "attach with priority N; only clients with the same or higher priority take the session", "N")
 	getopt.Parse()
 
+	if err := ReadConfig(); err != nil {
+		if *checkConfig {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		exitf("reading configuration file: %v", err)
+	}
+	if *checkConfig {
+		fmt.Println("configuration OK")
+		return
+	}
+	if getopt.IsSet("save-format") {
+		config.SaveFormat = *saveFormat
+	}
+
+	if !ValidNamespaceName(*ns) {
+		exitf("invalid namespace %q", *ns)
+	}
+	namespace = *ns
+
+	if *noCompression {
+		compressThreshold = 0
+	}
+
+	if *logMaxSize != "" {
+		n, err := log.ParseSize(*logMaxSize)
+		if err != nil {
+			exitf("--log-max-size: %v", err)
+		}
+		if l := log.Standard(); l != nil {
+			l.MaxSize = n
+		}
+	}
+	if *logMaxFiles < 0 {
+		exitf("--log-max-files: %d is negative", *logMaxFiles)
+	}
+	if l := log.Standard(); l != nil && *logMaxFiles > 0 {
+		l.MaxFiles = *logMaxFiles
+	}
+	if *kittyKeyboard {
+		if err := kitty.Import(); err != nil {
+			exitf("kitty keyboard: %v", err)
+		}
+	}
+
+	if *gc {
+		for _, name := range GCSessions(namespace) {
+			fmt.Printf("removed stale session %s\n", name)
+		}
+		return
+	}
+
 	if *list {
-		sis := GetSessions()
+		sis := GetSessionsFiltered(SessionFilter{
+			Namespace:  namespace,
+			NamePrefix: *filterName,
+			Active:     *filterActive,
+		})
 		fmt.Printf("Found %d sessions:\n", len(sis))
+		if *verbose {
+			var infos []*SessionInfo
+			for _, si := range sis {
+				info, err := si.Info()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					continue
+				}
+				infos = append(infos, info)
+			}
+			writeSessionInfo(os.Stdout, infos, "\n")
+			return
+		}
 		for _, si := range sis {
-			fmt.Printf("  %s (%d) %s\n", si.Name, si.cnt, si.Title())
+			active := ""
+			if t := si.LastActive(); !t.IsZero() {
+				active = " active " + ago(time.Since(t))
+			}
+			limit := ""
+			if n := si.MaxClients(); n > 0 {
+				limit = fmt.Sprintf(" (limit: %d)", n)
+			}
+			fmt.Printf("  %s (%d)%s%s %s\n", si.Name, si.cnt, limit, active, si.Title())
 		}
 		return
 	}
@@ -85,7 +198,10 @@ func main() {
 
 	// If internal is set then we are being called from spawSession.
 	if *internal != "" {
-		session := MakeSession(*internal, *sessionID)
+		session, err := MakeSession(namespace, *internal, *sessionID)
+		if err != nil {
+			exitf("session: %v", err)
+		}
 		log.Init(session.path + "/log/server")
 		log.TakeStderr()
 		session.run(*internalDebug)
@@ -93,6 +209,52 @@ func main() {
 	}
 
 	args := getopt.Args()
+	if *importFile != "" {
+		if len(args) > 0 || *newSession != "" {
+			getopt.PrintUsage(os.Stderr)
+			os.Exit(1)
+		}
+		f, err := os.Open(*importFile)
+		if err != nil {
+			exitf("import: %v", err)
+		}
+		session, err := ImportSession(f)
+		f.Close()
+		if err != nil {
+			exitf("import: %v", err)
+		}
+		args = []string{session.Name}
+		*createSession = true
+	}
+	if *exportFile != "" {
+		if len(args) != 1 || *importFile != "" || *newSession != "" {
+			getopt.PrintUsage(os.Stderr)
+			os.Exit(1)
+		}
+		if !ValidSessionName(args[0]) {
+			exitf("invalid session name %q", args[0])
+		}
+		session, err := MakeSession(namespace, args[0], "")
+		if err != nil {
+			exitf("session: %v", err)
+		}
+		if !session.Check() {
+			exitf("no such session %s", args[0])
+		}
+		f, err := os.OpenFile(*exportFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			exitf("export: %v", err)
+		}
+		err = session.Export(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(*exportFile)
+			exitf("export: %v", err)
+		}
+		return
+	}
 	switch len(args) {
 	case 0:
 	case 1:
@@ -105,6 +267,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	if config.Escape != "" && !getopt.IsSet("escape") {
+		*echar = config.Escape
+	}
+	if !getopt.IsSet("priority") {
+		*priority = config.Priority
+	}
 	tilde, ok := parseEscapeChar(*echar)
 	if !ok {
 		exitf("invalid escape character: %q", *echar)
@@ -113,7 +281,10 @@ func main() {
 	var session *Session
 	switch {
 	case *newSession != "":
-		session = MakeSession(*newSession, *sessionID)
+		session, err = MakeSession(namespace, *newSession, *sessionID)
+		if err != nil {
+			exitf("session: %v", err)
+		}
 		if session.Check() {
 			exitf("session name already in use")
 		}
@@ -133,11 +304,17 @@ func main() {
 		if !ValidSessionName(args[0]) {
 			exitf("invalid session name %q", args[0])
 		}
-		session = MakeSession(args[0], *sessionID)
+		session, err = MakeSession(namespace, args[0], *sessionID)
+		if err != nil {
+			exitf("session: %v", err)
+		}
 
 		if !session.Check() {
 			if *createSession {
-				session = MakeSession(args[0], *sessionID)
+				session, err = MakeSession(namespace, args[0], *sessionID)
+				if err != nil {
+					exitf("session: %v", err)
+				}
 				if session.Check() {
 					exitf("session name already in use")
 				}
@@ -169,10 +346,20 @@ func main() {
 
 		session.Spawn(debugFile, *debugFlag)
 		if *detach {
+			if *runCmd != "" {
+				if err := session.Run(*runCmd); err != nil {
+					exitf("run: %v", err)
+				}
+			}
 			return
 		}
 		// Give the new shell a chance to start up.
 		time.Sleep(time.Second / 2)
+	} else if *detach && *runCmd != "" {
+		if err := session.Run(*runCmd); err != nil {
+			exitf("run: %v", err)
+		}
+		return
 	}
 
 	// Here on down is the pty client.
@@ -183,15 +370,16 @@ func main() {
 	}
 
 	defer exit(0) // main should not return, this is a failsafe
-	myname, _ := ttyname.Fileno(0)
+	myname, _ := ttyname.Name(0)
 	if myname == "" {
 		myname = "unknown"
 	}
-	displayMotd()
-
 	if err := session.MakeRaw(); err != nil {
 		exitf("stty: %v\n", err)
 	}
+	if !*noMotd {
+		displayMotd(os.Stdout, os.Stdin, session)
+	}
 
 	// Here on down we need to use session.exit
 	exit := session.Exit
@@ -246,10 +434,22 @@ func main() {
 
 	// Below is the code that reads from stdin and writes to the server.
 	watchSigwinch(w, session)
-	w.Sendf(ttynameMessage, "%d:%s", os.Getpid(), myname)
+	// The priority must be set before the first ttysizeMessage takes
+	// the session.
+	if *priority != 0 {
+		if err := w.Sendf(priorityMessage, "%d", *priority); err != nil {
+			log.Errorf("sending priority: %v", err)
+		}
+	}
+	if err := w.Sendf(ttynameMessage, "%d:%s", os.Getpid(), myname); err != nil {
+		log.Errorf("sending tty name: %v", err)
+	}
 	var buf [32768]byte
 	state := 0
 	<-ready
+	if *runCmd != "" {
+		w.Send(runMessage, []byte(*runCmd))
+	}
 	ecnt := 0
 	rcnt := 0
 	for {
@@ -310,13 +510,24 @@ func main() {
 			}
 			exit(0)
 		case ':':
-			session.MakeCooked()
-			fmt.Printf("\nCommand: ")
-			line, err := readline()
-			if err != nil {
+			if cmdEditor == nil {
+				cmdEditor = commandEditor()
+			}
+			fmt.Printf("\r\n")
+			line, err := cmdEditor.ReadLine("Command: ")
+			if err != nil && err != io.EOF {
 				exitf("readline: %v\n", err)
 			}
-			args, err := parse.Line(line)
+			session.MakeCooked()
+			args, err := parse.LineWithEnv(line, os.Getenv)
+			for err == parse.ErrNeedsMore {
+				fmt.Printf("> ")
+				line, err = readline()
+				if err != nil {
+					exitf("readline: %v\n", err)
+				}
+				args, err = parse.ContinueLine(args, line)
+			}
 			if err != nil {
 				log.Warnf("parse %q: %v", line, err)
 				fmt.Printf("%v\n", err)
@@ -346,15 +557,19 @@ func main() {
 	exit(0)
 }
 
+// cmdEditor reads lines at the command prompt.
+var cmdEditor *lineEditor
+
 var (
 	ackerMu sync.Mutex
 	ackers  = map[[16]byte]chan struct{}{}
 	psChan  chan []byte
 )
 
-func ps(w *MessengerWriter) []byte {
+// ps asks the server for its process tree, sorted by sortBy.
+func ps(w *MessengerWriter, sortBy string) []byte {
 	psChan = make(chan []byte)
-	w.Send(psMessage, nil)
+	w.Send(psMessage, []byte(sortBy))
 	select {
 	case data := <-psChan:
 		return data
@@ -401,8 +616,15 @@ func clientCommand(w *MessengerWriter, kind messageKind, data []byte, ready chan
 	case serverMessage:
 		os.Stdout.Write(data)
 	case countMessage:
+	case runMessage:
+		if len(data) > 0 {
+			fmt.Printf("run: %s\r\n", data)
+		}
 	case preemptMessage:
 		// We could warn the client
+		if len(data) > 0 {
+			os.Stdout.Write(data)
+		}
 	case waitMessage:
 		select {
 		case <-ready:
@@ -428,17 +650,119 @@ func clientCommand(w *MessengerWriter, kind messageKind, data []byte, ready chan
 				w.Send(forwardMessage, []byte(s))
 			}
 		}
+	case bellMessage:
+		notifyBell(s.Name)
+	case broadcastEnvMessage:
+		line, err := broadcastEnv(data)
+		if err != nil {
+			log.Warnf("%v", err)
+			return
+		}
+		fmt.Printf("\r\n%s\r\n", line)
 	default:
 		fmt.Printf("Got message type %d: %q\r\n", kind, data)
 	}
 }
 
+// broadcastEnv returns the notice displayed when another client has exported
+// the variable in data, a broadcastEnvMessage of the form NAME\0VALUE, in the
+// shell.
+func broadcastEnv(data []byte) (string, error) {
+	x := bytes.IndexByte(data, 0)
+	if x <= 0 {
+		return "", fmt.Errorf("bad broadcast env message %q", data)
+	}
+	return fmt.Sprintf("[another client exported %s=%s]", data[:x], quoteShell(string(data[x+1:]))), nil
+}
+
+// expandSaveName returns the file name format with a leading ~/ replaced by
+// our home directory and the following sequences expanded for t:
+//
+//	%Y	year (2006)
+//	%m	month (01-12)
+//	%d	day of the month (01-31)
+//	%H	hour (00-23)
+//	%M	minute (00-59)
+//	%S	second (00-59)
+//	%N	the session name
+//	%%	a single %
+//
+// Any other % sequence is left as is.
+func expandSaveName(format, name string, t time.Time) string {
+	if strings.HasPrefix(format, "~/") {
+		format = filepath.Join(user.HomeDir, format[2:])
+	}
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' || i == len(format)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'N':
+			b.WriteString(name)
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+// ago returns d, the time since some event, in a short human readable form
+// such as "3m ago".
+func ago(d time.Duration) string {
+	return shortDuration(d) + " ago"
+}
+
+// shortDuration returns d in its largest whole unit, such as "3m".
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", d/time.Second)
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dd", d/(24*time.Hour))
+}
+
+// writeSessionInfo writes infos to w as a table with the columns NAME, AGE,
+// IDLE, CLIENTS, and LAST LINE.  Lines end in nl.
+func writeSessionInfo(w io.Writer, infos []*SessionInfo, nl string) {
+	width := len("NAME")
+	for _, info := range infos {
+		width = max(width, len(info.Name))
+	}
+	fmt.Fprintf(w, "%-*s %4s %4s %7s %s%s", width, "NAME", "AGE", "IDLE", "CLIENTS", "LAST LINE", nl)
+	for _, info := range infos {
+		fmt.Fprintf(w, "%-*s %4s %4s %7d %s%s", width, info.Name, shortDuration(info.Age), shortDuration(info.Idle), len(info.Clients), info.LastLine, nl)
+	}
+}
+
 func quoteShell(s string) string {
 	var buf bytes.Buffer
 	fmt.Fprintf(&buf, `"`)
 	for _, c := range s {
 		switch c {
-		case '"', '\\', '$':
+		case '"', '\\', '$', '`':
 			fmt.Fprintf(&buf, `\%c`, c)
 		default:
 			fmt.Fprintf(&buf, `%c`, c)
@@ -449,9 +773,14 @@ func quoteShell(s string) string {
 }
 
 type teeer struct {
-	mu   *mutex.Mutex
-	w    *os.File
-	path string
+	mu        *mutex.Mutex
+	w         *os.File
+	path      string
+	asciiPath string    // set when writing an asciicast file
+	start     time.Time // when the asciicast file was opened
+	maxBytes  int64     // size at which to rotate, 0 for no rotation
+	size      int64     // bytes written to w
+	rotations int       // suffix of the current file after rotating
 }
 
 var tee = teeer{
@@ -461,14 +790,127 @@ var tee = teeer{
 func (t *teeer) Write(buf []byte) (int, error) {
 	unlock := t.mu.Lock("Write")
 	w := t.w
+	ascii := t.asciiPath != ""
+	start := t.start
+	rotating := t.maxBytes > 0
 	unlock()
 	if w == nil {
 		return len(buf), nil
 	}
-	return w.Write(buf)
+	if rotating {
+		return t.writeRotating(buf)
+	}
+	if !ascii {
+		return w.Write(buf)
+	}
+	event, err := json.Marshal([]interface{}{time.Since(start).Seconds(), "o", string(buf)})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(append(event, '\n')); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// writeRotating writes buf to the tee file, switching to a new file each time
+// the current one reaches t.maxBytes.
+func (t *teeer) writeRotating(buf []byte) (int, error) {
+	defer t.mu.Lock("writeRotating")()
+	var n int
+	for len(buf) > 0 {
+		if t.w == nil {
+			// The tee was closed.
+			return n + len(buf), nil
+		}
+		if t.size >= t.maxBytes {
+			if err := t.rotate(); err != nil {
+				return n, err
+			}
+		}
+		m, err := t.w.Write(buf[:min(int64(len(buf)), t.maxBytes-t.size)])
+		n += m
+		t.size += int64(m)
+		if err != nil {
+			return n, err
+		}
+		buf = buf[m:]
+	}
+	return n, nil
 }
 
+// rotate closes the current tee file and creates the next one, named by
+// adding .1, .2, and so on to the original path.  The tee is closed if the
+// new file cannot be created.  t.mu must be held.
+func (t *teeer) rotate() error {
+	if err := checkClose(t.w); err != nil {
+		t.w = nil
+		t.path = ""
+		return err
+	}
+	t.rotations++
+	w, err := os.Create(fmt.Sprintf("%s.%d", t.path, t.rotations))
+	if err != nil {
+		t.w = nil
+		t.path = ""
+		return err
+	}
+	t.w = w
+	t.size = 0
+	return nil
+}
+
+// Open starts teeing output to path, rotating the file when it reaches
+// tee_max_size bytes.  If path is "-" then any current tee or script is
+// closed.
 func (t *teeer) Open(path string) {
+	t.OpenRotating(path, config.TeeMaxSize)
+}
+
+// OpenRotating starts teeing output to path.  Once maxBytes have been written
+// the file is closed and output continues in path.1, then path.2, and so on.
+// The file is never rotated if maxBytes is 0.  A leading ~ and $HOME in path
+// are replaced with the user's home directory.  If path is "-" then any
+// current tee or script is closed.
+func (t *teeer) OpenRotating(path string, maxBytes int64) {
+	t.open(path, nil, maxBytes)
+}
+
+// OpenScript starts recording output to path in asciicast v2 format.  The
+// terminal is rows by cols in size.  If path is "-" then any current tee or
+// script is closed.
+func (t *teeer) OpenScript(path string, rows, cols int) {
+	t.open(path, &asciicastHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: time.Now().Unix(),
+	}, 0)
+}
+
+// An asciicastHeader is the first line of an asciicast v2 file.
+type asciicastHeader struct {
+	Version   int   `json:"version"`
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+// expandPath replaces a leading ~ and any $HOME or ${HOME} in path with the
+// user's home directory.
+func expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = user.HomeDir + path[1:]
+	}
+	return os.Expand(path, func(name string) string {
+		if name == "HOME" {
+			return user.HomeDir
+		}
+		return "$" + name
+	})
+}
+
+func (t *teeer) open(path string, header *asciicastHeader, maxBytes int64) {
 	if path == "-" {
 		unlock := t.mu.Lock("Open1")
 		if t.w != nil {
@@ -478,9 +920,12 @@ func (t *teeer) Open(path string) {
 			t.w = nil
 		}
 		t.path = ""
+		t.asciiPath = ""
+		t.maxBytes = 0
 		unlock()
 		return
 	}
+	path = expandPath(path)
 	unlock := t.mu.Lock("Open2")
 	w := t.w
 	unlock()
@@ -493,16 +938,59 @@ func (t *teeer) Open(path string) {
 		fmt.Printf("ERROR OPENING TEE: %v\r\n", err)
 		return
 	}
+	if header != nil {
+		data, _ := json.Marshal(header)
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			w.Close()
+			fmt.Printf("ERROR WRITING SCRIPT: %v\r\n", err)
+			return
+		}
+	}
 	unlock = t.mu.Lock("Open3")
 	if t.w == nil {
 		t.w = w
 		t.path = path
+		t.maxBytes = maxBytes
+		t.size = 0
+		t.rotations = 0
+		if header != nil {
+			t.asciiPath = path
+			t.start = time.Now()
+		}
 	} else {
 		fmt.Printf("ERROR: tee created spontainiously?!\r\n")
 	}
 	unlock()
 }
 
+// commandHelp is the list of commands, and their descriptions, displayed by
+// the help command.
+var commandHelp = []struct {
+	name string
+	help string
+}{
+	{"cancel", "cancel a pending excl --after"},
+	{"clone", "start a new session NAME with this session's environment"},
+	{"diff", "compare the screen with one saved to FILE"},
+	{"dump", "dump stack (to FILE if given)"},
+	{"env", "display environment variables of client"},
+	{"escapes", "display escape sequences in save buffers (-v to describe them)"},
+	{"escstats", "display escape buffer metrics"},
+	{"excl", "detach all other clients (--after DURATION to warn them first)"},
+	{"limit", "allow at most N attached clients (0 for no limit)"},
+	{"list", "list all clients (-v for the session's age, idle time, and last line)"},
+	{"notify", "toggle desktop notifications when the bell rings"},
+	{"ps", "display processes on this pty (--sort-by cpu|rss)"},
+	{"ratelimit", "limit output to N bytes/second (0 for no limit)"},
+	{"save", "save buffer to FILE (%Y %m %d %H %M %S %N are expanded)"},
+	{"script", "record future output to FILE as asciicast (- to close)"},
+	{"setenv", "forward NAME or export NAME=VALUE in the shell"},
+	{"ssh", "forward SSH_AUTH_SOCK and export it in the shell"},
+	{"stats", "display session statistics"},
+	{"tee", "tee all future output to FILE (- to close)"},
+	{"title", "set the title for this session"},
+}
+
 // Command is called with a ^P: command.  It normally is called twice for each
 // command.  The first time it is called "raw" will be set to false indicating
 // the terminal is still in cooked mode.  The second time "raw" will be set to
@@ -517,23 +1005,42 @@ func command(raw bool, session *Session, w *MessengerWriter, args ...string) {
 			return
 		}
 		fmt.Printf("Commands:\n")
-		fmt.Printf("  dump    - dump stack\n")
-		fmt.Printf("  env     - display environment variables of client\n")
-		fmt.Printf("  escapes - display escape sequences in save buffers\n")
-		fmt.Printf("  excl    - detach all other clients\n")
-		fmt.Printf("  list    - list all clients\n")
-		fmt.Printf("  ps      - display processes on this pty\n")
-		fmt.Printf("  save    - save buffer to FILE\n")
-		fmt.Printf("  setenv  - forward environtment variables\n")
-		fmt.Printf("  ssh     - forward SSH_AUTH_SOCK\n")
-		fmt.Printf("  tee     - tee all future output to FILE (- to close)\n")
-		fmt.Printf("  title   - set the title for this session\n")
-	case "dump":
+		for _, c := range commandHelp {
+			fmt.Printf("  %-9s - %s\n", c.name, c.help)
+		}
+	case "clone":
 		if raw {
-			w.Send(dumpMessage, nil)
-		} else {
+			return
+		}
+		if len(args) != 2 {
+			fmt.Printf("usage: clone NAME\n")
+			return
+		}
+		if _, err := session.Clone(args[1]); err != nil {
+			fmt.Printf("clone: %v\n", err)
+		}
+	case "dump":
+		if len(args) > 2 {
+			if !raw {
+				fmt.Printf("usage: dump [FILE]\n")
+			}
+			return
+		}
+		if !raw {
 			log.DumpGoroutines()
+			return
+		}
+		// The server has its own working directory so relative
+		// paths are resolved here.
+		var path string
+		if len(args) == 2 {
+			var err error
+			if path, err = filepath.Abs(args[1]); err != nil {
+				fmt.Printf("dump: %v\r\n", err)
+				return
+			}
 		}
+		w.Send(dumpMessage, []byte(path))
 	case "env", "getenv":
 		if raw {
 			return
@@ -561,39 +1068,179 @@ func command(raw bool, session *Session, w *MessengerWriter, args ...string) {
 		if raw {
 			return
 		}
+		describe := len(args) > 1 && args[1] == "-v"
+		if describe {
+			args = args[1:]
+		}
 		if len(args) != 2 {
-			fmt.Printf("usage: escapes [alt|normal]\n")
+			fmt.Printf("usage: escapes [-v] [alt|normal]\n")
 			return
 		}
-		w.Send(escapeMessage, []byte(args[1]))
+		msg := args[1]
+		if describe {
+			msg += " -v"
+		}
+		w.Send(escapeMessage, []byte(msg))
+	case "escstats":
+		if raw {
+			w.Send(escstatsMessage, nil)
+		}
 	case "excl":
+		usage := len(args) != 1
+		if len(args) == 3 && args[1] == "--after" {
+			d, err := time.ParseDuration(args[2])
+			usage = err != nil || d <= 0
+		}
+		if usage {
+			if !raw {
+				fmt.Printf("usage: excl [--after DURATION]\n")
+			}
+			return
+		}
+		if raw {
+			var after []byte
+			if len(args) == 3 {
+				after = []byte(args[2])
+			}
+			w.Send(exclusiveMessage, after)
+		}
+	case "cancel":
 		if raw {
-			w.Send(exclusiveMessage, nil)
+			w.Send(cancelMessage, nil)
 		}
 	case "list":
+		if len(args) == 1 {
+			if raw {
+				w.Send(listMessage, nil)
+			}
+			return
+		}
 		if raw {
-			w.Send(listMessage, nil)
+			return
+		}
+		if len(args) != 2 || args[1] != "-v" {
+			fmt.Printf("usage: list [-v]\n")
+			return
+		}
+		info, err := session.Info()
+		if err != nil {
+			fmt.Printf("list: %v\n", err)
+			return
+		}
+		writeSessionInfo(os.Stdout, []*SessionInfo{info}, "\n")
+	case "notify":
+		if raw {
+			w.Send(notifyMessage, nil)
 		}
 	case "ps":
 		if raw {
 			return
 		}
-		os.Stdout.Write(ps(w))
+		var sortBy string
+		switch {
+		case len(args) == 1:
+		case len(args) == 3 && args[1] == "--sort-by" && psSortKeys[args[2]]:
+			sortBy = args[2]
+		default:
+			fmt.Printf("usage: ps [--sort-by cpu|rss]\n")
+			return
+		}
+		os.Stdout.Write(ps(w, sortBy))
+	case "limit":
+		var limit int
+		var err error
+		if len(args) == 2 {
+			limit, err = strconv.Atoi(args[1])
+		}
+		if len(args) != 2 || err != nil || limit < 0 {
+			if !raw {
+				fmt.Printf("usage: limit N\n")
+			}
+			return
+		}
+		if raw {
+			w.Send(limitMessage, []byte(args[1]))
+		}
+	case "ratelimit":
+		var limit int
+		var err error
+		if len(args) == 2 {
+			limit, err = strconv.Atoi(args[1])
+		}
+		if len(args) != 2 || err != nil || limit < 0 {
+			if !raw {
+				fmt.Printf("usage: ratelimit BYTES-PER-SECOND\n")
+			}
+			return
+		}
+		if raw {
+			w.Send(ratelimitMessage, []byte(args[1]))
+		}
+	case "diff":
+		if !raw && len(args) != 2 {
+			fmt.Printf("usage: diff FILENAME\n")
+			return
+		}
+		if raw && len(args) == 2 {
+			// The server has its own working directory so relative
+			// paths are resolved here.
+			path, err := filepath.Abs(args[1])
+			if err != nil {
+				fmt.Printf("diff: %v\r\n", err)
+				return
+			}
+			w.Send(diffMessage, []byte(path))
+		}
 	case "save":
+		if len(args) == 1 && config.SaveFormat != "" {
+			args = append(args, config.SaveFormat)
+		}
 		if !raw && len(args) != 2 {
 			fmt.Printf("usage: save FILENAME\n")
 			return
 		}
 		if raw && len(args) == 2 {
-			w.Send(saveMessage, []byte(args[1]))
+			path := expandSaveName(args[1], session.Name, time.Now())
+			if filepath.IsAbs(path) {
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					fmt.Printf("save: %v\r\n", err)
+					return
+				}
+			}
+			w.Send(saveMessage, []byte(path))
 		}
+	case "script":
+		if raw {
+			return
+		}
+		if len(args) != 2 {
+			fmt.Printf("usage: script FILENAME\n")
+			return
+		}
+		rows, cols, err := pty.Getsize(os.Stdin)
+		if err != nil {
+			rows, cols = 24, 80
+		}
+		tee.OpenScript(args[1], rows, cols)
 	case "setenv":
+		// NAME=VALUE is exported in the shell.  NAME by itself
+		// forwards the client's value of NAME.
+		args = args[1:]
 		if !raw {
+			if len(args) == 0 {
+				fmt.Printf("usage: setenv NAME[=VALUE] ...\n")
+			}
+			for _, name := range args {
+				if _, ok := os.LookupEnv(name); !ok && !strings.Contains(name, "=") {
+					fmt.Printf("setenv: %s is not set\n", name)
+				}
+			}
 			return
 		}
-		args = args[1:]
 		for _, name := range args {
-			if value, ok := os.LookupEnv(name); ok {
+			if x := strings.IndexByte(name, '='); x > 0 {
+				w.Send(setenvMessage, []byte(name[:x]+"\000"+name[x+1:]))
+			} else if value, ok := os.LookupEnv(name); ok {
 				fmt.Fprintf(w, "%s=%s\r", name, quoteShell(value))
 			}
 		}
@@ -601,8 +1248,16 @@ func command(raw bool, session *Session, w *MessengerWriter, args ...string) {
 		if !raw {
 			return
 		}
+		// Forward the socket, which has the server export
+		// SSH_AUTH_SOCK as the forwarder's socket, and tell the
+		// other clients.
 		if value, ok := os.LookupEnv("SSH_AUTH_SOCK"); ok {
-			fmt.Fprintf(w, "SSH_AUTH_SOCK=%s\r", quoteShell(value))
+			w.Send(forwardMessage, []byte("SSH_AUTH_SOCK\000"+value))
+			w.Send(broadcastEnvMessage, []byte("SSH_AUTH_SOCK\000SSH_AUTH_SOCK"+fwdSuffix))
+		}
+	case "stats":
+		if raw {
+			w.Send(statsMessage, nil)
 		}
 	case "tee":
 		if raw {
@@ -637,20 +1292,40 @@ func watchSigwinch(w *MessengerWriter, s *Session) error {
 	if err != nil {
 		return nil
 	}
-	go func() {
-
-		ch := make(chan os.Signal, 2)
-		signal.Notify(ch, syscall.SIGWINCH)
-		for range ch {
-			rows, cols, err := pty.Getsize(os.Stdin)
-			if err != nil {
-				log.Warnf("sigwinch getsize: %v", err)
-				fmt.Fprintf(os.Stderr, "getsize: %v\r\n", err)
-			} else {
-				log.Infof("sigwinch %d,%d", rows, cols)
-				w.Send(ttysizeMessage, encodeSize(rows, cols))
-			}
+	// Resizing a window may generate a burst of SIGWINCH signals.
+	// Only send the size once the burst is over.
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGWINCH)
+	go debounce(ch, sigwinchDelay, func() {
+		rows, cols, err := pty.Getsize(os.Stdin)
+		if err != nil {
+			log.Warnf("sigwinch getsize: %v", err)
+			fmt.Fprintf(os.Stderr, "getsize: %v\r\n", err)
+		} else {
+			log.Infof("sigwinch %d,%d", rows, cols)
+			w.Send(ttysizeMessage, encodeSize(rows, cols))
 		}
-	}()
+	})
 	return nil
 }
+
+// sigwinchDelay is how long the window size must be stable before a new size
+// is sent to the server.
+const sigwinchDelay = 50 * time.Millisecond
+
+// debounce calls f once delay has passed without a signal being received on
+// ch.  Each signal received restarts the delay.  debounce returns when ch is
+// closed.
+func debounce(ch <-chan os.Signal, delay time.Duration, f func()) {
+	var timer *time.Timer
+	for range ch {
+		if timer == nil {
+			timer = time.AfterFunc(delay, f)
+		} else {
+			timer.Reset(delay)
+		}
+	}
+	if timer != nil {
+		timer.Stop()
+	}
+}
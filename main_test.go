@@ -0,0 +1,198 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pborman/pty/mutex"
+)
+
+func TestScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.cast")
+	tee := &teeer{mu: mutex.New("test")}
+	tee.OpenScript(path, 24, 80)
+	writes := []string{"one\r\n", "two\r\n", "\033[1mthree\033[0m\r\n"}
+	for _, w := range writes {
+		time.Sleep(10 * time.Millisecond)
+		if _, err := tee.Write([]byte(w)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tee.Open("-")
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		t.Fatalf("missing header")
+	}
+	var header asciicastHeader
+	if err := json.Unmarshal(s.Bytes(), &header); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 {
+		t.Errorf("got header %+v", header)
+	}
+	var last float64
+	var i int
+	for ; s.Scan(); i++ {
+		var event []interface{}
+		if err := json.Unmarshal(s.Bytes(), &event); err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if len(event) != 3 {
+			t.Fatalf("event %d: got %d fields, want 3", i, len(event))
+		}
+		ts, ok := event[0].(float64)
+		if !ok || ts <= last {
+			t.Errorf("event %d: time %v not after %v", i, event[0], last)
+		}
+		last = ts
+		if event[1] != "o" {
+			t.Errorf("event %d: got type %v, want o", i, event[1])
+		}
+		if i < len(writes) && event[2] != writes[i] {
+			t.Errorf("event %d: got %q, want %q", i, event[2], writes[i])
+		}
+	}
+	if i != len(writes) {
+		t.Errorf("got %d events, want %d", i, len(writes))
+	}
+}
+
+func TestTeeRotating(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tee")
+	tee := &teeer{mu: mutex.New("test")}
+	tee.OpenRotating(path, 100)
+	var want []byte
+	for i := 0; i < 200; i += 40 {
+		buf := bytes.Repeat([]byte{'a' + byte(i/40)}, 40)
+		want = append(want, buf...)
+		if n, err := tee.Write(buf); n != len(buf) || err != nil {
+			t.Fatalf("Write returned %d, %v", n, err)
+		}
+	}
+	tee.Open("-")
+
+	names, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("got files %q, want %s and %s.1", names, path, path)
+	}
+	for i, name := range []string{path, path + ".1"} {
+		got, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := want[i*100 : (i+1)*100]; !bytes.Equal(got, w) {
+			t.Errorf("%s: got %q, want %q", name, got, w)
+		}
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = "/home/me"
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"tee.out", "tee.out"},
+		{"~", "/home/me"},
+		{"~/tee.out", "/home/me/tee.out"},
+		{"~other/tee.out", "~other/tee.out"},
+		{"$HOME/tee.out", "/home/me/tee.out"},
+		{"${HOME}/tee.out", "/home/me/tee.out"},
+		{"$OTHER/tee.out", "$OTHER/tee.out"},
+	} {
+		if got := expandPath(tt.in); got != tt.want {
+			t.Errorf("expandPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	var calls int32
+	ch := make(chan os.Signal)
+	go debounce(ch, sigwinchDelay, func() { atomic.AddInt32(&calls, 1) })
+	for i := 0; i < 10; i++ {
+		ch <- syscall.SIGWINCH
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(2 * sigwinchDelay)
+	close(ch)
+	if n := atomic.LoadInt32(&calls); n < 1 || n > 2 {
+		t.Errorf("got %d calls, want 1 or 2", n)
+	}
+}
+
+func TestExpandSaveName(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = "/home/test"
+	now := time.Date(2023, time.March, 4, 5, 6, 7, 0, time.Local)
+	for _, tt := range []struct {
+		format string
+		want   string
+	}{
+		{"screen.txt", "screen.txt"},
+		{"%Y%m%d-%H%M%S.txt", "20230304-050607.txt"},
+		{"~/captures/%N-%Y.txt", "/home/test/captures/work-2023.txt"},
+		{"/tmp/%N/%d", "/tmp/work/04"},
+		{"100%%-%x-%", "100%-%x-%"},
+	} {
+		if got := expandSaveName(tt.format, "work", now); got != tt.want {
+			t.Errorf("expandSaveName(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestSetenvCommand(t *testing.T) {
+	t.Setenv("MYVAR", "testvalue")
+	t.Setenv("MYUNSETVAR", "") // restored when the test ends
+	os.Unsetenv("MYUNSETVAR")
+	var buf bytes.Buffer
+	command(true, nil, NewMessengerWriter(&buf), "setenv", "MYVAR", "MYUNSETVAR")
+	if got, want := buf.String(), "MYVAR=\"testvalue\"\r"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	buf.Reset()
+	command(true, nil, NewMessengerWriter(&buf), "setenv", "OTHER=value")
+	var kind messageKind
+	var data []byte
+	r := NewMessengerReader(&buf, func(k messageKind, d []byte) {
+		kind, data = k, d
+	})
+	io.Copy(ioutil.Discard, r)
+	if kind != setenvMessage || string(data) != "OTHER\000value" {
+		t.Errorf("got %v %q, want setenvMessage \"OTHER\\000value\"", kind, data)
+	}
+}
@@ -0,0 +1,86 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// menuSelect displays items on w, one per line, with the item at index sel
+// highlighted.  Keys are read a byte at a time from r, which should be a
+// terminal in raw mode.  The up and down arrows (or k and j) move the
+// highlight and Enter returns the index of the highlighted item.  Esc or ^C
+// returns io.EOF.  As an escape sequence is read to its end, Esc is only seen
+// when the next key is typed (Esc Esc cancels at once).
+func menuSelect(r io.Reader, w io.Writer, items []string, sel int) (int, error) {
+	if len(items) == 0 {
+		return 0, io.EOF
+	}
+	sel = max(0, min(sel, len(items)-1))
+	draw := func() {
+		for i, item := range items {
+			if i == sel {
+				fmt.Fprintf(w, "\r\033[K\033[7m> %s\033[m\r\n", item)
+			} else {
+				fmt.Fprintf(w, "\r\033[K  %s\r\n", item)
+			}
+		}
+	}
+	draw()
+	le := &lineEditor{in: r, out: w}
+	for {
+		c, err := le.readByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case '\r', '\n':
+			return sel, nil
+		case 3: // ^C
+			return 0, io.EOF
+		case 'k':
+			sel = max(0, sel-1)
+		case 'j':
+			sel = min(len(items)-1, sel+1)
+		case '\033':
+			switch le.escape() {
+			case 'A': // up
+				sel = max(0, sel-1)
+			case 'B': // down
+				sel = min(len(items)-1, sel+1)
+			case 0: // just Esc
+				return 0, io.EOF
+			}
+		default:
+			continue
+		}
+		fmt.Fprintf(w, "\033[%dA", len(items))
+		draw()
+	}
+}
+
+// menuItem returns the line displayed for s by SelectSession.
+func menuItem(s *Session) string {
+	line := fmt.Sprintf("%s (%d Client%s)", s.Name, s.cnt, splur(s.cnt))
+	if size := s.TTYSize(); size != "" {
+		line += " " + size
+	}
+	if title := strings.TrimSpace(s.Title()); title != "" {
+		line += " " + title
+	}
+	return line
+}
@@ -0,0 +1,77 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMenuSelect(t *testing.T) {
+	items := []string{"one", "two", "three"}
+	for _, tt := range []struct {
+		name  string
+		keys  string
+		sel   int
+		want  int
+		isEOF bool
+	}{
+		{name: "enter", keys: "\r", want: 0},
+		{name: "initial", keys: "\r", sel: 2, want: 2},
+		{name: "down", keys: "\033[B\r", want: 1},
+		{name: "ss3 down", keys: "\033OB\n", want: 1},
+		{name: "down up", keys: "\033[B\033[B\033[A\r", want: 1},
+		{name: "past end", keys: "\033[B\033[B\033[B\033[B\r", want: 2},
+		{name: "past start", keys: "\033[A\033[A\r", sel: 1, want: 0},
+		{name: "jk", keys: "jjk\r", want: 1},
+		{name: "ignored", keys: "x\033[C\r", sel: 1, want: 1},
+		{name: "esc", keys: "\033\033", isEOF: true},
+		{name: "esc at end", keys: "\033[B\033", isEOF: true},
+		{name: "ctrl-c", keys: "\033[B\003", isEOF: true},
+		{name: "no enter", keys: "\033[B", isEOF: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := menuSelect(strings.NewReader(tt.keys), &out, items, tt.sel)
+			switch {
+			case tt.isEOF:
+				if err != io.EOF {
+					t.Errorf("got %d, %v, want io.EOF", got, err)
+				}
+			case err != nil:
+				t.Errorf("got error %v", err)
+			case got != tt.want:
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMenuSelectDraw(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := menuSelect(strings.NewReader("\033[B\r"), &out, []string{"one", "two"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	want := "\r\033[K\033[7m> one\033[m\r\n" +
+		"\r\033[K  two\r\n" +
+		"\033[2A" +
+		"\r\033[K  one\r\n" +
+		"\r\033[K\033[7m> two\033[m\r\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
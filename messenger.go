@@ -16,8 +16,12 @@ package main
 
 import (
 	"bytes"
+	"compress/zlib"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 
 	"github.com/pborman/pty/log"
 	"github.com/pborman/pty/mutex"
@@ -40,7 +44,60 @@ func (m *MessengerWriter) Close() error {
 	return checkClose(m.w)
 }
 
+// compressedBit is set in the kind byte of a message whose payload has been
+// zlib compressed.  Message kinds are all well below 0x80.  A compressed
+// dataMessage is sent as a framed message rather than as raw data.
+const compressedBit = 0x80
+
+// compressThreshold is the smallest payload that Send and Write will try to
+// compress.  A value of 0 disables compression.
+var compressThreshold = 1024
+
+// maxInflated is the largest payload a compressed message may expand to.
+const maxInflated = 64 << 20
+
+// deflate returns buf compressed with zlib.  It returns false if buf should
+// be sent uncompressed, either because it is too short or because
+// compressing it did not make it any shorter.
+func deflate(buf []byte) ([]byte, bool) {
+	if compressThreshold <= 0 || len(buf) < compressThreshold {
+		return nil, false
+	}
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	if _, err := zw.Write(buf); err != nil {
+		return nil, false
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false
+	}
+	if zbuf.Len() >= len(buf) {
+		return nil, false
+	}
+	return zbuf.Bytes(), true
+}
+
+// inflate returns the uncompressed form of buf.
+func inflate(buf []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(zr, maxInflated+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxInflated {
+		return nil, fmt.Errorf("compressed message too large")
+	}
+	return data, nil
+}
+
 func (m *MessengerWriter) Write(buf []byte) (int, error) {
+	if zbuf, ok := deflate(buf); ok {
+		return m.sendCompressed(dataMessage, buf, zbuf)
+	}
 	x := bytes.IndexByte(buf, 0)
 	cnt := 0
 	for x >= 0 {
@@ -70,16 +127,63 @@ func (m *MessengerWriter) Write(buf []byte) (int, error) {
 
 var oneK = 1024 // so tests can change it
 
-func (m *MessengerWriter) Sendf(kind messageKind, format string, v ...interface{}) (int, error) {
-	var buf bytes.Buffer
-	fmt.Fprintf(&buf, format, v...)
-	return m.Send(kind, buf.Bytes())
+// Sendf sends a message of the specified kind formatted as by fmt.Sprintf.
+// Sendf returns an error, and sends nothing, if format uses the %w verb,
+// which only fmt.Errorf supports.
+func (m *MessengerWriter) Sendf(kind messageKind, format string, v ...interface{}) error {
+	if hasWrapVerb(format) {
+		return fmt.Errorf("Sendf: %%w verb in format %q", format)
+	}
+	_, err := m.Send(kind, []byte(fmt.Sprintf(format, v...)))
+	return err
+}
+
+// SendfContext is like Sendf but returns ctx.Err() without sending anything
+// if ctx has been cancelled.
+func (m *MessengerWriter) SendfContext(ctx context.Context, kind messageKind, format string, v ...interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.Sendf(kind, format, v...)
+}
+
+// hasWrapVerb reports whether format contains a %w verb.
+func hasWrapVerb(format string) bool {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		// Skip flags, width, precision, and argument indexes.
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0; i++ {
+		}
+		if i < len(format) && format[i] == 'w' {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *MessengerWriter) Send(kind messageKind, buf []byte) (int, error) {
 	if kind == 0 {
 		return m.Write(buf)
 	}
+	if zbuf, ok := deflate(buf); ok {
+		return m.sendCompressed(kind, buf, zbuf)
+	}
+	return m.send(kind, buf)
+}
+
+// sendCompressed sends zbuf, the compressed form of buf, as a message of the
+// specified kind.  The count returned is relative to buf.
+func (m *MessengerWriter) sendCompressed(kind messageKind, buf, zbuf []byte) (int, error) {
+	n, err := m.send(kind|compressedBit, zbuf)
+	if n < len(zbuf) {
+		return 0, err
+	}
+	return len(buf), err
+}
+
+func (m *MessengerWriter) send(kind messageKind, buf []byte) (int, error) {
 	defer m.mu.Lock("Send")()
 
 	// We copy up to 1k into the buffer than includes our header.
@@ -123,6 +227,7 @@ type MessengerReader struct {
 	callback func(code messageKind, msg []byte)
 	mh, mt   int
 	message  []byte
+	pending  []byte // decompressed data not yet returned by Read
 	error    error
 }
 
@@ -141,6 +246,11 @@ func (m *MessengerReader) Read(buf []byte) (cnt int, err error) {
 		if len(buf) == 0 {
 			return cnt, nil
 		}
+		if len(m.pending) > 0 {
+			n := copy(buf, m.pending)
+			m.pending = m.pending[n:]
+			return cnt + n, nil
+		}
 
 		// We need at least one byte!
 		if !m.fill(1) {
@@ -207,10 +317,21 @@ func (m *MessengerReader) Read(buf []byte) (cnt int, err error) {
 		if !m.fill(count) {
 			return 0, m.error
 		}
+		data := m.message[m.mh : m.mh+count]
+		m.mh += count
+		if kind&compressedBit != 0 {
+			kind &^= compressedBit
+			if data, m.error = inflate(data); m.error != nil {
+				return 0, m.error
+			}
+			if kind == dataMessage {
+				m.pending = data
+				continue
+			}
+		}
 		if m.callback != nil {
-			m.callback(kind, m.message[m.mh:m.mh+count])
+			m.callback(kind, data)
 		}
-		m.mh += count
 	}
 }
 
@@ -230,8 +351,8 @@ func (m *MessengerReader) fill(count int) bool {
 		if count > cap(m.message) {
 			// We can't fit in the message buffer, so
 			// reallocate, rounding up to a 4K buffer size.
-			nm := make([]byte, (count+0x1000)&0xfff)
-			m.mt = copy(nm, m.message[:m.mt-m.mh])
+			nm := make([]byte, (count+0xfff)&^0xfff)
+			m.mt = copy(nm, m.message[m.mh:m.mt])
 			m.mh = 0
 			m.message = nm
 		} else if m.mh+count > cap(m.message) {
@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"testing"
 )
@@ -147,3 +148,96 @@ func TestMessengerWriter(t *testing.T) {
 		})
 	}
 }
+
+func TestMessengerCompression(t *testing.T) {
+	payload := bytes.Repeat([]byte("compress me\000please "), 500)[:8000]
+
+	for _, kind := range []messageKind{dataMessage, psMessage} {
+		var buf bytes.Buffer
+		mw := NewMessengerWriter(&buf)
+		n, err := mw.Send(kind, payload)
+		if err != nil {
+			t.Fatalf("%s: Send: %v", kind, err)
+		}
+		if n != len(payload) {
+			t.Errorf("%s: Send returned %d, want %d", kind, n, len(payload))
+		}
+		if buf.Len() >= len(payload) {
+			t.Errorf("%s: sent %d bytes on the wire, want fewer than %d", kind, buf.Len(), len(payload))
+		}
+		if buf.Bytes()[1] != byte(kind|compressedBit) {
+			t.Errorf("%s: kind byte is %#x, want %#x", kind, buf.Bytes()[1], kind|compressedBit)
+		}
+
+		var got []byte
+		var gotKind messageKind
+		mr := NewMessengerReader(&buf, func(kind messageKind, data []byte) {
+			gotKind = kind
+			got = append(got, data...)
+		})
+		data, err := ioutil.ReadAll(mr)
+		if err != nil {
+			t.Fatalf("%s: read error: %v", kind, err)
+		}
+		if kind == dataMessage {
+			got, gotKind = data, dataMessage
+		}
+		if gotKind != kind {
+			t.Errorf("got kind %s, want %s", gotKind, kind)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Errorf("%s: payload not reconstructed (%d bytes, want %d)", kind, len(got), len(payload))
+		}
+	}
+
+	// Small payloads, and all payloads when compression is disabled,
+	// are sent as before.
+	defer func(t int) { compressThreshold = t }(compressThreshold)
+	for _, threshold := range []int{1024, 0} {
+		compressThreshold = threshold
+		var buf bytes.Buffer
+		mw := NewMessengerWriter(&buf)
+		msg := payload[:100]
+		if threshold == 0 {
+			msg = payload
+		}
+		mw.Send(psMessage, msg)
+		if buf.Bytes()[1] != byte(psMessage) {
+			t.Errorf("threshold %d: kind byte is %#x, want %#x", threshold, buf.Bytes()[1], psMessage)
+		}
+		if buf.Len() != len(msg)+6 {
+			t.Errorf("threshold %d: sent %d bytes, want %d", threshold, buf.Len(), len(msg)+6)
+		}
+	}
+}
+
+func TestSendf(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewMessengerWriter(&buf)
+
+	wrap := "failed: %w" // a variable so vet does not reject it
+	if err := mw.Sendf(serverMessage, wrap, context.Canceled); err == nil {
+		t.Errorf("Sendf with %%w did not return an error")
+	}
+	if err := mw.Sendf(serverMessage, "100%%wide"); err != nil {
+		t.Errorf("Sendf with %%%%w: %v", err)
+	}
+	buf.Reset()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := mw.SendfContext(ctx, serverMessage, "%d", 42); err != nil {
+		t.Errorf("SendfContext: %v", err)
+	}
+	if got, want := buf.String(), string([]byte{0, byte(serverMessage), 0, 0, 0, 2})+"42"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	buf.Reset()
+
+	cancel()
+	if err := mw.SendfContext(ctx, serverMessage, "%d", 42); err != ctx.Err() {
+		t.Errorf("SendfContext returned %v, want %v", err, ctx.Err())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("SendfContext wrote %q after cancel", buf.String())
+	}
+}
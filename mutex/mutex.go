@@ -54,20 +54,25 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pborman/pty/log"
 )
 
 // A Mutex is a mutex.
 type Mutex struct {
+	label   string // name passed to New
 	name    string
 	mu      sync.Mutex
 	imu     sync.Mutex
 	owner   string
 	index   int
 	waiting map[string]struct{}
+	since   time.Time // when owner acquired the lock
+	warned  bool      // the detector warned about this acquisition
 }
 
 var (
@@ -78,6 +83,8 @@ var (
 	debug     = false
 	once      sync.Once
 	logger    = log.Outputf
+	dumper    = log.DumpGoroutines
+	detector  *deadlockDetector // the running deadlock detector
 )
 
 // New returns a new named mutex.
@@ -93,9 +100,10 @@ func New(name string) *Mutex {
 		}
 	})
 	if !debug {
-		return &Mutex{}
+		return &Mutex{label: name}
 	}
 	m := &Mutex{
+		label:   name,
 		name:    location(index, name),
 		waiting: map[string]struct{}{},
 	}
@@ -106,6 +114,32 @@ func New(name string) *Mutex {
 	return m
 }
 
+// Name returns the name m was created with.
+func (m *Mutex) Name() string {
+	return m.label
+}
+
+// Lookup returns the first mutex created with the provided name, or nil.  Like
+// Dump, mutexes are only recorded if __MUTEX_DEBUG is set to "true".
+func Lookup(name string) *Mutex {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, m := range list {
+		if m.label == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// All returns a copy of the list of all mutexes created while __MUTEX_DEBUG
+// is set to "true".
+func All() []*Mutex {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]*Mutex(nil), list...)
+}
+
 // Lock waits until it aquires the mutex log m and then returns the function
 // that will unlock m.
 func (m *Mutex) Lock(who string) func() {
@@ -132,6 +166,8 @@ func (m *Mutex) Lock(who string) func() {
 	{
 		delete(m.waiting, who)
 		m.owner = who
+		m.since = time.Now()
+		m.warned = false
 	}
 	m.imu.Unlock()
 	m.logf("%s acquired", who)
@@ -182,6 +218,83 @@ func Dump(w io.Writer) {
 	}
 }
 
+// StartDeadlockDetector starts a goroutine that checks all mutexes every
+// timeout/2.  A mutex that has been locked for longer than timeout while
+// another caller is waiting for it is logged as a possible deadlock, followed
+// by a dump of all goroutines.  Each acquisition of a mutex is only reported
+// once.  Like Dump, the detector does nothing unless __MUTEX_DEBUG is set to
+// "true".  Calling StartDeadlockDetector again replaces the running detector.
+func StartDeadlockDetector(timeout time.Duration) {
+	if !debug || timeout <= 0 {
+		return
+	}
+	StopDeadlockDetector()
+	d := &deadlockDetector{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	mu.Lock()
+	detector = d
+	mu.Unlock()
+	go func() {
+		defer close(d.done)
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+			if detectDeadlocks(timeout) {
+				dumper()
+			}
+		}
+	}()
+}
+
+type deadlockDetector struct {
+	stop chan struct{} // closed to stop the detector
+	done chan struct{} // closed when the detector has stopped
+}
+
+// StopDeadlockDetector stops the detector started by StartDeadlockDetector,
+// if any, and waits for it to exit.
+func StopDeadlockDetector() {
+	mu.Lock()
+	d := detector
+	detector = nil
+	mu.Unlock()
+	if d != nil {
+		close(d.stop)
+		<-d.done
+	}
+}
+
+// detectDeadlocks logs each mutex that has been held for longer than timeout
+// with at least one waiter.  It returns true if any were logged.
+func detectDeadlocks(timeout time.Duration) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	found := false
+	for _, m := range list {
+		m.imu.Lock()
+		if m.owner != "" && len(m.waiting) > 0 && !m.warned && time.Since(m.since) > timeout {
+			m.warned = true
+			found = true
+			var waiting []string
+			for name := range m.waiting {
+				waiting = append(waiting, name)
+			}
+			sort.Strings(waiting)
+			logger(1, "E", "possible deadlock: mutex %s locked by %s for %v, waiting: %s",
+				m.name, m.owner, time.Since(m.since).Round(time.Millisecond), strings.Join(waiting, ", "))
+		}
+		m.imu.Unlock()
+	}
+	return found
+}
+
 func (m *Mutex) logf(format string, args ...interface{}) {
 	if !debug {
 		return
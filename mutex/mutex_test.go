@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -291,3 +292,99 @@ func TestDump(t *testing.T) {
 		t.Logf("%s", buf.String())
 	}
 }
+
+func TestDeadlockDetector(t *testing.T) {
+	reset(true)
+	msgs := make(chan string, 10)
+	dumped := make(chan bool, 10)
+	defer func(l func(int, string, string, ...interface{}), d func()) {
+		logger, dumper = l, d
+	}(logger, dumper)
+	logger = func(n int, p, format string, v ...interface{}) {
+		if p == "E" {
+			msgs <- fmt.Sprintf(format, v...)
+		}
+	}
+	dumper = func() { dumped <- true }
+
+	a := New("A")
+	b := New("B")
+
+	// Each goroutine locks one mutex and then tries to lock the other.
+	// These goroutines never exit.
+	var ready sync.WaitGroup
+	ready.Add(2)
+	deadlock := func(first, second *Mutex) {
+		first.Lock("first")
+		ready.Done()
+		ready.Wait()
+		second.Lock("second")
+	}
+	go deadlock(a, b)
+	go deadlock(b, a)
+
+	StartDeadlockDetector(time.Second / 20)
+	defer StopDeadlockDetector()
+
+	seen := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 2 {
+		select {
+		case msg := <-msgs:
+			if !strings.Contains(msg, "possible deadlock") {
+				t.Fatalf("unexpected message %q", msg)
+			}
+			switch {
+			case strings.Contains(msg, "A> locked by"):
+				seen["A"] = true
+			case strings.Contains(msg, "B> locked by"):
+				seen["B"] = true
+			default:
+				t.Fatalf("unexpected message %q", msg)
+			}
+		case <-timeout:
+			t.Fatalf("timed out, saw deadlocks on %v", seen)
+		}
+	}
+	select {
+	case <-dumped:
+	case <-time.After(time.Second):
+		t.Errorf("goroutines not dumped")
+	}
+
+	// Each acquisition is only reported once.
+	select {
+	case msg := <-msgs:
+		t.Errorf("reported twice: %q", msg)
+	case <-time.After(time.Second / 5):
+	}
+}
+
+func TestLookup(t *testing.T) {
+	reset(true)
+	m1 := New("L1")
+	m2 := New("L2")
+	m3 := New("L3")
+
+	for _, m := range []*Mutex{m1, m2, m3} {
+		if got := Lookup(m.Name()); got != m {
+			t.Errorf("Lookup(%q) returned %v", m.Name(), got)
+		}
+	}
+	if got := Lookup("L4"); got != nil {
+		t.Errorf("Lookup(\"L4\") returned %s", got.Name())
+	}
+	all := All()
+	if len(all) != 3 {
+		t.Fatalf("All returned %d mutexes, want 3", len(all))
+	}
+	all[0] = nil
+	if Lookup("L1") != m1 {
+		t.Errorf("modifying the result of All changed the list")
+	}
+
+	reset(false)
+	if got := New("N").Name(); got != "N" {
+		t.Errorf("got name %q, want N", got)
+	}
+}
@@ -0,0 +1,72 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/pborman/pty/log"
+)
+
+// bellInterval is the minimum time between bell notifications.
+const bellInterval = time.Second
+
+var (
+	bellMu   sync.Mutex
+	lastBell time.Time
+)
+
+// notifyCommand returns the shell command used to send a desktop
+// notification.  The command is taken from the notify_command configuration
+// option, if set.  The session name is in $PTY_SESSION.
+func notifyCommand() string {
+	if config.NotifyCommand != "" {
+		return config.NotifyCommand
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return `osascript -e "display notification \"Bell in session $PTY_SESSION\" with title \"pty\""`
+	default:
+		return `notify-send pty "Bell in session $PTY_SESSION"`
+	}
+}
+
+// notifyBell sends a desktop notification that the bell rang in the named
+// session.  Notifications are sent no more often than bellInterval.
+func notifyBell(name string) {
+	bellMu.Lock()
+	if time.Since(lastBell) < bellInterval {
+		bellMu.Unlock()
+		return
+	}
+	lastBell = time.Now()
+	bellMu.Unlock()
+	go func() {
+		if err := runNotify(name); err != nil {
+			log.Warnf("bell notification: %v", err)
+		}
+	}()
+}
+
+// runNotify runs the notification command for the named session.
+func runNotify(name string) error {
+	cmd := exec.Command("/bin/sh", "-c", notifyCommand())
+	cmd.Env = append(os.Environ(), "PTY_SESSION="+name)
+	return cmd.Run()
+}
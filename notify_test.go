@@ -0,0 +1,74 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBell(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	var quiet, notified writeRecorder
+	c1 := NewClient(NewMessengerWriter(&quiet))
+	c2 := NewClient(NewMessengerWriter(&notified))
+	defer c1.Close()
+	defer c2.Close()
+	c2.SetNotify(true)
+	s.Attach(c1)
+	s.Attach(c2)
+
+	// The BEL terminating the OSC is not a bell.
+	s.eb.Write([]byte("\033]0;title\007ding\007"))
+
+	bells := func(w *writeRecorder) int {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		n := 0
+		for _, m := range w.writes {
+			if len(m) > 1 && m[0] == 0 && messageKind(m[1]) == bellMessage {
+				n++
+			}
+		}
+		return n
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := bells(&notified); n != 1 {
+		t.Errorf("client with notifications got %d bells, want 1", n)
+	}
+	if n := bells(&quiet); n != 0 {
+		t.Errorf("client without notifications got %d bells, want 0", n)
+	}
+}
+
+func TestRunNotify(t *testing.T) {
+	defer func(cmd string) { config.NotifyCommand = cmd }(config.NotifyCommand)
+	path := filepath.Join(t.TempDir(), "notified")
+	config.NotifyCommand = `echo "$PTY_SESSION" > ` + path
+
+	if err := runNotify("work"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("notification command was not run: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "work" {
+		t.Errorf("notification command got session %q, want %q", got, "work")
+	}
+}
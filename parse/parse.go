@@ -21,6 +21,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"strings"
 	"unicode"
 )
 
@@ -46,11 +47,22 @@ type Reader struct {
 	IsDelim func(rune) bool // function to determine if a rune is a delimiter
 	PS1     string          // optional initial prompt string
 	PS2     string          // optional secondary prompt string
-	r       *bufio.Reader
+
+	// Getenv, if not nil, is used to interpolate $NAME and ${NAME} in
+	// words.  Variables are not interpolated within single quotes or when
+	// the $ is escaped with a \.
+	Getenv func(string) string
+
+	r *bufio.Reader
 }
 
 var (
 	EOL = errors.New("EOL")
+
+	// ErrNeedsMore is returned by Line and ContinueLine when the line
+	// contains a heredoc (<<WORD or <<-WORD) that has not yet been
+	// terminated.
+	ErrNeedsMore = errors.New("heredoc needs more input")
 )
 
 func isQuote(r rune) bool {
@@ -63,9 +75,85 @@ func isDelim(r rune) bool {
 
 // Line parses in into words and returns them, or an error.  If in contains
 // a newline then parsing will stop on the newline.
+//
+// If the line contains a heredoc then the word following the heredoc's
+// delimiter is the body of the heredoc, initially empty, and ErrNeedsMore is
+// returned.  The body is then filled in by calling ContinueLine with each
+// following line until the delimiter is found.  Only the last heredoc in a
+// line is recognized.
 func Line(in string) ([]string, error) {
+	return LineWithEnv(in, nil)
+}
+
+// LineWithEnv is like Line but interpolates $NAME and ${NAME} in each word
+// with the value returned by env.  An unset variable, one for which env
+// returns "", is replaced by the empty string.  See Reader.Getenv.
+func LineWithEnv(in string, env func(string) string) ([]string, error) {
 	r := NewReader(bytes.NewBufferString(in))
-	return r.Read()
+	r.Getenv = env
+	words, err := r.Read()
+	if err != nil {
+		return words, err
+	}
+	if i, _, _ := heredoc(words, false); i >= 0 {
+		words = append(words[:i+1], append([]string{""}, words[i+1:]...)...)
+		return words, ErrNeedsMore
+	}
+	return words, nil
+}
+
+// ContinueLine adds the line continuation to the body of the heredoc in
+// prev, as returned by Line or a previous call to ContinueLine, and returns
+// the updated words.  ErrNeedsMore is returned until continuation is the
+// heredoc's delimiter.  Leading tabs are removed from continuation if the
+// heredoc was started with <<-.
+func ContinueLine(prev []string, continuation string) ([]string, error) {
+	i, delim, trim := heredoc(prev, true)
+	if i < 0 || i+1 >= len(prev) {
+		return prev, errors.New("no heredoc to continue")
+	}
+	continuation = strings.TrimSuffix(continuation, "\n")
+	if trim {
+		continuation = strings.TrimLeft(continuation, "\t")
+	}
+	if continuation == delim {
+		return prev, nil
+	}
+	words := append([]string{}, prev...)
+	words[i+1] += continuation + "\n"
+	return words, ErrNeedsMore
+}
+
+// heredoc returns the index of the last word of the last heredoc redirection
+// in words (either <<WORD or << WORD), the heredoc's delimiter, and whether
+// leading tabs are to be trimmed (<<-).  The index is -1 if there is no
+// heredoc.  If hasBody is true then each heredoc is followed by its body,
+// which is skipped.
+func heredoc(words []string, hasBody bool) (int, string, bool) {
+	index, delim, trim := -1, "", false
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		if !strings.HasPrefix(w, "<<") || strings.HasPrefix(w, "<<<") {
+			continue
+		}
+		d := w[2:]
+		t := strings.HasPrefix(d, "-")
+		if t {
+			d = d[1:]
+		}
+		if d == "" {
+			if i+1 >= len(words) {
+				continue
+			}
+			i++
+			d = words[i]
+		}
+		index, delim, trim = i, d, t
+		if hasBody {
+			i++
+		}
+	}
+	return index, delim, trim
 }
 
 // NewReader returns a new Reader.
@@ -88,6 +176,13 @@ func (r *Reader) matchQuote(word *bytes.Buffer, quote rune) error {
 		case quote:
 			return nil
 
+		case '$':
+			if quote == '\'' {
+				word.WriteRune(c)
+			} else if err := r.interpolate(word); err != nil {
+				return err
+			}
+
 		case '\\':
 			c, _, err = r.r.ReadRune()
 			if err != nil {
@@ -105,6 +200,53 @@ func (r *Reader) matchQuote(word *bytes.Buffer, quote rune) error {
 	}
 }
 
+// interpolate is called after reading a $.  If r.Getenv is not nil and the $
+// is followed by NAME or {NAME} then the value of NAME is written to word,
+// otherwise the $ is written to word.
+func (r *Reader) interpolate(word *bytes.Buffer) error {
+	if r.Getenv == nil {
+		word.WriteByte('$')
+		return nil
+	}
+	c, _, err := r.r.ReadRune()
+	if err != nil {
+		word.WriteByte('$')
+		return err
+	}
+	var name bytes.Buffer
+	if c == '{' {
+		for {
+			c, _, err = r.r.ReadRune()
+			if err != nil {
+				word.WriteString("${")
+				word.Write(name.Bytes())
+				return err
+			}
+			if c == '}' {
+				break
+			}
+			name.WriteRune(c)
+		}
+		word.WriteString(r.Getenv(name.String()))
+		return nil
+	}
+	for c == '_' || unicode.IsLetter(c) || (name.Len() > 0 && unicode.IsDigit(c)) {
+		name.WriteRune(c)
+		if c, _, err = r.r.ReadRune(); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		r.r.UnreadRune()
+	}
+	if name.Len() == 0 {
+		word.WriteByte('$')
+		return nil
+	}
+	word.WriteString(r.Getenv(name.String()))
+	return nil
+}
+
 func (r *Reader) readWord() (string, rune, error) {
 	var c rune
 	var err error
@@ -149,6 +291,10 @@ func (r *Reader) readWord() (string, rune, error) {
 			return word.String(), c, nil
 		case r.IsDelim(c):
 			return word.String(), c, nil
+		case c == '$':
+			if err := r.interpolate(word); err != nil && err != io.EOF {
+				return "", 0, err
+			}
 		case c == '\\':
 			c, _, err = r.r.ReadRune()
 			if err == io.EOF {
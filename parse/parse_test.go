@@ -46,3 +46,89 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestHeredoc(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		line  string
+		lines []string
+		out   []string
+	}{
+		{
+			name:  "simple",
+			line:  "cat <<EOF",
+			lines: []string{"hello", "  world", "EOF"},
+			out:   []string{"cat", "<<EOF", "hello\n  world\n"},
+		},
+		{
+			name:  "separate delimiter",
+			line:  "cat << END > file",
+			lines: []string{"line", "END"},
+			out:   []string{"cat", "<<", "END", "line\n", ">", "file"},
+		},
+		{
+			name:  "strip tabs",
+			line:  "cat <<-EOF",
+			lines: []string{"\tindented", "\tEOF"},
+			out:   []string{"cat", "<<-EOF", "indented\n"},
+		},
+		{
+			name:  "empty body",
+			line:  "cat <<EOF",
+			lines: []string{"EOF"},
+			out:   []string{"cat", "<<EOF", ""},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Line(tt.line)
+			if err != ErrNeedsMore {
+				t.Fatalf("Line returned %v, want %v", err, ErrNeedsMore)
+			}
+			for i, line := range tt.lines {
+				out, err = ContinueLine(out, line)
+				switch {
+				case i < len(tt.lines)-1 && err != ErrNeedsMore:
+					t.Fatalf("line %d: got error %v, want %v", i, err, ErrNeedsMore)
+				case i == len(tt.lines)-1 && err != nil:
+					t.Fatalf("line %d: %v", i, err)
+				}
+			}
+			if !reflect.DeepEqual(out, tt.out) {
+				t.Errorf("got %q, want %q", out, tt.out)
+			}
+		})
+	}
+	if _, err := Line("cat <<<word"); err != nil {
+		t.Errorf("here string: %v", err)
+	}
+}
+
+func TestLineWithEnv(t *testing.T) {
+	env := map[string]string{
+		"HOME": "/home/user",
+		"PATH": "/bin:/usr/bin",
+		"VAR":  "value",
+	}
+	getenv := func(name string) string { return env[name] }
+	for _, tt := range []struct {
+		in  string
+		out []string
+	}{
+		{in: "cd $HOME", out: []string{"cd", "/home/user"}},
+		{in: "echo ${PATH}", out: []string{"echo", "/bin:/usr/bin"}},
+		{in: "echo ${VAR}s $VAR/x", out: []string{"echo", "values", "value/x"}},
+		{in: `echo \$LITERAL`, out: []string{"echo", "$LITERAL"}},
+		{in: "echo '$VAR'", out: []string{"echo", "$VAR"}},
+		{in: `echo "$VAR"`, out: []string{"echo", "value"}},
+		{in: "echo $UNSET.", out: []string{"echo", "."}},
+		{in: "echo $ $1", out: []string{"echo", "$", "$1"}},
+	} {
+		out, err := LineWithEnv(tt.in, getenv)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("%s: got %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pborman/pty/log"
+)
+
+// uptimeFile is the path of the system uptime file.  It is a variable for
+// testing.
+var uptimeFile = "/proc/uptime"
+
+// warnf logs a warning.  It is a variable for testing.
+var warnf = log.Warnf
+
+// calibrationTolerance is how far apart two measurements may be and still
+// be considered the same.
+const calibrationTolerance = 0.05
+
+// Uptime returns how long the system has been up as reported by /proc/uptime.
+func Uptime() (time.Duration, error) {
+	data, err := ioutil.ReadFile(uptimeFile)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%s: empty", uptimeFile)
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", uptimeFile, err)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// Setup performs the optional runtime setup of the proc package.  Currently
+// it only calibrates TickDuration.
+func Setup(ctx context.Context) error {
+	_, err := CalibrateTickDuration(ctx)
+	return err
+}
+
+// CalibrateTickDuration checks TickDuration, which is derived from
+// sysconf(_SC_CLK_TCK), against the kernel.  The time since BootTime in
+// /proc/stat must agree with the uptime in /proc/uptime, otherwise an error
+// is returned.  The uptime divided by the number of jiffies each CPU has
+// accounted for in /proc/stat is the actual tick duration.  If the actual
+// tick duration is not within 5% of TickDuration then a warning is logged and
+// TickDuration is updated.  The (possibly updated) TickDuration is returned.
+func CalibrateTickDuration(ctx context.Context) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return TickDuration, err
+	}
+	s, err := SystemStat(StatBootTime | StatCPUs)
+	if err != nil {
+		return TickDuration, err
+	}
+	if err := ctx.Err(); err != nil {
+		return TickDuration, err
+	}
+	uptime, err := Uptime()
+	if err != nil {
+		return TickDuration, err
+	}
+	if s.BootTime.IsZero() {
+		return TickDuration, fmt.Errorf("%s: no boot time", statFile)
+	}
+	// The boot time is only accurate to the second.
+	if elapsed := time.Since(s.BootTime); !agree(elapsed, uptime) && absDuration(elapsed-uptime) > 2*time.Second {
+		return TickDuration, fmt.Errorf("boot time %v disagrees with uptime %v", elapsed, uptime)
+	}
+	// The first line is the sum of the others.
+	if len(s.CPUs) < 2 {
+		return TickDuration, fmt.Errorf("%s: no cpus", statFile)
+	}
+	cpu := s.CPUs[0]
+	// Guest time is also accounted for as user time.
+	jiffies := (cpu.Total - cpu.Guest - cpu.GuestNice) / int64(len(s.CPUs)-1)
+	if jiffies <= 0 {
+		return TickDuration, fmt.Errorf("%s: no cpu time", statFile)
+	}
+	actual := uptime / time.Duration(jiffies)
+	if agree(actual, TickDuration) {
+		return TickDuration, nil
+	}
+	warnf("tick duration is %v, not %v as reported by sysconf", actual, TickDuration)
+	TickDuration = actual
+	return actual, nil
+}
+
+// agree returns true if a and b are within calibrationTolerance of each other.
+func agree(a, b time.Duration) bool {
+	return float64(absDuration(a-b)) <= calibrationTolerance*float64(absDuration(b))
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
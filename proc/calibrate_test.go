@@ -0,0 +1,110 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalibrateTickDuration(t *testing.T) {
+	dir := t.TempDir()
+	defer func(s, u string) { statFile, uptimeFile = s, u }(statFile, uptimeFile)
+	defer func(d time.Duration) { TickDuration = d }(TickDuration)
+	defer func(f func(string, ...interface{})) { warnf = f }(warnf)
+	statFile = filepath.Join(dir, "stat")
+	uptimeFile = filepath.Join(dir, "uptime")
+	var warnings []string
+	warnf = func(format string, v ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, v...))
+	}
+
+	// write writes a /proc/stat and /proc/uptime for a two CPU system
+	// that has been up for 1000 seconds and whose CPUs have each accounted
+	// for jiffies ticks.
+	write := func(boot time.Duration, jiffies int64) {
+		stat := fmt.Sprintf("cpu  %d 0 %d %d 0 0 0 0 0 0\ncpu0 %d 0 %d %d 0 0 0 0 0 0\ncpu1 %d 0 %d %d 0 0 0 0 0 0\nbtime %d\n",
+			jiffies/2, jiffies/2, jiffies,
+			jiffies/4, jiffies/4, jiffies/2,
+			jiffies/4, jiffies/4, jiffies/2,
+			time.Now().Add(-boot).Unix())
+		if err := ioutil.WriteFile(statFile, []byte(stat), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(uptimeFile, []byte("1000.00 1800.00\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	TickDuration = 10 * time.Millisecond
+
+	write(1000*time.Second, 100000)
+	d, err := CalibrateTickDuration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 10*time.Millisecond || TickDuration != d {
+		t.Errorf("consistent data: got %v (TickDuration %v), want 10ms", d, TickDuration)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("consistent data: got warnings %q", warnings)
+	}
+
+	// The kernel is really running at 250Hz.
+	write(1000*time.Second, 250000)
+	d, err = CalibrateTickDuration(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != 4*time.Millisecond || TickDuration != d {
+		t.Errorf("inconsistent data: got %v (TickDuration %v), want 4ms", d, TickDuration)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "tick duration is 4ms") {
+		t.Errorf("inconsistent data: got warnings %q", warnings)
+	}
+
+	// The boot time does not match the uptime.
+	write(2000*time.Second, 250000)
+	if _, err := CalibrateTickDuration(ctx); err == nil {
+		t.Errorf("mismatched boot time did not return an error")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := CalibrateTickDuration(cctx); err != context.Canceled {
+		t.Errorf("canceled context got %v", err)
+	}
+}
+
+func TestUptime(t *testing.T) {
+	defer func(u string) { uptimeFile = u }(uptimeFile)
+	uptimeFile = filepath.Join(t.TempDir(), "uptime")
+	if err := ioutil.WriteFile(uptimeFile, []byte("3851.60 3326.30\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Uptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 3851600 * time.Millisecond; d != want {
+		t.Errorf("got %v, want %v", d, want)
+	}
+}
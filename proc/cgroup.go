@@ -0,0 +1,94 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cgroupFile is the path of the cgroup file of this process.  It is a
+// variable for testing.
+var cgroupFile = "/proc/self/cgroup"
+
+// A CgroupEntry is a single line from /proc/PID/cgroup.
+type CgroupEntry struct {
+	HierarchyID int      // 0 for the cgroup v2 hierarchy
+	Subsystems  []string // e.g., "cpu" and "cpuacct", empty for cgroup v2
+	Path        string   // path of the cgroup within the hierarchy
+}
+
+// SelfCgroups returns the cgroups of this process as read from
+// /proc/self/cgroup.
+func SelfCgroups() ([]CgroupEntry, error) {
+	f, err := os.Open(cgroupFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCgroups(f)
+}
+
+// ParseCgroups parses r, which is in the format of /proc/PID/cgroup.  Each
+// line is
+//
+//	hierarchy-ID:subsystem,...:path
+func ParseCgroups(r io.Reader) ([]CgroupEntry, error) {
+	var entries []CgroupEntry
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("short cgroup line %q", line)
+		}
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad hierarchy ID %q", fields[0])
+		}
+		e := CgroupEntry{HierarchyID: id, Path: fields[2]}
+		if fields[1] != "" {
+			e.Subsystems = strings.Split(fields[1], ",")
+		}
+		entries = append(entries, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// InContainer returns true if this process is in a cgroup other than the
+// root cgroup, as is typical of processes running in a container.  False is
+// returned if the cgroups cannot be read.
+func InContainer() bool {
+	entries, err := SelfCgroups()
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if e.Path != "/" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var cgroupData = `12:cpu,cpuacct:/
+11:memory:/docker/abc123
+1:name=systemd:/docker/abc123
+0::/docker/abc123
+`
+
+func TestParseCgroups(t *testing.T) {
+	entries, err := ParseCgroups(strings.NewReader(cgroupData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CgroupEntry{
+		{HierarchyID: 12, Subsystems: []string{"cpu", "cpuacct"}, Path: "/"},
+		{HierarchyID: 11, Subsystems: []string{"memory"}, Path: "/docker/abc123"},
+		{HierarchyID: 1, Subsystems: []string{"name=systemd"}, Path: "/docker/abc123"},
+		{HierarchyID: 0, Path: "/docker/abc123"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got %+v\nwant %+v", entries, want)
+	}
+
+	for _, in := range []string{"0:/", "x::/"} {
+		if _, err := ParseCgroups(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: did not get an error", in)
+		}
+	}
+}
+
+func TestInContainer(t *testing.T) {
+	defer func(f string) { cgroupFile = f }(cgroupFile)
+	dir := t.TempDir()
+	cgroupFile = filepath.Join(dir, "cgroup")
+
+	for _, tt := range []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"root", "12:cpu,cpuacct:/\n0::/\n", false},
+		{"container", cgroupData, true},
+	} {
+		if err := ioutil.WriteFile(cgroupFile, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := InContainer(); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	cgroupFile = filepath.Join(dir, "missing")
+	if InContainer() {
+		t.Errorf("missing cgroup file is in a container")
+	}
+}
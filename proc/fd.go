@@ -0,0 +1,122 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// An FDType is the kind of object an open file descriptor refers to.
+type FDType int
+
+const (
+	FDTypeFile   FDType = iota // a file or directory
+	FDTypeSocket               // a socket
+	FDTypePipe                 // a pipe or FIFO
+	FDTypeAnon                 // an anonymous inode (e.g., eventfd, epoll)
+	FDTypeDevice               // a device in /dev
+)
+
+var fdTypeNames = map[FDType]string{
+	FDTypeFile:   "file",
+	FDTypeSocket: "socket",
+	FDTypePipe:   "pipe",
+	FDTypeAnon:   "anon",
+	FDTypeDevice: "device",
+}
+
+func (t FDType) String() string {
+	if name, ok := fdTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("FDType(%d)", int(t))
+}
+
+// An FDInfo describes an open file descriptor of a process.
+type FDInfo struct {
+	FD     int
+	Target string // target of the /proc/PID/fd link, or ip:port for a TCP socket
+	Type   FDType
+}
+
+// ProcFDs returns the open file descriptors of process pid, sorted by file
+// descriptor, as read from /proc/PID/fd.  The Target of a TCP socket is its
+// local address, as found in /proc/net/tcp or /proc/net/tcp6.  Descriptors
+// that are closed while being read are skipped.
+func ProcFDs(pid int) ([]FDInfo, error) {
+	dir := "/proc/" + strconv.Itoa(pid) + "/fd"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sockets map[string]string // socket inode to local address
+	var fds []FDInfo
+	for _, e := range entries {
+		fd, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(dir + "/" + e.Name())
+		if err != nil {
+			continue
+		}
+		info := FDInfo{FD: fd, Target: target, Type: fdType(target)}
+		if info.Type == FDTypeSocket {
+			if sockets == nil {
+				sockets = tcpSockets()
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(target, "socket:["), "]")
+			if addr, ok := sockets[inode]; ok {
+				info.Target = addr
+			}
+		}
+		fds = append(fds, info)
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].FD < fds[j].FD })
+	return fds, nil
+}
+
+// fdType returns the type of file descriptor whose /proc/PID/fd link is
+// target.
+func fdType(target string) FDType {
+	switch {
+	case strings.HasPrefix(target, "socket:"):
+		return FDTypeSocket
+	case strings.HasPrefix(target, "pipe:"):
+		return FDTypePipe
+	case strings.HasPrefix(target, "anon_inode:"):
+		return FDTypeAnon
+	case strings.HasPrefix(target, "/dev/"):
+		return FDTypeDevice
+	}
+	return FDTypeFile
+}
+
+// tcpSockets returns a map of socket inode numbers to the local address of
+// all IPv4 and IPv6 TCP sockets.
+func tcpSockets() map[string]string {
+	sockets := map[string]string{}
+	for _, f := range []func() ([]*TCPConnection, error){NetTCP, NetTCP6} {
+		conns, _ := f()
+		for _, c := range conns {
+			sockets[strconv.FormatUint(c.Inode, 10)] = c.LocalAddr.String()
+		}
+	}
+	return sockets
+}
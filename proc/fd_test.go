@@ -0,0 +1,91 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestFDType(t *testing.T) {
+	for _, tt := range []struct {
+		target string
+		want   FDType
+	}{
+		{"/home/user/file", FDTypeFile},
+		{"socket:[12345]", FDTypeSocket},
+		{"pipe:[6789]", FDTypePipe},
+		{"anon_inode:[eventpoll]", FDTypeAnon},
+		{"/dev/pts/3", FDTypeDevice},
+	} {
+		if got := fdType(tt.target); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestProcFDs(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skipf("no /proc: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lf, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+
+	fds, err := ProcFDs(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	byFD := map[int]FDInfo{}
+	for _, fd := range fds {
+		byFD[fd.FD] = fd
+	}
+	check := func(name string, fd uintptr, typ FDType, target string) {
+		info, ok := byFD[int(fd)]
+		switch {
+		case !ok:
+			t.Errorf("%s: fd %d not found", name, fd)
+		case info.Type != typ:
+			t.Errorf("%s: got type %v, want %v", name, info.Type, typ)
+		case target != "" && info.Target != target:
+			t.Errorf("%s: got target %q, want %q", name, info.Target, target)
+		}
+	}
+	check("file", f.Fd(), FDTypeFile, path)
+	check("pipe", r.Fd(), FDTypePipe, "")
+	check("socket", lf.Fd(), FDTypeSocket, "127.0.0.1:"+strconv.Itoa(l.Addr().(*net.TCPAddr).Port))
+}
@@ -0,0 +1,127 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A Limit is a soft and hard resource limit.  Unlimited values are
+// represented as math.MaxUint64.
+type Limit struct {
+	Soft uint64
+	Hard uint64
+}
+
+// A ProcessLimits contains the information read from /proc/PID/limits.
+type ProcessLimits struct {
+	MaxCPUTime          Limit // seconds
+	MaxFileSize         Limit // bytes
+	MaxDataSize         Limit // bytes
+	MaxStackSize        Limit // bytes
+	MaxCoreFileSize     Limit // bytes
+	MaxResidentSet      Limit // bytes
+	MaxProcesses        Limit // processes
+	MaxOpenFiles        Limit // files
+	MaxLockedMemory     Limit // bytes
+	MaxAddressSpace     Limit // bytes
+	MaxFileLocks        Limit // locks
+	MaxPendingSignals   Limit // signals
+	MaxMsgqueueSize     Limit // bytes
+	MaxNicePriority     Limit
+	MaxRealtimePriority Limit
+	MaxRealtimeTimeout  Limit // us
+}
+
+// limitFields maps the row names in /proc/PID/limits to their field in a
+// ProcessLimits.
+var limitFields = map[string]func(*ProcessLimits) *Limit{
+	"Max cpu time":          func(pl *ProcessLimits) *Limit { return &pl.MaxCPUTime },
+	"Max file size":         func(pl *ProcessLimits) *Limit { return &pl.MaxFileSize },
+	"Max data size":         func(pl *ProcessLimits) *Limit { return &pl.MaxDataSize },
+	"Max stack size":        func(pl *ProcessLimits) *Limit { return &pl.MaxStackSize },
+	"Max core file size":    func(pl *ProcessLimits) *Limit { return &pl.MaxCoreFileSize },
+	"Max resident set":      func(pl *ProcessLimits) *Limit { return &pl.MaxResidentSet },
+	"Max processes":         func(pl *ProcessLimits) *Limit { return &pl.MaxProcesses },
+	"Max open files":        func(pl *ProcessLimits) *Limit { return &pl.MaxOpenFiles },
+	"Max locked memory":     func(pl *ProcessLimits) *Limit { return &pl.MaxLockedMemory },
+	"Max address space":     func(pl *ProcessLimits) *Limit { return &pl.MaxAddressSpace },
+	"Max file locks":        func(pl *ProcessLimits) *Limit { return &pl.MaxFileLocks },
+	"Max pending signals":   func(pl *ProcessLimits) *Limit { return &pl.MaxPendingSignals },
+	"Max msgqueue size":     func(pl *ProcessLimits) *Limit { return &pl.MaxMsgqueueSize },
+	"Max nice priority":     func(pl *ProcessLimits) *Limit { return &pl.MaxNicePriority },
+	"Max realtime priority": func(pl *ProcessLimits) *Limit { return &pl.MaxRealtimePriority },
+	"Max realtime timeout":  func(pl *ProcessLimits) *Limit { return &pl.MaxRealtimeTimeout },
+}
+
+// limitColumns separates the columns of a line in /proc/PID/limits.  Row names
+// contain single spaces so columns are separated by two or more spaces.
+var limitColumns = regexp.MustCompile(`\s\s+`)
+
+// ProcLimits returns the resource limits of process pid as read from
+// /proc/PID/limits.
+func ProcLimits(pid int) (*ProcessLimits, error) {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/limits")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseLimits(f)
+}
+
+// ParseLimits parses r, which is in the format of /proc/PID/limits.
+// Unrecognized rows are ignored.
+func ParseLimits(r io.Reader) (*ProcessLimits, error) {
+	pl := &ProcessLimits{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		cols := limitColumns.Split(strings.TrimSpace(s.Text()), -1)
+		if len(cols) < 3 {
+			continue
+		}
+		field, ok := limitFields[cols[0]]
+		if !ok {
+			continue
+		}
+		soft, err := parseLimit(cols[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cols[0], err)
+		}
+		hard, err := parseLimit(cols[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cols[0], err)
+		}
+		*field(pl) = Limit{Soft: soft, Hard: hard}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return pl, nil
+}
+
+// parseLimit parses a single limit value.
+func parseLimit(s string) (uint64, error) {
+	if s == "unlimited" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
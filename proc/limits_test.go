@@ -0,0 +1,77 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+var limitsData = `Limit                     Soft Limit           Hard Limit           Units     
+Max cpu time              unlimited            unlimited            seconds   
+Max file size             unlimited            unlimited            bytes     
+Max data size             unlimited            unlimited            bytes     
+Max stack size            8388608              unlimited            bytes     
+Max core file size        0                    unlimited            bytes     
+Max resident set          unlimited            unlimited            bytes     
+Max processes             63288                63288                processes 
+Max open files            1024                 1048576              files     
+Max locked memory         65536                65536                bytes     
+Max address space         unlimited            unlimited            bytes     
+Max file locks            unlimited            unlimited            locks     
+Max pending signals       63288                63288                signals   
+Max msgqueue size         819200               819200               bytes     
+Max nice priority         0                    0                    
+Max realtime priority     0                    0                    
+Max realtime timeout      unlimited            unlimited            us        
+`
+
+func TestParseLimits(t *testing.T) {
+	pl, err := ParseLimits(strings.NewReader(limitsData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		got  Limit
+		want Limit
+	}{
+		{"MaxOpenFiles", pl.MaxOpenFiles, Limit{1024, 1048576}},
+		{"MaxStackSize", pl.MaxStackSize, Limit{8388608, math.MaxUint64}},
+		{"MaxCPUTime", pl.MaxCPUTime, Limit{math.MaxUint64, math.MaxUint64}},
+		{"MaxCoreFileSize", pl.MaxCoreFileSize, Limit{0, math.MaxUint64}},
+		{"MaxNicePriority", pl.MaxNicePriority, Limit{0, 0}},
+		{"MaxRealtimeTimeout", pl.MaxRealtimeTimeout, Limit{math.MaxUint64, math.MaxUint64}},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if _, err := ParseLimits(strings.NewReader("Max open files  many  1024  files\n")); err == nil {
+		t.Errorf("did not get an error for a bad limit")
+	}
+}
+
+func TestProcLimits(t *testing.T) {
+	if _, err := os.Stat("/proc/self/limits"); err != nil {
+		t.Skip("no /proc/self/limits")
+	}
+	if _, err := ProcLimits(os.Getpid()); err != nil {
+		t.Error(err)
+	}
+}
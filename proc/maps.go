@@ -0,0 +1,129 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A MemoryRegion is a mapped region of virtual memory from /proc/PID/maps.
+type MemoryRegion struct {
+	Start       uint64
+	End         uint64
+	Permissions string // e.g., "r-xp"
+	Offset      uint64
+	DevMajor    uint32
+	DevMinor    uint32
+	Inode       uint64
+	Pathname    string // file, pseudo-path such as [stack], or ""
+}
+
+// IsExecutable returns true if the region may be executed.
+func (r *MemoryRegion) IsExecutable() bool {
+	return len(r.Permissions) > 2 && r.Permissions[2] == 'x'
+}
+
+// ProcMaps returns the memory regions of process pid as read from
+// /proc/PID/maps.
+func ProcMaps(pid int) ([]*MemoryRegion, error) {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/maps")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMaps(f)
+}
+
+// ParseMaps parses r, which is in the format of /proc/PID/maps.  Each line is
+//
+//	start-end perms offset major:minor inode [pathname]
+//
+// The pathname is optional and may contain spaces.
+func ParseMaps(r io.Reader) ([]*MemoryRegion, error) {
+	var regions []*MemoryRegion
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		region, err := parseMapsLine(line)
+		if err != nil {
+			return nil, err
+		}
+		regions = append(regions, region)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+// parseMapsLine parses a single line from /proc/PID/maps.
+func parseMapsLine(line string) (*MemoryRegion, error) {
+	var fields [5]string
+	rest := line
+	for i := range fields {
+		rest = strings.TrimLeft(rest, " \t")
+		x := strings.IndexAny(rest, " \t")
+		if x < 0 {
+			x = len(rest)
+		}
+		fields[i], rest = rest[:x], rest[x:]
+		if fields[i] == "" {
+			return nil, fmt.Errorf("short maps line %q", line)
+		}
+	}
+	r := &MemoryRegion{
+		Permissions: fields[1],
+		Pathname:    strings.TrimSpace(rest),
+	}
+	var err error
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return nil, fmt.Errorf("bad address range %q", fields[0])
+	}
+	if r.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+		return nil, fmt.Errorf("bad address range %q", fields[0])
+	}
+	if r.End, err = strconv.ParseUint(end, 16, 64); err != nil {
+		return nil, fmt.Errorf("bad address range %q", fields[0])
+	}
+	if r.Offset, err = strconv.ParseUint(fields[2], 16, 64); err != nil {
+		return nil, fmt.Errorf("bad offset %q", fields[2])
+	}
+	major, minor, ok := strings.Cut(fields[3], ":")
+	if !ok {
+		return nil, fmt.Errorf("bad device %q", fields[3])
+	}
+	maj, err := strconv.ParseUint(major, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad device %q", fields[3])
+	}
+	min, err := strconv.ParseUint(minor, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("bad device %q", fields[3])
+	}
+	r.DevMajor, r.DevMinor = uint32(maj), uint32(min)
+	if r.Inode, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+		return nil, fmt.Errorf("bad inode %q", fields[4])
+	}
+	return r, nil
+}
@@ -0,0 +1,80 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var mapsData = `55d4c8a00000-55d4c8a21000 rw-p 00000000 00:00 0                          [heap]
+7f3b2c000000-7f3b2c1b5000 r-xp 00028000 fd:01 1054237                    /usr/lib/x86_64-linux-gnu/libc.so.6
+7f3b2c400000-7f3b2c401000 rw-s 00000000 00:05 42                         /memfd:name with spaces (deleted)
+7f3b2c500000-7f3b2c501000 r--p 00000000 00:00 0
+7ffd1a2b3000-7ffd1a2d4000 rw-p 00000000 00:00 0                          [stack]
+`
+
+func TestParseMaps(t *testing.T) {
+	regions, err := ParseMaps(strings.NewReader(mapsData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*MemoryRegion{
+		{Start: 0x55d4c8a00000, End: 0x55d4c8a21000, Permissions: "rw-p", Pathname: "[heap]"},
+		{
+			Start:       0x7f3b2c000000,
+			End:         0x7f3b2c1b5000,
+			Permissions: "r-xp",
+			Offset:      0x28000,
+			DevMajor:    0xfd,
+			DevMinor:    1,
+			Inode:       1054237,
+			Pathname:    "/usr/lib/x86_64-linux-gnu/libc.so.6",
+		},
+		{Start: 0x7f3b2c400000, End: 0x7f3b2c401000, Permissions: "rw-s", DevMinor: 5, Inode: 42, Pathname: "/memfd:name with spaces (deleted)"},
+		{Start: 0x7f3b2c500000, End: 0x7f3b2c501000, Permissions: "r--p"},
+		{Start: 0x7ffd1a2b3000, End: 0x7ffd1a2d4000, Permissions: "rw-p", Pathname: "[stack]"},
+	}
+	if len(regions) != len(want) {
+		t.Fatalf("got %d regions, want %d", len(regions), len(want))
+	}
+	for i, r := range regions {
+		if !reflect.DeepEqual(r, want[i]) {
+			t.Errorf("#%d: got %+v, want %+v", i, r, want[i])
+		}
+	}
+	if !regions[1].IsExecutable() || regions[0].IsExecutable() {
+		t.Errorf("IsExecutable is wrong")
+	}
+
+	if _, err := ParseMaps(strings.NewReader("7f00-7f01 r-xp 0 00:00\n")); err == nil {
+		t.Errorf("short line did not return an error")
+	}
+}
+
+func TestProcMaps(t *testing.T) {
+	regions, err := ProcMaps(os.Getpid())
+	if err != nil {
+		t.Skipf("cannot read maps: %v", err)
+	}
+	for _, r := range regions {
+		if r.Pathname == "[stack]" {
+			return
+		}
+	}
+	t.Errorf("no stack region found")
+}
@@ -0,0 +1,157 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A TCPState is the state of a TCP connection as reported by the kernel.
+type TCPState int
+
+const (
+	TCPEstablished TCPState = iota + 1
+	TCPSynSent
+	TCPSynRecv
+	TCPFinWait1
+	TCPFinWait2
+	TCPTimeWait
+	TCPClose
+	TCPCloseWait
+	TCPLastAck
+	TCPListen
+	TCPClosing
+	TCPNewSynRecv
+)
+
+var tcpStateNames = map[TCPState]string{
+	TCPEstablished: "ESTABLISHED",
+	TCPSynSent:     "SYN_SENT",
+	TCPSynRecv:     "SYN_RECV",
+	TCPFinWait1:    "FIN_WAIT1",
+	TCPFinWait2:    "FIN_WAIT2",
+	TCPTimeWait:    "TIME_WAIT",
+	TCPClose:       "CLOSE",
+	TCPCloseWait:   "CLOSE_WAIT",
+	TCPLastAck:     "LAST_ACK",
+	TCPListen:      "LISTEN",
+	TCPClosing:     "CLOSING",
+	TCPNewSynRecv:  "NEW_SYN_RECV",
+}
+
+func (s TCPState) String() string {
+	if name, ok := tcpStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("TCPState(%d)", int(s))
+}
+
+// A TCPConnection is a single TCP socket from /proc/net/tcp or /proc/net/tcp6.
+type TCPConnection struct {
+	LocalAddr  net.TCPAddr
+	RemoteAddr net.TCPAddr
+	State      TCPState
+	UID        uint32
+	Inode      uint64
+}
+
+// NetTCP returns the IPv4 TCP sockets found in /proc/net/tcp.
+func NetTCP() ([]*TCPConnection, error) {
+	return readNetTCP("/proc/net/tcp")
+}
+
+// NetTCP6 returns the IPv6 TCP sockets found in /proc/net/tcp6.
+func NetTCP6() ([]*TCPConnection, error) {
+	return readNetTCP("/proc/net/tcp6")
+}
+
+func readNetTCP(path string) ([]*TCPConnection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseNetTCP(f)
+}
+
+// ParseNetTCP parses r, which is in the format of /proc/net/tcp or
+// /proc/net/tcp6.
+func ParseNetTCP(r io.Reader) ([]*TCPConnection, error) {
+	var conns []*TCPConnection
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		// Skip the header and any short lines.
+		if len(fields) < 10 || fields[0] == "sl" {
+			continue
+		}
+		var c TCPConnection
+		var err error
+		if c.LocalAddr, err = parseTCPAddr(fields[1]); err != nil {
+			return nil, err
+		}
+		if c.RemoteAddr, err = parseTCPAddr(fields[2]); err != nil {
+			return nil, err
+		}
+		state, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad state %q", fields[3])
+		}
+		c.State = TCPState(state)
+		uid, err := strconv.ParseUint(fields[7], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad uid %q", fields[7])
+		}
+		c.UID = uint32(uid)
+		if c.Inode, err = strconv.ParseUint(fields[9], 10, 64); err != nil {
+			return nil, fmt.Errorf("bad inode %q", fields[9])
+		}
+		conns = append(conns, &c)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return conns, nil
+}
+
+// parseTCPAddr parses an address of the form ADDR:PORT where ADDR is either 8
+// or 32 hex digits and PORT is 4 hex digits.  The address is made up of 32 bit
+// words in host (little endian) byte order.
+func parseTCPAddr(s string) (net.TCPAddr, error) {
+	x := strings.IndexByte(s, ':')
+	if x < 0 {
+		return net.TCPAddr{}, fmt.Errorf("bad address %q", s)
+	}
+	ip, err := hex.DecodeString(s[:x])
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return net.TCPAddr{}, fmt.Errorf("bad address %q", s)
+	}
+	port, err := strconv.ParseUint(s[x+1:], 16, 16)
+	if err != nil {
+		return net.TCPAddr{}, fmt.Errorf("bad port %q", s)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(ip[i:]))
+	}
+	return net.TCPAddr{IP: net.IP(ip), Port: int(port)}, nil
+}
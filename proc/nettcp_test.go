@@ -0,0 +1,107 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+var netTCPData = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:BC8F 00000000:0000 0A 00000000:00000000 00:00000000 00000000 65534        0 911 1 0000000078e99842 100 0 0 10 0
+   1: 0F02000A:0016 0102000A:D431 01 00000000:00000000 02:000A7B2E 00000000     0        0 23456 4 0000000000000000 20 4 29 10 -1
+`
+
+var netTCP6Data = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000001000000:0277 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4242 1 0000000000000000 100 0 0 10 0
+`
+
+func TestParseNetTCP(t *testing.T) {
+	conns, err := ParseNetTCP(strings.NewReader(netTCPData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TCPConnection{
+		{
+			LocalAddr:  net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0xBC8F},
+			RemoteAddr: net.TCPAddr{IP: net.IPv4(0, 0, 0, 0), Port: 0},
+			State:      TCPListen,
+			UID:        65534,
+			Inode:      911,
+		},
+		{
+			LocalAddr:  net.TCPAddr{IP: net.IPv4(10, 0, 2, 15), Port: 22},
+			RemoteAddr: net.TCPAddr{IP: net.IPv4(10, 0, 2, 1), Port: 0xD431},
+			State:      TCPEstablished,
+			UID:        0,
+			Inode:      23456,
+		},
+	}
+	if len(conns) != len(want) {
+		t.Fatalf("got %d connections, want %d", len(conns), len(want))
+	}
+	for i, c := range conns {
+		w := want[i]
+		if !c.LocalAddr.IP.Equal(w.LocalAddr.IP) || c.LocalAddr.Port != w.LocalAddr.Port {
+			t.Errorf("#%d: got local address %v, want %v", i, &c.LocalAddr, &w.LocalAddr)
+		}
+		if !c.RemoteAddr.IP.Equal(w.RemoteAddr.IP) || c.RemoteAddr.Port != w.RemoteAddr.Port {
+			t.Errorf("#%d: got remote address %v, want %v", i, &c.RemoteAddr, &w.RemoteAddr)
+		}
+		if c.State != w.State {
+			t.Errorf("#%d: got state %v, want %v", i, c.State, w.State)
+		}
+		if c.UID != w.UID {
+			t.Errorf("#%d: got uid %d, want %d", i, c.UID, w.UID)
+		}
+		if c.Inode != w.Inode {
+			t.Errorf("#%d: got inode %d, want %d", i, c.Inode, w.Inode)
+		}
+	}
+}
+
+func TestParseNetTCP6(t *testing.T) {
+	conns, err := ParseNetTCP(strings.NewReader(netTCP6Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conns) != 1 {
+		t.Fatalf("got %d connections, want 1", len(conns))
+	}
+	c := conns[0]
+	if !c.LocalAddr.IP.Equal(net.IPv6loopback) || c.LocalAddr.Port != 631 {
+		t.Errorf("got local address %v, want [::1]:631", &c.LocalAddr)
+	}
+	if c.State != TCPListen {
+		t.Errorf("got state %v, want %v", c.State, TCPListen)
+	}
+}
+
+func TestTCPStateString(t *testing.T) {
+	for _, tt := range []struct {
+		state TCPState
+		want  string
+	}{
+		{TCPEstablished, "ESTABLISHED"},
+		{TCPListen, "LISTEN"},
+		{TCPTimeWait, "TIME_WAIT"},
+		{TCPState(99), "TCPState(99)"},
+	} {
+		if got := tt.state.String(); got != tt.want {
+			t.Errorf("%d: got %q, want %q", int(tt.state), got, tt.want)
+		}
+	}
+}
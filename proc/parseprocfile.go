@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ParseProcFile parses file f storing the results in the matching fields in the
@@ -29,13 +30,17 @@ import (
 // each line (terminated by whitespace or a :) is converted by GoName.  If the
 // resulting name matches a field in iv then the string following is parsed and
 // stored into the appropriate field.  The type of the field determines how the
-// value is parsed.  Only numeric, string, and numeric slices are supported.
+// value is parsed.  Only numeric, bool, string, and numeric slices are
+// supported.
 //
 // For slices the values are separated by one or more white space or comma
 // characters.  (See below for changing the comma to a different value)
 //
 // Strings have leading and trailing white space stripped.
 //
+// Bools are true for 1, yes, true, and enabled, and false for 0, no, false,
+// and disabled.  Case is ignored.
+//
 // Numeric values can optionally have a scaling factor after the numeric
 // portion.  The known scaling factors are:
 //
@@ -48,6 +53,10 @@ import (
 // For numbers the base of the number can be expressed as base:"16" Bases 2 - 36
 // are supported.  For slices the delimiter can be set with delim:"/"
 //
+// A time.Duration field with a unit tag, e.g., unit:"ns", is parsed as a
+// number of that unit.  The number may be followed by a unit of ns, us, ms,
+// or s, which is used instead of the unit tag.
+//
 // Example fields:
 //
 //	Field int     // a base 10 number
@@ -56,6 +65,8 @@ import (
 //	Field []int   `delim:"/"` // a slice of numbers deliminted by /
 //	Field string  // a string (trimmed)
 //	Field float32 // a 32 bit float
+//	Field bool    // yes or no
+//	Field time.Duration `unit:"ms"` // a number of milliseconds
 func ParseProcFile(f io.Reader, iv interface{}) error {
 	r := bufio.NewReader(f)
 	v := reflect.ValueOf(iv).Elem()
@@ -109,11 +120,17 @@ func ParseProcFile(f io.Reader, iv interface{}) error {
 		case reflect.Int32:
 			line, err = getInt(line, tf, f, 32)
 		case reflect.Int64:
-			line, err = getInt(line, tf, f, 64)
+			if tf.Tag.Get("unit") != "" {
+				line, err = getDuration(line, tf, f)
+			} else {
+				line, err = getInt(line, tf, f, 64)
+			}
 		case reflect.Float32:
 			line, err = getFloat(line, tf, f, 32)
 		case reflect.Float64:
 			line, err = getFloat(line, tf, f, 64)
+		case reflect.Bool:
+			line, err = getBool(line, f)
 		case reflect.Slice:
 			var a reflect.Value
 			switch f.Type().Elem().Kind() {
@@ -231,6 +248,55 @@ func getFloat(line string, t reflect.StructField, f reflect.Value, bits int) (st
 	return strings.TrimLeft(line[x:], " \t"), nil
 }
 
+// getDuration parses one duration from line placing the value in f.  t is
+// the StructField that f came from.  The unit tag in t is the unit of the
+// number unless the number is followed by a unit.  The remaining part of the
+// line is returned.
+func getDuration(line string, t reflect.StructField, f reflect.Value) (string, error) {
+	var x int
+
+	tag := t.Tag.Get("unit")
+	unit, ok := durationUnits[tag]
+	if !ok {
+		return line, errors.New("invalid unit: " + tag)
+	}
+	if x = strings.IndexAny(line, " \t"); x < 0 {
+		x = len(line)
+	}
+	value, err := strconv.ParseInt(line[:x], 10, 64)
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimLeft(line[x:], " \t")
+
+	if scale, rest := getDurationScale(line); scale != 0 {
+		unit, line = scale, rest
+	}
+	f.SetInt(value * int64(unit))
+	return line, nil
+}
+
+// getBool parses one bool from line placing the value in f.  The remaining
+// part of the line is returned.
+func getBool(line string, f reflect.Value) (string, error) {
+	var x int
+
+	if x = strings.IndexAny(line, " \t"); x < 0 {
+		x = len(line)
+	}
+
+	switch strings.ToLower(line[:x]) {
+	case "1", "yes", "true", "enabled":
+		f.SetBool(true)
+	case "0", "no", "false", "disabled":
+		f.SetBool(false)
+	default:
+		return "", fmt.Errorf("%q: invalid bool", line[:x])
+	}
+	return strings.TrimLeft(line[x:], " \t"), nil
+}
+
 // getSlice parses line as a list of numbers separated by white space or commas
 // and returns the result as a reflect.Value slice.  bits specifies the number
 // of bits allowed in the number.  Type type of elements in the slice are
@@ -275,6 +341,28 @@ func getBase(f reflect.StructField) (int, error) {
 	return int(ubase), err
 }
 
+// durationUnits maps the units understood by getDuration to their duration.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// getDurationScale parses the first word of line as a unit of time (i.e.,
+// "ns", "us", "ms", or "s") and returns its duration and the remaining portion
+// of line.  If line does not start with a unit then 0 and line are returned.
+func getDurationScale(line string) (time.Duration, string) {
+	x := strings.IndexAny(line, " \t")
+	if x < 0 {
+		x = len(line)
+	}
+	if d, ok := durationUnits[line[:x]]; ok {
+		return d, strings.TrimLeft(line[x:], " \t")
+	}
+	return 0, line
+}
+
 // getScale parses line as a scaling suffix (i.e., "kB" or "mB") and returns its
 // scale (i.e., 1024 or 1024*1024) and the remaining portion of line.  If line
 // is empty or is unrecognized then 1 and line are returned.
@@ -20,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 var parseTests = []struct {
@@ -279,6 +280,51 @@ var parseTests = []struct {
 		in:   `Field: 10.5 11.5 12.5`,
 		out:  &struct{ Field []float64 }{[]float64{10.5, 11.5, 12.5}},
 	},
+	{
+		name: "bool-yes",
+		in:   `Field: yes`,
+		out:  &struct{ Field bool }{true},
+	},
+	{
+		name: "bool-0",
+		in:   `Field: 0`,
+		out:  &struct{ Field bool }{false},
+	},
+	{
+		name: "bool-case",
+		in:   "One: Enabled\nTwo: FALSE\nThree: 1\n",
+		out:  &struct{ One, Two, Three bool }{true, false, true},
+	},
+	{
+		name: "duration-suffix",
+		in:   `Latency: 500 us`,
+		out: &struct {
+			Latency time.Duration `unit:"ns"`
+		}{500 * time.Microsecond},
+	},
+	{
+		name: "duration-unit",
+		in:   "Fast: 12345\nSlow: 3\nLong: 2 s\n",
+		out: &struct {
+			Fast time.Duration `unit:"ns"`
+			Slow time.Duration `unit:"ms"`
+			Long time.Duration `unit:"ms"`
+		}{12345, 3 * time.Millisecond, 2 * time.Second},
+	},
+	{
+		name: "bad-unit",
+		in:   `Latency: 500`,
+		out: &struct {
+			Latency time.Duration `unit:"fortnight"`
+		}{},
+		err: `invalid unit: fortnight`,
+	},
+	{
+		name: "bad-bool",
+		in:   `Field: maybe`,
+		out:  &struct{ Field bool }{},
+		err:  `"maybe": invalid bool`,
+	},
 
 	{
 		name: "bad-number",
@@ -16,15 +16,48 @@ package proc
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 // TickDuration is the duration of a single system tick
-var TickDuration = time.Second / time.Duration(Sysconf(SCClkTck))
+var TickDuration = tickDuration()
+
+// defaultClockTicks is the number of ticks per second assumed when
+// SysconfImpl cannot report it.  It is the usual value of USER_HZ.
+const defaultClockTicks = 100
+
+// tickDuration returns the duration of a tick as reported by SysconfImpl.
+func tickDuration() time.Duration {
+	n, err := SysconfImpl(int(SCClkTck))
+	if err != nil || n <= 0 {
+		n = defaultClockTicks
+	}
+	return time.Second / time.Duration(n)
+}
+
+// ErrDurationOverflow is returned when a number of ticks is too large to be
+// represented as a time.Duration.
+var ErrDurationOverflow = errors.New("duration overflows time.Duration")
+
+// ticks returns n ticks of length tick as a time.Duration.  An error wrapping
+// ErrDurationOverflow is returned if the result does not fit.
+func ticks(n uint64, tick time.Duration) (time.Duration, error) {
+	if tick > 0 && n > uint64(math.MaxInt64/int64(tick)) {
+		return 0, fmt.Errorf("%d ticks: %w", n, ErrDurationOverflow)
+	}
+	return tick * time.Duration(n), nil
+}
 
 // A CPU contains the information of a singe cpu line from /proc/stat.
 // All values are in "jiffies".
@@ -69,23 +102,50 @@ const (
 
 )
 
+// statFile is the path of the system stat file.  It is a variable for testing.
+var statFile = "/proc/stat"
+
 // SystemStat returns the parsed contents of the /proc/stat.  The what argument
 // determines what information is parsed.  An error is returned if there was an
 // error reading /proc/stat.  Unrecognized data in /proc/stat is ignored.
 func SystemStat(what StatType) (*Stat, error) {
-	var lastErr error
+	data, err := StatFileReader()
+	if err != nil {
+		return nil, err
+	}
+	return NewStat(what, data)
+}
+
+// StatFileReader returns the contents of /proc/stat for SystemStat.  Tests may
+// replace it to supply synthetic data.
+var StatFileReader = readStatFile
+
+// readStatFile reads all of statFile, retrying if it cannot be opened.
+func readStatFile() ([]byte, error) {
+	var fd *os.File
+	var err error
 	for i := 1; ; i++ {
-		data, err := ioutil.ReadFile("/proc/stat")
-		if err == nil {
-			return NewStat(what, data)
+		if fd, err = os.Open(statFile); err == nil {
+			break
 		}
-		lastErr = err
 		if i == maxRetries {
-			break
+			return nil, err
 		}
 		time.Sleep(retryInterval)
 	}
-	return nil, lastErr
+	defer fd.Close()
+	return io.ReadAll(fd)
+}
+
+// SystemStatReader is like SystemStat but reads data in the format of
+// /proc/stat from r.  The data is read in full, however large, before it is
+// parsed by NewStat.
+func SystemStatReader(what StatType, r io.Reader) (*Stat, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewStat(what, data)
 }
 
 // NewStat returns a new instance of Stat based on the given StatType and data
@@ -244,6 +304,84 @@ func (cpu *CPU) Delta(old *CPU) *CPU {
 	}
 }
 
+// Delta returns a new Stat that is equal to s - old.  CPUs, Interrupts and
+// SoftInterrupts are matched by index and only entries found in both s and old
+// are included.  BootTime is copied from s.
+func (s *Stat) Delta(old *Stat) *Stat {
+	d := &Stat{
+		BootTime:        s.BootTime,
+		ContextSwitches: s.ContextSwitches - old.ContextSwitches,
+		Processes:       s.Processes - old.Processes,
+		Runnable:        s.Runnable - old.Runnable,
+		Blocked:         s.Blocked - old.Blocked,
+		Interrupts:      deltas(s.Interrupts, old.Interrupts),
+		SoftInterrupts:  deltas(s.SoftInterrupts, old.SoftInterrupts),
+	}
+	for i, cpu := range s.CPUs {
+		if i >= len(old.CPUs) {
+			break
+		}
+		d.CPUs = append(d.CPUs, cpu.Delta(old.CPUs[i]))
+	}
+	return d
+}
+
+// deltas returns the element-wise difference of new and old.
+func deltas(new, old []int64) []int64 {
+	if new == nil || old == nil {
+		return nil
+	}
+	n := len(new)
+	if len(old) < n {
+		n = len(old)
+	}
+	d := make([]int64, n)
+	for i := range d {
+		d[i] = new[i] - old[i]
+	}
+	return d
+}
+
+// WatchStat reads /proc/stat every interval and sends the difference from
+// the previous read on the returned channel.  The first value sent is the
+// stat itself rather than a difference.  The channel is closed when ctx is
+// cancelled.  Reads that fail after the first are skipped.
+func WatchStat(ctx context.Context, interval time.Duration, what StatType) (<-chan *Stat, error) {
+	last, err := SystemStat(what)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *Stat)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		send := last
+		for {
+			select {
+			case ch <- send:
+			case <-ctx.Done():
+				return
+			}
+			for {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+				s, err := SystemStat(what)
+				if err != nil {
+					continue
+				}
+				send = s.Delta(last)
+				last = s
+				break
+			}
+		}
+	}()
+	return ch, nil
+}
+
 // A ProcessStat structure contains the information read from /proc/PID/stat.
 type ProcessStat struct {
 	Pid              int           // The process ID
@@ -303,7 +441,7 @@ var stateMap = map[string]string{
 }
 
 // ProcStat returns the contents of /proc/PID/stat as a ProcessStat.
-func ProcStat(pid int) (_ *ProcessStat, err error) {
+func ProcStat(pid int) (*ProcessStat, error) {
 	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
 	if err != nil {
 		return nil, err
@@ -311,14 +449,127 @@ func ProcStat(pid int) (_ *ProcessStat, err error) {
 	if len(data) == 0 {
 		return nil, fmt.Errorf("process %d missing stat data", pid)
 	}
-	if data[len(data)-1] == '\n' {
-		data = data[:len(data)-1]
+	return ParseProcStat(data)
+}
+
+// TTYNumber returns the ControllingTTY value of the terminal with the device
+// numbers major and minor.  The minor number is stored in bits 31 to 20 and 7
+// to 0 and the major number in bits 15 to 8.
+func TTYNumber(major, minor uint32) int {
+	return int((minor & 0xff) | (major&0xff)<<8 | (minor&^0xff)<<12)
+}
+
+// TTYDevice returns the major and minor device numbers of p.ControllingTTY.
+func (p *ProcessStat) TTYDevice() (major, minor uint32) {
+	n := uint32(p.ControllingTTY)
+	return (n >> 8) & 0xff, (n & 0xff) | (n>>12)&^0xff
+}
+
+// TTYNumberOf returns the ControllingTTY value of the terminal device at path.
+func TTYNumberOf(path string) (int, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFCHR {
+		return 0, fmt.Errorf("%s: not a character device", path)
+	}
+	// Decode the major and minor numbers from the C library's dev_t.
+	dev := uint64(st.Rdev)
+	major := uint32((dev>>8)&0xfff | (dev>>32)&^0xfff)
+	minor := uint32(dev&0xff | (dev>>12)&^0xff)
+	return TTYNumber(major, minor), nil
+}
+
+// statWorkers is the number of goroutines AllProcStatsPIDs uses to read stat
+// files.
+const statWorkers = 8
+
+// AllProcStats returns the ProcessStat of every process in /proc, indexed by
+// pid.
+func AllProcStats() (map[int]*ProcessStat, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	return AllProcStatsPIDs(pids)
+}
+
+// AllProcStatsPIDs returns the ProcessStat of each process in pids, indexed by
+// pid.  The stat files are read concurrently.  Processes that no longer exist
+// are not included.  If any other error is encountered the first such error is
+// returned along with the stats that were read.
+func AllProcStatsPIDs(pids []int) (map[int]*ProcessStat, error) {
+	type result struct {
+		pid  int
+		stat *ProcessStat
+		err  error
+	}
+	work := make(chan int)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < statWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pid := range work {
+				st, err := ProcStat(pid)
+				results <- result{pid: pid, stat: st, err: err}
+			}
+		}()
+	}
+	go func() {
+		for _, pid := range pids {
+			work <- pid
+		}
+		close(work)
+		wg.Wait()
+		close(results)
+	}()
+
+	stats := make(map[int]*ProcessStat, len(pids))
+	var err error
+	for r := range results {
+		switch {
+		case r.err == nil:
+			stats[r.pid] = r.stat
+		case os.IsNotExist(r.err), errors.Is(r.err, syscall.ESRCH):
+			// The process exited.
+		case err == nil:
+			err = r.err
+		}
+	}
+	return stats, err
+}
+
+// statFields splits the contents of a /proc/PID/stat file into its fields.
+// The second field, the command name, is enclosed in parentheses and may
+// contain spaces and parentheses of its own.  It is returned without the
+// enclosing parentheses.
+func statFields(s string) []string {
+	lp := strings.IndexByte(s, '(')
+	rp := strings.LastIndexByte(s, ')')
+	if lp < 0 || rp < lp {
+		return strings.Fields(s)
 	}
+	fields := strings.Fields(s[:lp])
+	fields = append(fields, s[lp+1:rp])
+	return append(fields, strings.Fields(s[rp+1:])...)
+}
 
+// ParseProcStat parses data, the contents of a /proc/PID/stat file, as a
+// ProcessStat.
+func ParseProcStat(data []byte) (_ *ProcessStat, err error) {
 	// The data from the stat file consists of a single line of space
 	// separated fields.  47 fields were defined in the production linux
 	// kernel at the time this module was written.
-	fields := strings.Fields(string(data))
+	fields := statFields(strings.TrimSuffix(string(data), "\n"))
 	n := len(fields)
 
 	// We use a panic with a procError to bail out of processing when we
@@ -361,19 +612,20 @@ func ProcStat(pid int) (_ *ProcessStat, err error) {
 
 	// Some fields are documented to be in terms of _SC_CLK_TICK while
 	// others are documented to be in terms of 1/100ths of a second.
-	getDuration := func() time.Duration {
-		return TickDuration * time.Duration(getLU())
-	}
-	getDuration100 := func() time.Duration {
-		return (time.Second / 100) * time.Duration(getLU())
+	getTicks := func(tick time.Duration) time.Duration {
+		d, err := ticks(getLU(), tick)
+		if err != nil {
+			panic(procError{err})
+		}
+		return d
 	}
+	getDuration := func() time.Duration { return getTicks(TickDuration) }
+	getDuration100 := func() time.Duration { return getTicks(time.Second / 100) }
 
 	var p ProcessStat
 	switch n {
 	case 0:
-		// it is not possible for strings.Fields to return a value that
-		// has a length of 0.
-		panic("unreachable")
+		return nil, fmt.Errorf("missing stat data")
 	default:
 		// We only understand the first 47 fields.  We need to trim
 		// off the trailing fields (if they exist) so that the getLU
@@ -523,11 +775,6 @@ func ProcStat(pid int) (_ *ProcessStat, err error) {
 		fallthrough
 	case 2:
 		p.Command = getS()
-		if len(p.Command) > 1 {
-			if p.Command[0] == '(' && p.Command[len(p.Command)-1] == ')' {
-				p.Command = p.Command[1 : len(p.Command)-1]
-			}
-		}
 		fallthrough
 	case 1:
 		p.Pid = getD()
@@ -546,7 +793,7 @@ func ProcStartTime(pid int) (time.Duration, error) {
 	if len(data) == 0 {
 		return 0, fmt.Errorf("process %d missing stat data", pid)
 	}
-	fields := strings.Fields(string(data))
+	fields := statFields(string(data))
 
 	// We know StartTime to be the 22nd field.
 	if len(fields) < 22 {
@@ -556,5 +803,5 @@ func ProcStartTime(pid int) (time.Duration, error) {
 	if err != nil {
 		return 0, err
 	}
-	return TickDuration * time.Duration(n), nil
+	return ticks(n, TickDuration)
 }
@@ -15,11 +15,16 @@
 package proc
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"syscall"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -105,6 +110,167 @@ func TestSystemStat(t *testing.T) {
 	}
 }
 
+func TestSystemStatReader(t *testing.T) {
+	// Enough CPUs that the data is larger than a single read.
+	const ncpu = 1024
+	var b strings.Builder
+	b.WriteString("cpu  1024 0 0 0 0 0 0 0 0 0\n")
+	for i := 0; i < ncpu; i++ {
+		fmt.Fprintf(&b, "cpu%d 1 0 0 0 0 0 0 0 0 0\n", i)
+	}
+	b.WriteString("btime 1373498362\n")
+
+	s, err := SystemStatReader(StatCPUs|StatBootTime, strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.CPUs) != ncpu+1 {
+		t.Fatalf("got %d CPUs, want %d", len(s.CPUs), ncpu+1)
+	}
+	if s.CPUs[0].Total != ncpu || s.CPUs[ncpu].Total != 1 {
+		t.Errorf("got totals %d and %d, want %d and 1", s.CPUs[0].Total, s.CPUs[ncpu].Total, ncpu)
+	}
+	if !s.BootTime.Equal(time.Unix(1373498362, 0)) {
+		t.Errorf("got boot time %v", s.BootTime)
+	}
+
+	readErr := errors.New("read error")
+	if _, err := SystemStatReader(StatAll, iotest.ErrReader(readErr)); err != readErr {
+		t.Errorf("got error %v, want %v", err, readErr)
+	}
+}
+
+func TestStatFileReader(t *testing.T) {
+	defer func(f func() ([]byte, error)) { StatFileReader = f }(StatFileReader)
+
+	StatFileReader = func() ([]byte, error) {
+		return []byte("btime 1373498362\nprocs_running 7\n"), nil
+	}
+	s, err := SystemStat(StatAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.BootTime.Equal(time.Unix(1373498362, 0)) {
+		t.Errorf("got boot time %v", s.BootTime)
+	}
+	if s.Runnable != 7 {
+		t.Errorf("got %d runnable processes, want 7", s.Runnable)
+	}
+
+	readErr := errors.New("read error")
+	StatFileReader = func() ([]byte, error) { return nil, readErr }
+	if _, err := SystemStat(StatAll); err != readErr {
+		t.Errorf("got error %v, want %v", err, readErr)
+	}
+}
+
+func TestTickDuration(t *testing.T) {
+	defer func(f SysconfFn, d time.Duration) {
+		SysconfImpl = f
+		TickDuration = d
+	}(SysconfImpl, TickDuration)
+
+	SysconfImpl = func(key int) (int64, error) {
+		if key != int(SCClkTck) {
+			t.Errorf("got key %d, want %d", key, SCClkTck)
+		}
+		return 200, nil
+	}
+	TickDuration = tickDuration()
+	if TickDuration != time.Second/200 {
+		t.Errorf("got %v, want %v", TickDuration, time.Second/200)
+	}
+	if d, _ := ticks(400, TickDuration); d != 2*time.Second {
+		t.Errorf("400 ticks is %v, want 2s", d)
+	}
+
+	SysconfImpl = func(int) (int64, error) { return -1, syscall.EINVAL }
+	if d := tickDuration(); d != time.Second/defaultClockTicks {
+		t.Errorf("got %v on error, want %v", d, time.Second/defaultClockTicks)
+	}
+}
+
+func TestTTYNumber(t *testing.T) {
+	for _, tt := range []struct {
+		major, minor uint32
+		want         int
+	}{
+		{4, 1, 0x0401},
+		{136, 3, 0x8803},
+		{136, 0x1234, 0x1208834},
+	} {
+		got := TTYNumber(tt.major, tt.minor)
+		if got != tt.want {
+			t.Errorf("TTYNumber(%d, %d) = %#x, want %#x", tt.major, tt.minor, got, tt.want)
+		}
+		p := &ProcessStat{ControllingTTY: got}
+		if major, minor := p.TTYDevice(); major != tt.major || minor != tt.minor {
+			t.Errorf("TTYDevice of %#x is %d, %d, want %d, %d", got, major, minor, tt.major, tt.minor)
+		}
+	}
+
+	// /dev/null is always character device 1, 3.
+	if got, err := TTYNumberOf("/dev/null"); err != nil || got != TTYNumber(1, 3) {
+		t.Errorf("TTYNumberOf(/dev/null) = %#x, %v, want %#x", got, err, TTYNumber(1, 3))
+	}
+	if _, err := TTYNumberOf(t.TempDir()); err == nil {
+		t.Errorf("TTYNumberOf of a directory did not fail")
+	}
+}
+
+func TestWatchStat(t *testing.T) {
+	dir := t.TempDir()
+	defer func(f string) { statFile = f }(statFile)
+	statFile = path.Join(dir, "stat")
+	write := func(data string) {
+		tmp := statFile + ".tmp"
+		if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, statFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("cpu  100 0 100 800 0 0 0 0 0 0\nctxt 10\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := WatchStat(ctx, 10*time.Millisecond, StatCPU|StatProcess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := <-ch
+	if len(s.CPUs) != 1 || s.CPUs[0].Total != 1000 {
+		t.Fatalf("first stat got %+v, want a total of 1000", s.CPUs)
+	}
+
+	write("cpu  150 0 120 830 0 0 0 0 0 0\nctxt 15\n")
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s = <-ch:
+		case <-timeout:
+			t.Fatal("timed out waiting for delta")
+		}
+		if len(s.CPUs) != 1 {
+			t.Fatalf("got %d CPUs, want 1", len(s.CPUs))
+		}
+		if s.CPUs[0].Total != 0 {
+			break
+		}
+	}
+	if s.CPUs[0].Total != 100 {
+		t.Errorf("got total delta %d, want 100", s.CPUs[0].Total)
+	}
+	if s.ContextSwitches != 5 {
+		t.Errorf("got context switch delta %d, want 5", s.ContextSwitches)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
 var cpuUsageTests = []struct {
 	in                              *CPU
 	user, system, idle, wait, guest float64
@@ -183,3 +349,97 @@ func TestProcStat(t *testing.T) {
 		t.Errorf("got %d, want %d\n", ps.StartTime, pst)
 	}
 }
+
+func TestParseProcStat(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		command string
+	}{
+		{"simple", "sh"},
+		{"spaces", "my long process name"},
+		{"parens", "a) b (c"},
+		{"empty", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			line := "42 (" + tt.command + ") S 1 42 42 0 -1 4194560 100 0 0 0 5 3 0 0 20 0 1 0 1000 4096 10 18446744073709551615\n"
+			ps, err := ParseProcStat([]byte(line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ps.Command != tt.command {
+				t.Errorf("got command %q, want %q", ps.Command, tt.command)
+			}
+			if ps.Pid != 42 {
+				t.Errorf("got pid %d, want 42", ps.Pid)
+			}
+			if ps.State != "Sleeping" {
+				t.Errorf("got state %q, want Sleeping", ps.State)
+			}
+			if ps.PPid != 1 {
+				t.Errorf("got ppid %d, want 1", ps.PPid)
+			}
+			if ps.StartTime != 1000*TickDuration {
+				t.Errorf("got start time %v, want %v", ps.StartTime, 1000*TickDuration)
+			}
+			if ps.RSSLimit != 18446744073709551615 {
+				t.Errorf("got rss limit %d, want 18446744073709551615", ps.RSSLimit)
+			}
+		})
+	}
+}
+
+func TestParseProcStatOverflow(t *testing.T) {
+	defer func(d time.Duration) { TickDuration = d }(TickDuration)
+	TickDuration = 10 * time.Millisecond
+
+	stat := func(starttime string) []byte {
+		return []byte("42 (sh) S 1 42 42 0 -1 4194560 100 0 0 0 5 3 0 0 20 0 1 0 " + starttime + " 4096 10 18446744073709551615\n")
+	}
+
+	// 2^39 ticks is about 174 years, which still fits.
+	ps, err := ParseProcStat(stat("549755813888"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Duration(1<<39) * TickDuration; ps.StartTime != want {
+		t.Errorf("got start time %v, want %v", ps.StartTime, want)
+	}
+
+	for _, starttime := range []string{"922337203686", "18446744073709551615"} {
+		_, err := ParseProcStat(stat(starttime))
+		if !errors.Is(err, ErrDurationOverflow) {
+			t.Errorf("%s: got error %v, want %v", starttime, err, ErrDurationOverflow)
+		}
+	}
+}
+
+func TestAllProcStats(t *testing.T) {
+	stats, err := AllProcStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := stats[os.Getpid()]
+	if st == nil {
+		t.Fatalf("our pid %d is missing from %d stats", os.Getpid(), len(stats))
+	}
+	if st.Command == "" {
+		t.Errorf("our stat has no command")
+	}
+	if len(stats) < 2 {
+		t.Errorf("got %d stats, want at least 2", len(stats))
+	}
+}
+
+func TestAllProcStatsPIDs(t *testing.T) {
+	// A pid that cannot exist is skipped.
+	stats, err := AllProcStatsPIDs([]int{os.Getpid(), 1 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[os.Getpid()] == nil {
+		t.Errorf("got stats for %v, want just %d", stats, os.Getpid())
+	}
+	if stats, err := AllProcStatsPIDs(nil); err != nil || len(stats) != 0 {
+		t.Errorf("no pids got %v, %v", stats, err)
+	}
+}
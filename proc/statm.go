@@ -0,0 +1,77 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A ProcessMemStats contains the memory usage of a process as read from
+// /proc/PID/statm.  The kernel reports pages, all sizes here are in bytes.
+type ProcessMemStats struct {
+	Size     uint64 // total program size
+	Resident uint64 // resident set size
+	Shared   uint64 // resident shared pages (i.e., backed by a file)
+	Text     uint64 // text (code)
+	Data     uint64 // data plus stack
+	PageSize int    // the page size used to convert pages to bytes
+}
+
+// ProcMemStats returns the memory usage of process pid as read from
+// /proc/PID/statm.  It is much cheaper to read than ProcStat.
+func ProcMemStats(pid int) (*ProcessMemStats, error) {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/statm")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMemStats(f)
+}
+
+// ParseMemStats parses r, which is in the format of /proc/PID/statm.  The
+// unused lib and dt fields are ignored.
+func ParseMemStats(r io.Reader) (*ProcessMemStats, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("statm: got %d fields, want 7", len(fields))
+	}
+	pageSize := os.Getpagesize()
+	m := &ProcessMemStats{PageSize: pageSize}
+	for i, field := range []*uint64{&m.Size, &m.Resident, &m.Shared, &m.Text, nil, &m.Data} {
+		if field == nil {
+			continue
+		}
+		pages, err := strconv.ParseUint(fields[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("statm: %v", err)
+		}
+		*field = pages * uint64(pageSize)
+	}
+	return m, nil
+}
+
+// ResidentBytes returns the number of bytes of m's process that are resident
+// in memory.
+func (m *ProcessMemStats) ResidentBytes() uint64 {
+	return m.Resident
+}
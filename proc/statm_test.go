@@ -0,0 +1,66 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package proc
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseMemStats(t *testing.T) {
+	m, err := ParseMemStats(strings.NewReader("5420 1234 567 89 0 1011 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := uint64(os.Getpagesize())
+	if m.PageSize != int(page) {
+		t.Errorf("got page size %d, want %d", m.PageSize, page)
+	}
+	for _, tt := range []struct {
+		name      string
+		got, want uint64
+	}{
+		{"Size", m.Size, 5420 * page},
+		{"Resident", m.Resident, 1234 * page},
+		{"Shared", m.Shared, 567 * page},
+		{"Text", m.Text, 89 * page},
+		{"Data", m.Data, 1011 * page},
+		{"ResidentBytes", m.ResidentBytes(), 1234 * page},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "1 2 3", "1 2 x 4 0 6 0"} {
+		if _, err := ParseMemStats(strings.NewReader(in)); err == nil {
+			t.Errorf("%q: did not get an error", in)
+		}
+	}
+}
+
+func TestProcMemStats(t *testing.T) {
+	if _, err := os.Stat("/proc/self/statm"); err != nil {
+		t.Skip("no /proc/self/statm")
+	}
+	m, err := ProcMemStats(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Resident == 0 || m.Size < m.Resident {
+		t.Errorf("got size %d and resident %d", m.Size, m.Resident)
+	}
+}
@@ -22,6 +22,23 @@ func Sysconf(name SCName) int64 {
 	return int64(C.sysconf(C.int(name)))
 }
 
+// A SysconfFn returns the value of the sysconf variable key, an SCName.
+type SysconfFn func(key int) (int64, error)
+
+// SysconfImpl is used by this package to call sysconf.  Tests may replace it
+// to return fixed values.
+var SysconfImpl SysconfFn = defaultSysconf
+
+// defaultSysconf calls sysconf.  An error is only returned if sysconf set
+// errno, a result of -1 alone means the variable has no limit.
+func defaultSysconf(key int) (int64, error) {
+	n, err := C.sysconf(C.int(key))
+	if n == -1 && err != nil {
+		return -1, err
+	}
+	return int64(n), nil
+}
+
 // An SCName represents a name for the POSIX Sysconf function call.
 type SCName int
 
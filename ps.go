@@ -0,0 +1,166 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pborman/pty/proc"
+)
+
+// psSortKeys are the keys the ps command can sort processes by.  Processes
+// are sorted by PID if no key is given.
+var psSortKeys = map[string]bool{
+	"":    true,
+	"cpu": true,
+	"rss": true,
+}
+
+// A psInfo is the information about a process displayed by the ps command.
+type psInfo struct {
+	state string        // single letter state, e.g., S
+	rss   uint64        // resident set size in bytes
+	cpu   time.Duration // user and system time
+}
+
+// getPSInfo returns the psInfo for the process pid from /proc.
+func getPSInfo(pid int) psInfo {
+	info := psInfo{state: "?"}
+	if st, err := proc.GetStatus(pid); err == nil {
+		if st.State != "" {
+			info.state = st.State[:1]
+		}
+		info.rss = st.VmRSS
+	}
+	if st, err := proc.ProcStat(pid); err == nil {
+		info.cpu = st.UserTime + st.SystemTime
+	}
+	return info
+}
+
+// PSTree returns the process tree rooted at pid as a table with the columns
+// PID, STATE, RSS, and CMD.  The commands are indented by their depth in the
+// tree.  The children of each process are sorted by sortBy, which is one of
+// the keys in psSortKeys.
+func PSTree(pid int, sortBy string) string {
+	if !psSortKeys[sortBy] {
+		return fmt.Sprintf("unknown sort key: %s\n", sortBy)
+	}
+	tree, err := proc.NewProcessTree()
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	p := tree.Process(pid)
+	if p == nil {
+		return "process not found\n"
+	}
+	var buf bytes.Buffer
+	writePSTree(&buf, p, sortBy, getPSInfo)
+	return buf.String()
+}
+
+// writePSTree writes the process tree rooted at p to w.  info is called to
+// look up the information about each process.
+func writePSTree(w io.Writer, p *proc.Process, sortBy string, info func(int) psInfo) {
+	infos := map[int]psInfo{}
+	lookup := func(p *proc.Process) psInfo {
+		i, ok := infos[p.Pid]
+		if !ok {
+			i = info(p.Pid)
+			infos[p.Pid] = i
+		}
+		return i
+	}
+	fmt.Fprintf(w, "%7s %-5s %9s %s\n", "PID", "STATE", "RSS", "CMD")
+	var walk func(p *proc.Process, depth int)
+	walk = func(p *proc.Process, depth int) {
+		i := lookup(p)
+		fmt.Fprintf(w, "%7d %-5s %8dK %s%s\n", p.Pid, i.state, i.rss/1024, strings.Repeat("  ", depth), psCommand(p))
+		children := append([]*proc.Process{}, p.Children...)
+		sort.Slice(children, func(x, y int) bool {
+			cx, cy := children[x], children[y]
+			switch sortBy {
+			case "cpu":
+				if a, b := lookup(cx).cpu, lookup(cy).cpu; a != b {
+					return a > b
+				}
+			case "rss":
+				if a, b := lookup(cx).rss, lookup(cy).rss; a != b {
+					return a > b
+				}
+			}
+			return cx.Pid < cy.Pid
+		})
+		for _, child := range children {
+			walk(child, depth+1)
+		}
+	}
+	walk(p, 0)
+}
+
+// psCommand returns the command line of p as displayed by ps.
+func psCommand(p *proc.Process) string {
+	switch {
+	case len(p.Argv) == 0 || p.Argv[0] == "":
+		return "[" + p.Name + "]"
+	case p.Name == "vi" || p.Name == "vi.exe":
+		return "vi " + strings.Join(viFiles(p), " ")
+	}
+	return strings.Join(p.Argv, " ")
+}
+
+// allProcStats returns the stats of all processes.  It is replaced by tests.
+var allProcStats = proc.AllProcStats
+
+// PSForTTY returns the processes whose controlling terminal is the device at
+// path as a table with the columns PID, STATE, and CMD, sorted by PID.
+func PSForTTY(path string) string {
+	tty, err := proc.TTYNumberOf(path)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	stats, err := allProcStats()
+	if err != nil && len(stats) == 0 {
+		return err.Error() + "\n"
+	}
+	var buf bytes.Buffer
+	writeTTYProcesses(&buf, stats, tty)
+	return buf.String()
+}
+
+// writeTTYProcesses writes the processes in stats whose ControllingTTY is tty
+// to w.
+func writeTTYProcesses(w io.Writer, stats map[int]*proc.ProcessStat, tty int) {
+	var procs []*proc.ProcessStat
+	for _, st := range stats {
+		if st.ControllingTTY == tty {
+			procs = append(procs, st)
+		}
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].Pid < procs[j].Pid })
+	fmt.Fprintf(w, "%7s %-5s %s\n", "PID", "STATE", "CMD")
+	for _, st := range procs {
+		state := st.State
+		if state == "" {
+			state = "?"
+		}
+		fmt.Fprintf(w, "%7d %-5s %s\n", st.Pid, state[:1], st.Command)
+	}
+}
@@ -0,0 +1,112 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pborman/pty/proc"
+)
+
+func TestWritePSTree(t *testing.T) {
+	// The fake tree is:
+	//
+	//	1 init
+	//	  20 sh (rss 3K, cpu 1s)
+	//	    40 sleep
+	//	  10 top (rss 2K, cpu 5s)
+	leaf := &proc.Process{Pid: 40, Name: "sleep", Argv: []string{"sleep", "60"}}
+	root := &proc.Process{Pid: 1, Name: "init", Argv: []string{"init"}, Children: []*proc.Process{
+		{Pid: 20, Name: "sh", Argv: []string{"-sh"}, Children: []*proc.Process{leaf}},
+		{Pid: 10, Name: "top", Argv: []string{"top"}},
+	}}
+	infos := map[int]psInfo{
+		1:  {state: "S", rss: 1024},
+		10: {state: "R", rss: 2048, cpu: 5 * time.Second},
+		20: {state: "S", rss: 3072, cpu: time.Second},
+		40: {state: "S"},
+	}
+	info := func(pid int) psInfo { return infos[pid] }
+
+	for _, tt := range []struct {
+		sortBy string
+		want   []string
+	}{
+		{"", []string{"init", "  top", "  -sh", "    sleep 60"}},
+		{"cpu", []string{"init", "  top", "  -sh", "    sleep 60"}},
+		{"rss", []string{"init", "  -sh", "    sleep 60", "  top"}},
+	} {
+		var buf bytes.Buffer
+		writePSTree(&buf, root, tt.sortBy, info)
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+		if len(lines) != len(tt.want)+1 {
+			t.Errorf("%q: got:\n%s", tt.sortBy, buf.String())
+			continue
+		}
+		if !strings.HasSuffix(lines[0], " CMD") {
+			t.Errorf("%q: bad header %q", tt.sortBy, lines[0])
+		}
+		// The CMD column starts at the same offset as in the header.
+		col := strings.Index(lines[0], "CMD")
+		for x, want := range tt.want {
+			if got := lines[x+1][col:]; got != want {
+				t.Errorf("%q: line %d: got %q, want %q", tt.sortBy, x+1, got, want)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	writePSTree(&buf, leaf, "", info)
+	if want := "     40 S            0K sleep 60\n"; !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("got:\n%s\nwant suffix:\n%s", buf.String(), want)
+	}
+}
+
+func TestPSForTTY(t *testing.T) {
+	defer func(f func() (map[int]*proc.ProcessStat, error)) { allProcStats = f }(allProcStats)
+
+	// /dev/null stands in for the session's pty.
+	const tty = "/dev/null"
+	nr, err := proc.TTYNumberOf(tty)
+	if err != nil {
+		t.Skip(err)
+	}
+	allProcStats = func() (map[int]*proc.ProcessStat, error) {
+		return map[int]*proc.ProcessStat{
+			1:  {Pid: 1, Command: "init", State: "S"},
+			30: {Pid: 30, Command: "vi", State: "T", ControllingTTY: nr},
+			20: {Pid: 20, Command: "sh", State: "S", ControllingTTY: nr},
+			40: {Pid: 40, Command: "bash", State: "S", ControllingTTY: proc.TTYNumber(136, 1)},
+		}, nil
+	}
+
+	s := &Session{Name: "test", path: t.TempDir()}
+	if got := s.PSForTTY(); got != "" {
+		t.Errorf("with no tty got:\n%s", got)
+	}
+	if err := s.SetTTY(tty); err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"    PID STATE CMD\n" +
+		"     20 S     sh\n" +
+		"     30 T     vi\n"
+	if got := s.PSForTTY(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -28,6 +28,9 @@ import (
 	"syscall"
 
 	"github.com/kr/pty"
+	"github.com/pborman/pty/log"
+	ttyname "github.com/pborman/pty/tty"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 const (
@@ -80,7 +83,7 @@ func SelectSession(id string) (*Session, error) {
 	if err == nil {
 		mysize = fmt.Sprintf("(%dx%d)", cols, rows)
 	}
-	sessions := GetSessions()
+	sessions := GetSessions(namespace)
 
 	var nextSession string
 	sessionAvailable := func(i int) bool {
@@ -115,16 +118,19 @@ func SelectSession(id string) (*Session, error) {
 		if !ValidSessionName(name) {
 			exitf("invalid session name %q", name)
 		}
-		s := MakeSession(name, id)
+		s, err := MakeSession(namespace, name, id)
+		if err != nil {
+			return nil, err
+		}
 		if s.Check() {
 			exitf("session %q already exists", name)
 		}
 		return s.Attach(id), nil
 	}
-	if loginShell != "" {
-		fmt.Printf("shell) Spawn %s\n", loginShell)
-	}
 	if *autoAttach {
+		if len(sessions) == 1 {
+			return sessions[0].Attach(id), nil
+		}
 		if id != "" {
 			for _, s := range sessions {
 				if s.cnt == 0 && s.SessionID() == id {
@@ -140,6 +146,13 @@ func SelectSession(id string) (*Session, error) {
 		}
 	}
 
+	if !isPipe() && ttyname.IsATTY(0) {
+		return menuSession(sessions, id, mysize, nextSession)
+	}
+
+	if loginShell != "" {
+		fmt.Printf("shell) Spawn %s\n", loginShell)
+	}
 	var candidates []int
 	fmt.Printf(" name) Create a new session named name\n")
 	for i, s := range sessions {
@@ -207,14 +220,14 @@ Loop:
 				}
 			}
 			if name == nextSession {
-				return MakeSession(name, id), nil
+				return MakeSession(namespace, name, id)
 			}
 			ok, err := readYesNo("Create session %s [Y/N]? ", name)
 			switch {
 			case err != nil:
 				return nil, err
 			case ok:
-				return MakeSession(name, id), nil
+				return MakeSession(namespace, name, id)
 			default:
 				continue Loop
 			}
@@ -222,6 +235,73 @@ Loop:
 	}
 }
 
+// menuSession lets the user choose one of sessions from a menu using the
+// arrow keys.  The menu also offers to create a new session, suggesting the
+// name nextSession, and to spawn the login shell.  The first unattached session
+// with the same window size as ours, if any, is initially selected, otherwise
+// the session with the originating ID id.  io.EOF is returned if the menu is
+// cancelled.
+func menuSession(sessions []*Session, id, mysize, nextSession string) (*Session, error) {
+	sel, candidate := 0, -1
+	items := make([]string, 0, len(sessions)+2)
+	for i, s := range sessions {
+		if candidate < 0 && s.cnt == 0 && s.TTYSize() != "" && s.TTYSize() == mysize {
+			candidate = i
+		}
+		if id != "" && id == s.SessionID() {
+			sel = i
+		}
+		items = append(items, menuItem(s))
+	}
+	if candidate >= 0 {
+		sel = candidate
+	}
+	create := len(items)
+	items = append(items, "Create a new session")
+	spawn := -1
+	if loginShell != "" {
+		spawn = len(items)
+		items = append(items, "Spawn "+loginShell)
+	}
+
+	fmt.Printf("Select a session (arrow keys, Enter to select, Esc to quit):\n")
+	ostate, err := terminal.MakeRaw(0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := menuSelect(os.Stdin, os.Stdout, items, sel)
+	terminal.Restore(0, ostate)
+	switch {
+	case err != nil:
+		return nil, err
+	case n == spawn:
+		execsh()
+		exitf("failed to exec %v", loginShell)
+	case n != create:
+		return sessions[n].Attach(id), nil
+	}
+	for {
+		fmt.Printf("Name of session to create [%s]: ", nextSession)
+		name, err := readline()
+		if err != nil {
+			return nil, err
+		}
+		if name = strings.TrimSpace(name); name == "" {
+			name = nextSession
+		}
+		if !ValidSessionName(name) {
+			fmt.Printf("%q is an invalid session name\n", name)
+			continue
+		}
+		for _, s := range sessions {
+			if name == s.Name {
+				return s.Attach(id), nil
+			}
+		}
+		return MakeSession(namespace, name, id)
+	}
+}
+
 func readYesNo(format string, v ...interface{}) (bool, error) {
 	for {
 		fmt.Printf(format, v...)
@@ -254,27 +334,22 @@ func readline() (string, error) {
 	}
 }
 
-func GetSessions() []*Session {
-	dir := filepath.Join(user.HomeDir, rcdir)
-	fd, err := os.Open(dir)
-	if err != nil {
-		warnf("finding session names: %v", err)
-		return nil
-	}
-	dirs, _ := fd.Readdirnames(-1)
-	checkClose(fd)
-	ch := make(chan *Session, len(dirs))
+// GetSessions returns the running sessions in namespace ns sorted by name.
+// Stale sessions (see Session.Stale) are removed.
+func GetSessions(ns string) []*Session {
+	ch := make(chan *Session)
 	var wg sync.WaitGroup
 
-	for _, name := range dirs {
-		if name == "" || name == "@" || name[0] != '@' {
-			continue
-		}
-		s := MakeSession(name[1:], "")
+	for _, s := range listSessions(ns) {
+		s := s
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			if !s.Check() {
+				if s.Stale(gcThreshold()) {
+					log.Infof("removing stale session %s", s.Name)
+					s.Remove()
+				}
 				return
 			}
 			ch <- s
@@ -293,3 +368,42 @@ func GetSessions() []*Session {
 	})
 	return sessions
 }
+
+// GCSessions removes the stale sessions in namespace ns and returns their
+// names, sorted.
+func GCSessions(ns string) []string {
+	var names []string
+	for _, s := range listSessions(ns) {
+		if s.Stale(gcThreshold()) {
+			s.Remove()
+			names = append(names, s.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listSessions returns every session in namespace ns, running or not.
+func listSessions(ns string) []*Session {
+	dir := filepath.Join(user.HomeDir, rcdir, ns)
+	fd, err := os.Open(dir)
+	if err != nil {
+		warnf("finding session names: %v", err)
+		return nil
+	}
+	dirs, _ := fd.Readdirnames(-1)
+	checkClose(fd)
+	var sessions []*Session
+	for _, name := range dirs {
+		if name == "" || name == "@" || name[0] != '@' {
+			continue
+		}
+		s, err := MakeSession(ns, name[1:], "")
+		if err != nil {
+			log.Warnf("%v", err)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
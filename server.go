@@ -16,18 +16,23 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/pborman/pty/log"
 	"github.com/pborman/pty/mutex"
+	"golang.org/x/time/rate"
 )
 
 func (s *Session) shell(debug bool) {
@@ -36,7 +41,7 @@ func (s *Session) shell(debug bool) {
 		s.Exitf("server: %v", err)
 	}
 
-	shell := NewShell(s)
+	shell := newSessionShell(s)
 	if err := shell.Start(debug); err != nil {
 		s.Exitf("start: %v\n", err)
 	}
@@ -45,6 +50,23 @@ func (s *Session) shell(debug bool) {
 		s.Exit(0)
 	}()
 
+	// On SIGTERM give the clients a chance to detach before exiting.
+	shutdown := make(chan struct{})
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGTERM)
+	go func() {
+		<-term
+		grace := defaultShutdownGrace
+		if shutdownGrace != nil {
+			grace = *shutdownGrace
+		}
+		log.Infof("SIGTERM: shutting down in %v", grace)
+		close(shutdown)
+		conn.Close()
+		shell.Shutdown(grace)
+		s.Exit(0)
+	}()
+
 	ch := make(chan os.Signal, 2)
 	signal.Notify(ch, syscall.SIGABRT, syscall.SIGBUS, syscall.SIGQUIT, syscall.SIGSEGV)
 	go func() {
@@ -60,13 +82,20 @@ func (s *Session) shell(debug bool) {
 			}
 		}
 	}()
+	// The detector only runs when __MUTEX_DEBUG is set.
+	mutex.StartDeadlockDetector(deadlockTimeout)
 
 	for {
 		c, err := conn.Accept()
 		if err != nil {
+			select {
+			case <-shutdown:
+				// The shutdown goroutine will exit.
+				select {}
+			default:
+			}
 			s.Exitf("server: %v", err)
 		}
-		log.Infof("accepted new connection")
 		go func() {
 			shell.attach(c)
 			checkClose(c)
@@ -74,52 +103,160 @@ func (s *Session) shell(debug bool) {
 	}
 }
 
+// newSessionShell returns a new Shell for session s configured from the pty
+// configuration and, if s is a clone, the environment of the cloned session.
+func newSessionShell(s *Session) *Shell {
+	shell := NewShell(s)
+	shell.OutputRateLimit = rateLimit(s.Name)
+	shell.WriteRateLimit = config.WriteRateLimit
+	shell.WriteQueueSize = config.WriteQueueSize
+	shell.SetMaxClients(config.MaxClients)
+	if env, err := s.cloneEnv(); err == nil {
+		shell.Env = env
+		os.Remove(filepath.Join(s.path, "clone_env"))
+	} else if !os.IsNotExist(err) {
+		log.Errorf("reading cloned environment: %v", err)
+	}
+	// An imported session starts with the screen it was exported with.
+	if screen, err := ioutil.ReadFile(filepath.Join(s.path, screenFile)); err == nil {
+		shell.eb.Write(screen)
+		os.Remove(filepath.Join(s.path, screenFile))
+	}
+	if noTitleTrack == nil || !*noTitleTrack {
+		shell.titles = newTitleTracker(func(title string) {
+			if err := s.SetTitle(title); err != nil {
+				log.Warnf("setting title: %v", err)
+			}
+		})
+	}
+	if noAudit == nil || !*noAudit {
+		a, err := openAuditLog(filepath.Join(s.path, "audit.log"))
+		if err != nil {
+			log.Errorf("opening audit log: %v", err)
+		} else {
+			shell.auditLog = a
+		}
+	}
+	return shell
+}
+
 func (s *Shell) attach(c net.Conn) {
-	// Attach forwards the shells output to c.
+	// Attach forwards the shells output to c.  Log messages about this
+	// connection are tagged with its request ID.
+	ctx := log.WithRequestID(context.Background(), log.NewRequestID())
+	log.InfofCtx(ctx, "accepted new connection")
 	mw := NewMessengerWriter(c)
 	client := NewClient(mw)
 	defer func() { go s.Detach(client) }()
+	// reply sends a formatted message to the client, logging any error.
+	reply := func(kind messageKind, format string, v ...interface{}) {
+		if err := mw.Sendf(kind, format, v...); err != nil {
+			log.WarnfCtx(ctx, "client %s: %v", client.Name(), err)
+		}
+	}
 	attached := false
+	var exclTimer *time.Timer // pending excl --after
 	ech := make(chan error, 1)
 	go func() {
 		r := NewMessengerReader(c, func(kind messageKind, msg []byte) {
+			s.audit(client, kind, len(msg))
 			switch kind {
 			case psMessage:
-				mw.Send(psMessage, []byte(PS(os.Getpid())))
+				mw.Send(psMessage, []byte(PSTree(os.Getpid(), string(msg))))
 			case forwardMessage:
 				x := bytes.IndexByte(msg, 0)
 				if x <= 0 {
-					mw.Sendf(serverMessage, "ERROR: BAD FORWARD MESSAGE\r\n")
+					reply(serverMessage, "ERROR: BAD FORWARD MESSAGE\r\n")
 					return
 				}
 				name := string(msg[:x])
 				socket := string(msg[x+1:])
 				if name == "" || socket == "" {
-					mw.Sendf(serverMessage, "ERROR: BAD FORWARD MESSAGE\r\n")
+					reply(serverMessage, "ERROR: BAD FORWARD MESSAGE\r\n")
+					return
+				}
+				if err := SetForwarder(name, socket); err != nil {
+					log.InfofCtx(ctx, "forward %s: %v", name, err)
+					return
+				}
+				// Make sure the shell still refers to the
+				// forwarder rather than some other socket.
+				s.MergeEnv(map[string]string{name: name + fwdSuffix})
+			case broadcastEnvMessage:
+				x := bytes.IndexByte(msg, 0)
+				if x <= 0 || !envName.Match(msg[:x]) {
+					reply(serverMessage, "ERROR: BAD BROADCAST ENV MESSAGE\r\n")
 					return
 				}
-				SetForwarder(name, socket)
+				// The variable is exported once, by the server, and
+				// the other clients are told about it.  A forwarded
+				// variable was already exported by forwardMessage.
+				name, value := string(msg[:x]), string(msg[x+1:])
+				if v, ok := s.lookupEnv(name); !ok || v != value {
+					if err := s.Export(name, value); err != nil {
+						reply(serverMessage, "ERROR: %v\r\n", err)
+						return
+					}
+				}
+				s.broadcast(client, broadcastEnvMessage, msg)
+			case setenvMessage:
+				x := bytes.IndexByte(msg, 0)
+				if x <= 0 {
+					reply(serverMessage, "ERROR: BAD SETENV MESSAGE\r\n")
+					return
+				}
+				if err := s.Export(string(msg[:x]), string(msg[x+1:])); err != nil {
+					reply(serverMessage, "ERROR: setenv: %v\r\n", err)
+				}
 			case exclusiveMessage:
-				unlock := s.mu.Lock("exclusiveMessage")
-				var clients []*Client
-				for c := range s.clients {
-					if c != client {
-						clients = append(clients, c)
+				// An optional duration gives the other
+				// clients warning before they are detached.
+				if len(msg) == 0 {
+					s.DetachOthers(client)
+					return
+				}
+				after, err := time.ParseDuration(string(msg))
+				if err != nil || after <= 0 {
+					reply(serverMessage, "ERROR: BAD EXCL DELAY %q\r\n", msg)
+					return
+				}
+				if exclTimer != nil {
+					exclTimer.Stop()
+				}
+				warning := []byte(fmt.Sprintf("\r\nYou will be detached in %v by client %s\r\n", after, client.Name()))
+				for _, oc := range s.clientList() {
+					if oc != client {
+						oc.Send(serverMessage, warning)
 					}
 				}
-				unlock()
-				for _, oc := range clients {
-					s.Detach(oc)
-					oc.Output([]byte(fmt.Sprintf("\r\nDetached by client %s\r\n", client.Name())))
-					checkClose(oc)
+				exclTimer = time.AfterFunc(after, func() { s.DetachOthers(client) })
+				reply(serverMessage, "detaching other clients in %v\r\n", after)
+			case cancelMessage:
+				if exclTimer == nil || !exclTimer.Stop() {
+					reply(serverMessage, "nothing to cancel\r\n")
+					return
 				}
+				exclTimer = nil
+				notice := []byte(fmt.Sprintf("\r\nClient %s cancelled detaching this client\r\n", client.Name()))
+				for _, oc := range s.clientList() {
+					if oc != client {
+						oc.Send(serverMessage, notice)
+					}
+				}
+				reply(serverMessage, "detach cancelled\r\n")
 			case askCountMessage:
-				mw.Sendf(countMessage, "%d", s.Count())
+				reply(countMessage, "%d", s.Count())
 			case pingMessage:
 				mw.Send(ackMessage, msg)
+			case ackMessage:
+				// The client's response to IsActive's ping.
 			case ttynameMessage:
 				if !attached {
-					s.Attach(client)
+					if s.Attach(client) < 0 {
+						log.WarnfCtx(ctx, "client limit reached, closing connection")
+						client.Close()
+						return
+					}
 					attached = true
 				}
 				// the ttynameMessage is sent by each client as
@@ -133,22 +270,109 @@ func (s *Shell) attach(c net.Conn) {
 					var err error
 					pid, err = strconv.Atoi(name[:x])
 					if err == nil {
+						client.SetPid(pid)
 						s.AddPid(client, pid)
 						name = name[x+1:]
 					}
 				}
 				if pid == 0 {
-					log.Warnf("ttyname with no pid: %s", name)
+					log.WarnfCtx(ctx, "ttyname with no pid: %s", name)
 				}
 				client.SetName(name)
 			case dumpMessage:
-				log.DumpGoroutines()
+				if path := string(msg); path != "" {
+					if err := dumpToFile(path); err != nil {
+						log.WarnfCtx(ctx, "dump: %v", err)
+						reply(serverMessage, "ERROR: %v\r\n", err)
+						return
+					}
+					reply(serverMessage, "goroutines dumped to %s\r\n", path)
+					return
+				}
+				// The dump goes to both the log file and the client.
+				var b bytes.Buffer
+				if err := log.DumpGoroutinesTo(&b); err != nil {
+					reply(serverMessage, "ERROR: %v\r\n", err)
+					return
+				}
+				log.Standard().OutputDirect(b.String())
+				mw.Send(serverMessage, bytes.ReplaceAll(b.Bytes(), []byte("\n"), []byte("\r\n")))
+			case ratelimitMessage:
+				limit, err := strconv.Atoi(string(msg))
+				if err != nil || limit < 0 {
+					reply(serverMessage, "ERROR: BAD RATE LIMIT %q\r\n", msg)
+					return
+				}
+				s.SetRateLimit(BytesPerSecond(limit))
+				if limit == 0 {
+					reply(serverMessage, "rate limit removed\r\n")
+				} else {
+					reply(serverMessage, "rate limit set to %d bytes/second\r\n", limit)
+				}
+			case priorityMessage:
+				p, err := strconv.Atoi(string(msg))
+				if err != nil {
+					reply(serverMessage, "ERROR: BAD PRIORITY %q\r\n", msg)
+					return
+				}
+				client.SetPriority(p)
+			case limitMessage:
+				limit, err := strconv.Atoi(string(msg))
+				if err != nil || limit < 0 {
+					reply(serverMessage, "ERROR: BAD CLIENT LIMIT %q\r\n", msg)
+					return
+				}
+				s.SetMaxClients(limit)
+				if limit == 0 {
+					reply(serverMessage, "client limit removed\r\n")
+				} else {
+					reply(serverMessage, "client limit set to %d\r\n", limit)
+				}
+			case statsMessage:
+				data, err := s.SaveStats()
+				if err != nil {
+					reply(serverMessage, "ERROR: STATS: %v\r\n", err)
+					return
+				}
+				data = bytes.ReplaceAll(data, []byte{'\n'}, []byte{'\r', '\n'})
+				reply(serverMessage, "%s\r\n", data)
+			case escstatsMessage:
+				m := s.eb.Metrics()
+				reply(serverMessage, "sequences matched: %d\r\n", m.SequencesMatched)
+				reply(serverMessage, "bytes processed:   %d\r\n", m.BytesProcessed)
+				reply(serverMessage, "partial waits:     %d\r\n", m.PartialWaits)
+				reply(serverMessage, "bytes dropped:     %d\r\n", m.BytesDropped)
+			case notifyMessage:
+				notify := !client.Notify()
+				client.SetNotify(notify)
+				if notify {
+					reply(serverMessage, "bell notifications enabled\r\n")
+				} else {
+					reply(serverMessage, "bell notifications disabled\r\n")
+				}
+			case envMessage:
+				mw.Send(envMessage, []byte(strings.Join(s.Environ(), "\x00")))
+			case runMessage:
+				if err := s.RunCommand(string(msg)); err != nil {
+					reply(runMessage, "%v", err)
+				} else {
+					mw.Send(runMessage, nil)
+				}
 			case listMessage:
-				s.List(client)
+				if string(msg) != "-v" {
+					s.List(client)
+					return
+				}
+				data, err := json.Marshal(s.Info())
+				if err != nil {
+					reply(serverMessage, "ERROR: %v\r\n", err)
+					return
+				}
+				mw.Send(serverMessage, data)
 			case ttysizeMessage:
 				s.Take(client, false)
 				if len(msg) != 4 {
-					mw.Sendf(serverMessage, "ERROR: SCREEN MSG IS %d BYTES, need 4\r\n", len(msg))
+					reply(serverMessage, "ERROR: SCREEN MSG IS %d BYTES, need 4\r\n", len(msg))
 					return
 				}
 				rows, cols := decodeSize(msg)
@@ -162,49 +386,90 @@ func (s *Shell) attach(c net.Conn) {
 				s.cols = cols
 				unlock()
 				if err := s.Setsize(rows, cols); err != nil {
-					mw.Sendf(serverMessage, "ERROR: SETSIZE: %v\r\n", err)
+					reply(serverMessage, "ERROR: SETSIZE: %v\r\n", err)
 				}
 			case saveMessage:
-				var err error
-				unlock := s.mu.Lock("saveMessage")
-				if s.eb.inalt {
-					err = ioutil.WriteFile(string(msg), s.eb.alt, 0600)
+				err := saveSnapshot(string(msg), s.eb.Snapshot())
+				if err != nil {
+					reply(serverMessage, "ERROR: saving screen: %v\n", err)
 				} else {
-					err = ioutil.WriteFile(string(msg), s.eb.normal, 0600)
+					reply(serverMessage, "screen saved to %s\r\n", msg)
 				}
-				unlock()
+			case diffMessage:
+				saved, err := ioutil.ReadFile(string(msg))
 				if err != nil {
-					mw.Sendf(serverMessage, "ERROR: saving screen: %v\n", err)
-				} else {
-					mw.Sendf(serverMessage, "screen saved to %s\r\n", msg)
+					reply(serverMessage, "ERROR: diff: %v\r\n", err)
+					return
 				}
+				diff := screenDiff(string(msg), saved, s.eb.Snapshot().Bytes())
+				if diff == "" {
+					reply(serverMessage, "screen matches %s\r\n", msg)
+					return
+				}
+				reply(serverMessage, "%s", strings.ReplaceAll(diff, "\n", "\r\n"))
 			case escapeMessage:
-				unlock := s.mu.Lock("escapeMessage")
-				s.eb.sendEscapes(mw, strings.ToLower(string(msg)) == "alt")
-				unlock()
+				// msg is "alt" or "normal", optionally
+				// followed by " -v" to describe each sequence.
+				mode, opt, _ := strings.Cut(string(msg), " ")
+				s.eb.sendEscapes(mw, strings.ToLower(mode) == "alt", opt == "-v")
 			default:
-				mw.Sendf(serverMessage, "ERROR: UNSUPPORTED KIND %d\r\n", kind)
+				reply(serverMessage, "ERROR: UNSUPPORTED KIND %d\r\n", kind)
 			}
 		})
+		// write writes client input to the shell.  With a write
+		// rate limit the input is queued and written by another
+		// goroutine so we continue to read from the client.
+		write := func(buf []byte) error {
+			_, err := s.Write(buf)
+			s.markActive()
+			return err
+		}
+		if s.WriteRateLimit > 0 {
+			q := newInputQueue(s.WriteQueueSize)
+			defer q.Close()
+			go s.writeQueued(ctx, q, ech)
+			write = func(buf []byte) error {
+				if n := q.Write(buf); n > 0 {
+					log.WarnfCtx(ctx, "client %s: discarded %d bytes of input", client.Name(), n)
+					reply(preemptMessage, "\r\nWARNING: input too fast, discarded %d bytes\r\n", n)
+				}
+				return nil
+			}
+		}
 		var data [32 * 1024]byte
+		refused := false // the client was told its input is discarded
 		for {
 			var werr error
 			r, rerr := r.Read(data[:])
 			if r > 0 {
-				s.Take(client, true)
-				_, werr = s.Write(data[:r])
+				s.audit(client, dataMessage, r)
+				// Input from a client that cannot take the
+				// session from a higher priority client is
+				// dropped.
+				switch {
+				case s.Take(client, true):
+					refused = false
+					werr = write(data[:r])
+				case !refused:
+					refused = true
+					reply(preemptMessage, "\r\nWARNING: a higher priority client has the session, input discarded\r\n")
+				}
 			}
 			if rerr != nil {
-				log.Warnf("Read from client: %v", rerr)
+				log.WarnfCtx(ctx, "Read from client: %v", rerr)
 				ech <- rerr
 				break
 			}
 			if werr != nil {
-				log.Warnf("Write to shell: %v", werr)
+				log.WarnfCtx(ctx, "Write to shell: %v", werr)
 				ech <- werr
 				break
 			}
 		}
+		// A pending excl --after ends with the requesting client.
+		if exclTimer != nil {
+			exclTimer.Stop()
+		}
 	}()
 	select {
 	case <-s.done:
@@ -216,6 +481,88 @@ func (s *Shell) attach(c net.Conn) {
 	checkClose(c)
 }
 
+// writeQueued writes the input in q to the shell at no more than
+// s.WriteRateLimit bytes per second.  Any error writing to the shell is sent
+// on ech and logged with the request ID in ctx.
+func (s *Shell) writeQueued(ctx context.Context, q *inputQueue, ech chan error) {
+	burst := int(s.WriteRateLimit)
+	limiter := rate.NewLimiter(rate.Limit(s.WriteRateLimit), burst)
+	limiter.AllowN(time.Now(), burst)
+	for {
+		buf, ok := q.next(burst)
+		if !ok {
+			return
+		}
+		limiter.WaitN(ctx, len(buf))
+		_, err := s.Write(buf)
+		s.markActive()
+		if err != nil {
+			log.WarnfCtx(ctx, "Write to shell: %v", err)
+			select {
+			case ech <- err:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// saveSnapshot writes the current screen buffer in snap to the file path.
+func saveSnapshot(path string, snap *EscapeSnapshot) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := snap.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dumpToFile writes a dump of all goroutines to the file path.
+func dumpToFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := log.DumpGoroutinesTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// serverFlags returns the command line flags that are passed on to the server.
+func serverFlags() []string {
+	var args []string
+	if kittyKeyboard != nil && *kittyKeyboard {
+		args = append(args, "--kitty-keyboard")
+	}
+	if logMaxSize != nil && *logMaxSize != "" {
+		args = append(args, "--log-max-size", *logMaxSize)
+	}
+	if logMaxFiles != nil && *logMaxFiles > 0 {
+		args = append(args, "--log-max-files", strconv.Itoa(*logMaxFiles))
+	}
+	if noAudit != nil && *noAudit {
+		args = append(args, "--no-audit")
+	}
+	if noCompression != nil && *noCompression {
+		args = append(args, "--no-compression")
+	}
+	if noTitleTrack != nil && *noTitleTrack {
+		args = append(args, "--no-title-track")
+	}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	if shutdownGrace != nil && *shutdownGrace != defaultShutdownGrace {
+		args = append(args, "--shutdown-grace", shutdownGrace.String())
+	}
+	return args
+}
+
 // spawnServer spawns a server process.  When we come back we will end up
 // s.run().
 func (s *Session) Spawn(debugFile string, foreground bool) {
@@ -233,6 +580,7 @@ func (s *Session) Spawn(debugFile string, foreground bool) {
 	if debugFile != "" {
 		args = append(args, "--internal_debug", s.Name+debugSuffix)
 	}
+	args = append(args, serverFlags()...)
 
 	cmd := exec.Command(os.Args[0], args...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{}
@@ -256,6 +604,7 @@ func (s *Session) run(debugFile string) {
 		if debugFile != "" {
 			args = append(args, "--internal_debug", debugFile)
 		}
+		args = append(args, serverFlags()...)
 		cmd := exec.Command(os.Args[0], args...)
 		cmd.SysProcAttr = &syscall.SysProcAttr{
 			Setsid: true,
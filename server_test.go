@@ -0,0 +1,645 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteRateLimit(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	const limit = 1000
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+	s.pty = w
+	s.WriteRateLimit = limit
+
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+	go io.Copy(ioutil.Discard, cc)
+
+	data := bytes.Repeat([]byte("x"), 2*limit)
+	start := time.Now()
+	go NewMessengerWriter(cc).Write(data)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if d, want := time.Since(start), time.Second*time.Duration(len(data))/limit; d < want {
+		t.Errorf("input took %v, want at least %v", d, want)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("shell did not receive the input")
+	}
+}
+
+func TestInputQueue(t *testing.T) {
+	q := newInputQueue(4)
+	if n := q.Write([]byte("ab")); n != 0 {
+		t.Errorf("dropped %d bytes, want 0", n)
+	}
+	if n := q.Write([]byte("cdef")); n != 2 {
+		t.Errorf("dropped %d bytes, want 2", n)
+	}
+	buf, ok := q.next(3)
+	if !ok || string(buf) != "cde" {
+		t.Errorf("got %q, %v, want \"cde\", true", buf, ok)
+	}
+	q.Close()
+	buf, ok = q.next(3)
+	if !ok || string(buf) != "f" {
+		t.Errorf("got %q, %v, want \"f\", true", buf, ok)
+	}
+	if buf, ok = q.next(3); ok {
+		t.Errorf("got %q after close", buf)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	s := NewShell(&Session{Name: "test", path: dir})
+	a, err := openAuditLog(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	s.auditLog = a
+
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	replies := make(chan string, 10)
+	r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == serverMessage {
+			replies <- string(data)
+		}
+	})
+	go io.Copy(ioutil.Discard, r)
+
+	w := NewMessengerWriter(cc)
+	w.Send(ttynameMessage, []byte("auditclient"))
+	w.Send(saveMessage, []byte(filepath.Join(dir, "screen")))
+	select {
+	case <-replies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to saveMessage")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var e auditEntry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad audit line %q: %v", line, err)
+		}
+		if e.Client == "auditclient" && e.Kind == "saveMessage" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("saveMessage from auditclient not in audit log:\n%s", data)
+	}
+}
+
+func TestSetenv(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+	s.pty = w
+	s.Env = []string{"FOO=old"}
+
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	envs := make(chan []string, 1)
+	mr := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == envMessage {
+			envs <- strings.Split(string(data), "\000")
+		}
+	})
+	go io.Copy(ioutil.Discard, mr)
+
+	mw := NewMessengerWriter(cc)
+	mw.Send(setenvMessage, []byte("FOO\000bar $x"))
+	want := "export FOO=\"bar \\$x\"\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("shell got %q, want %q", got, want)
+	}
+
+	mw.Send(envMessage, nil)
+	select {
+	case env := <-envs:
+		if strings.Join(env, " ") != "FOO=bar $x" {
+			t.Errorf("got environment %q, want FOO=bar $x", env)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to envMessage")
+	}
+}
+
+func TestClientLimit(t *testing.T) {
+	session := &Session{Name: "test", path: t.TempDir()}
+	s := NewShell(session)
+	s.SetMaxClients(1)
+	if n := session.MaxClients(); n != 1 {
+		t.Errorf("session recorded limit %d, want 1", n)
+	}
+
+	// connect attaches a new client and returns a channel of its
+	// startMessages and serverMessages and a channel closed when its
+	// connection is closed.
+	connect := func(name string) (net.Conn, chan string, chan struct{}) {
+		sc, cc := net.Pipe()
+		go s.attach(sc)
+		msgs := make(chan string, 10)
+		closed := make(chan struct{})
+		r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+			switch kind {
+			case startMessage:
+				msgs <- "start"
+			case serverMessage:
+				msgs <- string(data)
+			}
+		})
+		go func() {
+			io.Copy(ioutil.Discard, r)
+			close(closed)
+		}()
+		NewMessengerWriter(cc).Send(ttynameMessage, []byte(name))
+		return cc, msgs, closed
+	}
+
+	c1, msgs, _ := connect("first")
+	defer c1.Close()
+	select {
+	case msg := <-msgs:
+		if msg != "start" {
+			t.Fatalf("first client got %q, want start", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first client was not attached")
+	}
+
+	c2, msgs, closed := connect("second")
+	defer c2.Close()
+	select {
+	case msg := <-msgs:
+		if !strings.Contains(msg, "limit 1") {
+			t.Errorf("second client got %q, want a rejection", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second client was not rejected")
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second client was not closed")
+	}
+	if n := s.Stats().CurrentClients; n != 1 {
+		t.Errorf("got %d clients, want 1", n)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir := t.TempDir()
+	s := NewShell(&Session{Name: "test", path: dir})
+	s.eb.Write([]byte("$ echo one\r\none\r\n"))
+	saved := filepath.Join(dir, "screen")
+	if err := saveSnapshot(saved, s.eb.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	s.eb.Write([]byte("\033[1mtwo\033[m\r\n"))
+
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	replies := make(chan string, 1)
+	r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == serverMessage {
+			replies <- string(data)
+		}
+	})
+	go io.Copy(ioutil.Discard, r)
+
+	NewMessengerWriter(cc).Send(diffMessage, []byte(saved))
+	select {
+	case got := <-replies:
+		want := "--- " + saved + "\r\n+++ screen\r\n@@ -1,2 +1,3 @@\r\n $ echo one\r\n one\r\n+two\r\n"
+		if got != want {
+			t.Errorf("got diff:\n%s\nwant:\n%s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to diffMessage")
+	}
+}
+
+func TestDump(t *testing.T) {
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	dump := make(chan string, 1)
+	r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == serverMessage {
+			dump <- string(data)
+		}
+	})
+	go io.Copy(ioutil.Discard, r)
+
+	NewMessengerWriter(cc).Send(dumpMessage, nil)
+	select {
+	case got := <-dump:
+		if !strings.Contains(got, "(*Shell).attach") {
+			t.Errorf("dump is missing (*Shell).attach:\n%s", got)
+		}
+		if strings.Contains(strings.ReplaceAll(got, "\r\n", ""), "\n") {
+			t.Errorf("dump contains a bare newline")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to dumpMessage")
+	}
+}
+
+func TestDumpToFile(t *testing.T) {
+	dir := t.TempDir()
+	s := NewShell(&Session{Name: "test", path: dir})
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	replies := make(chan string, 1)
+	r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == serverMessage {
+			replies <- string(data)
+		}
+	})
+	go io.Copy(ioutil.Discard, r)
+
+	path := filepath.Join(dir, "dump.txt")
+	NewMessengerWriter(cc).Send(dumpMessage, []byte(path))
+	select {
+	case got := <-replies:
+		if want := "goroutines dumped to " + path + "\r\n"; got != want {
+			t.Errorf("got reply %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to dumpMessage")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("(*Shell).attach")) {
+		t.Errorf("dump is missing (*Shell).attach:\n%s", data)
+	}
+
+	NewMessengerWriter(cc).Send(dumpMessage, []byte(filepath.Join(dir, "missing", "dump.txt")))
+	select {
+	case got := <-replies:
+		if !strings.HasPrefix(got, "ERROR: ") {
+			t.Errorf("got reply %q, want an error", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to dumpMessage")
+	}
+}
+
+func TestListVerbose(t *testing.T) {
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+	s.eb.Write([]byte("$ make\r\n\033[32mok\033[m\r\n\r\n"))
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	replies := make(chan string, 1)
+	r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == serverMessage {
+			replies <- string(data)
+		}
+	})
+	go io.Copy(ioutil.Discard, r)
+
+	w := NewMessengerWriter(cc)
+	w.Send(ttynameMessage, []byte("client"))
+	w.Send(listMessage, []byte("-v"))
+	select {
+	case got := <-replies:
+		var info SessionInfo
+		if err := json.Unmarshal([]byte(got), &info); err != nil {
+			t.Fatalf("bad reply %q: %v", got, err)
+		}
+		if info.LastLine != "ok" {
+			t.Errorf("got LastLine %q, want ok", info.LastLine)
+		}
+		if info.Name != "test" || len(info.Clients) != 1 || info.Clients[0] != "client" {
+			t.Errorf("got %+v", info)
+		}
+		if info.Age < 0 || info.Idle < 0 {
+			t.Errorf("got age %v and idle %v", info.Age, info.Idle)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to listMessage")
+	}
+}
+
+func TestExclusiveAfter(t *testing.T) {
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+
+	// connect attaches a new client and returns its connection and a
+	// channel of its serverMessages.
+	connect := func(name string) (net.Conn, chan string) {
+		sc, cc := net.Pipe()
+		go s.attach(sc)
+		msgs := make(chan string, 10)
+		r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+			if kind == serverMessage {
+				msgs <- string(data)
+			}
+		})
+		go io.Copy(ioutil.Discard, r)
+		NewMessengerWriter(cc).Send(ttynameMessage, []byte(name))
+		return cc, msgs
+	}
+	// waitClients waits for s to have n attached clients.
+	waitClients := func(n int) {
+		t.Helper()
+		for start := time.Now(); s.Stats().CurrentClients != n; time.Sleep(10 * time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("got %d clients, want %d", s.Stats().CurrentClients, n)
+			}
+		}
+	}
+	expect := func(who string, msgs chan string, want string) {
+		t.Helper()
+		select {
+		case msg := <-msgs:
+			if !strings.Contains(msg, want) {
+				t.Errorf("%s got %q, want %q", who, msg, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s did not get %q", who, want)
+		}
+	}
+
+	c1, msgs1 := connect("first")
+	defer c1.Close()
+	var others []chan string
+	for _, name := range []string{"second", "third"} {
+		c, msgs := connect(name)
+		defer c.Close()
+		others = append(others, msgs)
+	}
+	waitClients(3)
+
+	// A cancelled countdown does not detach anyone.
+	w := NewMessengerWriter(c1)
+	w.Send(exclusiveMessage, []byte("1h"))
+	expect("first", msgs1, "detaching other clients in 1h0m0s")
+	for _, msgs := range others {
+		expect("other", msgs, "detached in 1h0m0s by client first")
+	}
+	w.Send(cancelMessage, nil)
+	expect("first", msgs1, "detach cancelled")
+	for _, msgs := range others {
+		expect("other", msgs, "cancelled")
+	}
+	w.Send(cancelMessage, nil)
+	expect("first", msgs1, "nothing to cancel")
+	if n := s.Stats().CurrentClients; n != 3 {
+		t.Errorf("after cancel got %d clients, want 3", n)
+	}
+
+	w.Send(exclusiveMessage, []byte("100ms"))
+	expect("first", msgs1, "detaching other clients in 100ms")
+	for _, msgs := range others {
+		expect("other", msgs, "detached in 100ms by client first")
+	}
+	waitClients(1)
+}
+
+func TestBroadcastEnv(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+	s.pty = pw
+
+	// connect attaches a new client and returns its connection and a
+	// channel of its broadcastEnvMessages.
+	connect := func(name string) (net.Conn, chan string) {
+		sc, cc := net.Pipe()
+		go s.attach(sc)
+		msgs := make(chan string, 10)
+		r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+			if kind == broadcastEnvMessage {
+				msgs <- string(data)
+			}
+		})
+		go io.Copy(ioutil.Discard, r)
+		NewMessengerWriter(cc).Send(ttynameMessage, []byte(name))
+		return cc, msgs
+	}
+	c1, msgs1 := connect("first")
+	defer c1.Close()
+	c2, msgs2 := connect("second")
+	defer c2.Close()
+	for start := time.Now(); s.Stats().CurrentClients != 2; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("got %d clients, want 2", s.Stats().CurrentClients)
+		}
+	}
+
+	// A forwarded variable is already exported by the forwarder, so it
+	// is only broadcast.
+	s.Setenv("SSH_AUTH_SOCK", "SSH_AUTH_SOCK"+fwdSuffix)
+	const fwd = "SSH_AUTH_SOCK\000SSH_AUTH_SOCK" + fwdSuffix
+	NewMessengerWriter(c1).Send(broadcastEnvMessage, []byte(fwd))
+	select {
+	case got := <-msgs2:
+		if got != fwd {
+			t.Errorf("second client got %q, want %q", got, fwd)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second client did not receive the forwarded message")
+	}
+
+	const msg = "SSH_AUTH_SOCK\000/tmp/ssh-new/agent.1"
+	NewMessengerWriter(c1).Send(broadcastEnvMessage, []byte(msg))
+
+	// The server exports the variable in the shell once.  The forwarded
+	// variable was not exported again.
+	want := "export SSH_AUTH_SOCK=\"/tmp/ssh-new/agent.1\"\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(pr, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("shell got %q, want %q", got, want)
+	}
+
+	select {
+	case got := <-msgs2:
+		if got != msg {
+			t.Errorf("second client got %q, want %q", got, msg)
+		}
+		line, err := broadcastEnv([]byte(got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `[another client exported SSH_AUTH_SOCK="/tmp/ssh-new/agent.1"]`; line != want {
+			t.Errorf("second client printed %q, want %q", line, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second client did not receive the message")
+	}
+	select {
+	case got := <-msgs1:
+		t.Errorf("sending client got its own message %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPriorityMessage(t *testing.T) {
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	replies := make(chan string, 1)
+	r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == serverMessage {
+			replies <- string(data)
+		}
+	})
+	go io.Copy(ioutil.Discard, r)
+
+	w := NewMessengerWriter(cc)
+	w.Send(priorityMessage, []byte("3"))
+	w.Send(ttynameMessage, []byte("1:first"))
+	for start := time.Now(); s.Stats().CurrentClients != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("got %d clients, want 1", s.Stats().CurrentClients)
+		}
+	}
+	if p := s.clientList()[0].Priority(); p != 3 {
+		t.Errorf("got priority %d, want 3", p)
+	}
+
+	w.Send(priorityMessage, []byte("high"))
+	select {
+	case got := <-replies:
+		if want := "ERROR: BAD PRIORITY \"high\"\r\n"; got != want {
+			t.Errorf("got reply %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply to a bad priorityMessage")
+	}
+}
+
+func TestPriorityInput(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	s := NewShell(&Session{Name: "test", path: t.TempDir()})
+	s.pty = pw
+
+	// connect attaches a client with priority and returns its writer and
+	// a channel of its preemptMessages.
+	connect := func(name string, priority int) (*MessengerWriter, chan string) {
+		sc, cc := net.Pipe()
+		t.Cleanup(func() { cc.Close() })
+		go s.attach(sc)
+		msgs := make(chan string, 10)
+		r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+			if kind == preemptMessage && len(data) > 0 {
+				msgs <- string(data)
+			}
+		})
+		go io.Copy(ioutil.Discard, r)
+		w := NewMessengerWriter(cc)
+		w.Sendf(priorityMessage, "%d", priority)
+		w.Sendf(ttynameMessage, "1:%s", name)
+		return w, msgs
+	}
+	high, _ := connect("high", 2)
+	low, lowMsgs := connect("low", 1)
+	for start := time.Now(); s.Stats().CurrentClients != 2; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("got %d clients, want 2", s.Stats().CurrentClients)
+		}
+	}
+	read := func(want string) {
+		t.Helper()
+		got := make([]byte, len(want))
+		if _, err := io.ReadFull(pr, got); err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("shell got %q, want %q", got, want)
+		}
+	}
+
+	high.Write([]byte("a"))
+	read("a")
+	low.Write([]byte("b"))
+	select {
+	case got := <-lowMsgs:
+		if !strings.Contains(got, "input discarded") {
+			t.Errorf("low priority client got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("low priority client was not warned")
+	}
+	// The low priority client's input never reached the shell.
+	high.Write([]byte("c"))
+	read("c")
+}
@@ -15,17 +15,22 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/pborman/pty/log"
+	ttyname "github.com/pborman/pty/tty"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -34,48 +39,131 @@ import (
 // the Name and the path.  A server will call Listen on the session while a
 // client will call Dial on the session.
 type Session struct {
-	Name    string // Name of the session (client and server)
-	cnt     int    // Set by Check to the current number of clients
-	path    string // The directory for this session
-	spawn   bool   // respawn rather than execing a shell
-	started bool   // set true if we started the session
+	Name      string   // Name of the session (client and server)
+	Namespace string   // Namespace of the session, "" for the default
+	cnt       int      // Set by Check to the current number of clients
+	path      string   // The directory for this session
+	spawn     bool     // respawn rather than execing a shell
+	started   bool     // set true if we started the session
+	lockFile  *os.File // the locked lock file of a server (see Listen)
 
 	// Below are fields only used by a client
 	ostate *terminal.State
 	tilde  byte
 }
 
-const validBytes = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_-.+!=:[]<>{}"
+const (
+	alnumBytes = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	validBytes = alnumBytes + "_-.+!=:[]<>{}"
+)
 
+// ValidSessionName returns true if name may be used as a session name.
+// Letters and digits are always allowed.  The other allowed characters are
+// config.AllowedNameChars, if set, otherwise those in validBytes.  A / is
+// never allowed, sessions are only looked for directly in the session
+// directory.
 func ValidSessionName(name string) bool {
-	if name == "log" {
+	if name == "log" || name == "." || name == ".." || strings.Contains(name, "/") {
 		return false
 	}
+	allowed := validBytes
+	if config.AllowedNameChars != "" {
+		allowed = alnumBytes + config.AllowedNameChars
+	}
 	for _, c := range name {
-		if !strings.Contains(validBytes, string(c)) {
+		if !strings.Contains(allowed, string(c)) {
 			return false
 		}
 	}
 	return true
 }
 
-func MakeSession(name, id string) *Session {
-	// We assume ValidSessionName was called
+// namespace is the namespace of the sessions used by this process.  It is set
+// by the --namespace flag.
+var namespace string
+
+// ValidNamespaceName returns true if name may be used as a session namespace.
+// The empty name is the default namespace.  Otherwise the name may contain
+// letters, digits, and the characters in "_-.", but may not be a name used
+// by pty in its own directory.
+func ValidNamespaceName(name string) bool {
+	switch name {
+	case "":
+		return true
+	case ".", "..", "log":
+		return false
+	}
+	for _, c := range name {
+		if !strings.Contains(alnumBytes+"_-.", string(c)) {
+			return false
+		}
+	}
+	fi, err := os.Stat(filepath.Join(user.HomeDir, rcdir, name))
+	return err != nil || fi.IsDir()
+}
+
+// MakeSession returns the session named name in the namespace ns.  Sessions
+// in the namespace ns live in ~/.pty/ns rather than ~/.pty.  An error is
+// returned if the session's directory fails Verify.
+func MakeSession(ns, name, id string) (*Session, error) {
+	// We assume ValidSessionName and ValidNamespaceName were called
 	spawn := strings.HasPrefix(name, "+")
 	if spawn {
 		name = name[1:]
 	}
 	s := &Session{
-		Name:  name,
-		path:  filepath.Join(user.HomeDir, rcdir, "@"+name),
-		spawn: spawn,
-		tilde: byte('P' & 0x1f),
+		Name:      name,
+		Namespace: ns,
+		path:      filepath.Join(user.HomeDir, rcdir, ns, "@"+name),
+		spawn:     spawn,
+		tilde:     byte('P' & 0x1f),
+	}
+	s.create()
+	if err := s.Verify(); err != nil {
+		return nil, err
 	}
-	os.MkdirAll(s.path, 0700)
 	if id != "" {
 		s.SetSessionID(id)
 	}
-	return s
+	return s, nil
+}
+
+// Verify returns an error if the session's directory is not a directory owned
+// by the current user.  A directory with a mode other than 0700, such as one
+// left by a crashed server, is changed to 0700.
+func (s *Session) Verify() error {
+	fi, err := os.Lstat(s.path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.path)
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by uid %d", s.path, st.Uid)
+	}
+	if fi.Mode().Perm() != 0700 {
+		log.Warnf("%s has mode %v, changing to 0700", s.path, fi.Mode().Perm())
+		if err := os.Chmod(s.path, 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// create creates the session's directory, if it does not already exist, and
+// records when it was created.
+func (s *Session) create() {
+	if _, err := os.Stat(s.path); !os.IsNotExist(err) {
+		return
+	}
+	if s.Namespace != "" {
+		os.Mkdir(filepath.Dir(s.path), 0700)
+	}
+	if err := os.MkdirAll(s.path, 0700); err != nil {
+		return
+	}
+	s.writefile("created_at", strconv.FormatInt(time.Now().Unix(), 10))
 }
 
 func (s *Session) Attach(id string) *Session {
@@ -87,6 +175,37 @@ func (s *Session) Remove() {
 	if s.path != "" {
 		os.RemoveAll(s.path)
 	}
+	s.unlock()
+}
+
+// lock takes an exclusive lock on the lock file in the session's directory.
+// The lock is held until the session is removed or the process exits.  An
+// error is returned if another process holds the lock.
+func (s *Session) lock() error {
+	if s.lockFile != nil {
+		return nil
+	}
+	f, err := os.OpenFile(filepath.Join(s.path, "lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return fmt.Errorf("session %s is locked by another server", s.Name)
+		}
+		return fmt.Errorf("session %s: lock: %v", s.Name, err)
+	}
+	s.lockFile = f
+	return nil
+}
+
+// unlock releases the lock taken by lock, if any.
+func (s *Session) unlock() {
+	if s.lockFile != nil {
+		s.lockFile.Close()
+		s.lockFile = nil
+	}
 }
 
 func (s *Session) readfile(n string) (string, error) {
@@ -119,11 +238,38 @@ func (s *Session) Title() string {
 	return ""
 }
 
+// MaxClients returns the client limit recorded by the session's server, or 0
+// if there is no limit.
+func (s *Session) MaxClients() int {
+	data, err := s.readfile("max_clients")
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(data)
+	return n
+}
+
+// Addr returns the address the session's server listens on, without the
+// network recorded by SetAddr.
 func (s *Session) Addr() string {
-	if data, err := s.readfile("addr"); err == nil {
-		return data
+	_, addr := s.netAddr()
+	return addr
+}
+
+// netAddr returns the network and address recorded by SetAddr.  An address
+// recorded without a network, by an older server, uses the "tcp" network.
+func (s *Session) netAddr() (network, addr string) {
+	data, err := s.readfile("addr")
+	if err != nil {
+		return "", ""
 	}
-	return ""
+	if x := strings.Index(data, ":"); x > 0 {
+		switch data[:x] {
+		case "tcp", "tcp4", "tcp6":
+			return data[:x], data[x+1:]
+		}
+	}
+	return "tcp", data
 }
 
 func (s *Session) TTYSize() string {
@@ -152,9 +298,14 @@ func (s *Session) SetTitle(title string) error {
 	return s.writefile("title", title)
 }
 
-func (s *Session) SetAddr(addr string) error {
-	// s.addr = addr
-	return s.writefile("addr", addr)
+// SetAddr records the network (e.g., "tcp6") and address the session's
+// server listens on.  The file is only readable and writable by the current
+// user, even if it already existed.
+func (s *Session) SetAddr(network, addr string) error {
+	if err := s.writefile("addr", network+":"+addr); err != nil {
+		return err
+	}
+	return os.Chmod(filepath.Join(s.path, "addr"), 0600)
 }
 
 func (s *Session) SetTTYSize(rows, cols int) error {
@@ -164,15 +315,193 @@ func (s *Session) SetTTYSize(rows, cols int) error {
 	return err
 }
 
+// SetTTY records the path of the terminal device of the session's shell.
+func (s *Session) SetTTY(path string) error {
+	return s.writefile("tty", path)
+}
+
+// TTY returns the path of the terminal device of the session's shell, or the
+// empty string if it is not known.
+func (s *Session) TTY() string {
+	if data, err := s.readfile("tty"); err == nil {
+		return data
+	}
+	return ""
+}
+
 func (s *Session) SetSessionID(id string) error {
 	return s.writefile("id", id)
 }
 
+// LastActive returns the last time a client sent data to the session's shell.
+// The zero time is returned if the time is not known.
+func (s *Session) LastActive() time.Time {
+	data, err := s.readfile("last_active")
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, data)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// CreatedAt returns when the session was created.  The zero time is returned
+// if the time is not known.
+func (s *Session) CreatedAt() time.Time {
+	data, err := s.readfile("created_at")
+	if err != nil {
+		return time.Time{}
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(data), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(secs, 0)
+}
+
+func (s *Session) SetLastActive(t time.Time) error {
+	return s.writefile("last_active", t.Format(time.RFC3339Nano))
+}
+
+// Environ returns the environment of the session's shell.
+func (s *Session) Environ() ([]string, error) {
+	msg, err := s.Command(envMessage, envMessage)
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	for _, kv := range strings.Split(msg, "\x00") {
+		if kv != "" {
+			env = append(env, kv)
+		}
+	}
+	return env, nil
+}
+
+// cloneEnv returns the environment saved by Clone for the session's shell.
+func (s *Session) cloneEnv() ([]string, error) {
+	data, err := s.readfile("clone_env")
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	for _, kv := range strings.Split(data, "\x00") {
+		if kv != "" {
+			env = append(env, kv)
+		}
+	}
+	return env, nil
+}
+
+func (s *Session) setCloneEnv(env []string) error {
+	return s.writefile("clone_env", strings.Join(env, "\x00"))
+}
+
+// Clone starts a new session named newName whose shell has the same
+// environment as the shell of s.  The new session runs its own shell.
+func (s *Session) Clone(newName string) (*Session, error) {
+	if !ValidSessionName(newName) {
+		return nil, fmt.Errorf("invalid session name: %q", newName)
+	}
+	env, err := s.Environ()
+	if err != nil {
+		return nil, err
+	}
+	ns, err := MakeSession(s.Namespace, newName, "")
+	if err != nil {
+		return nil, err
+	}
+	if ns.Check() {
+		return nil, fmt.Errorf("session %q already exists", newName)
+	}
+	if err := ns.setCloneEnv(env); err != nil {
+		ns.Remove()
+		return nil, err
+	}
+	ns.Spawn("", false)
+	return ns, nil
+}
+
+// A SessionFilter selects sessions returned by GetSessionsFiltered.
+type SessionFilter struct {
+	Namespace  string // Only sessions in Namespace
+	NamePrefix string // Only sessions whose name starts with NamePrefix
+	MinClients int    // Only sessions with at least MinClients clients
+	MaxClients int    // If not 0, only sessions with at most MaxClients clients
+	Active     bool   // Only sessions with at least one client
+}
+
+// GetSessionsFiltered returns the running sessions selected by f, most
+// recently active first.
+func GetSessionsFiltered(f SessionFilter) []*Session {
+	return filterSessions(GetSessions(f.Namespace), f)
+}
+
+// filterSessions returns the sessions selected by f sorted by their last
+// active time, most recent first.  Sessions with the same last active time
+// are sorted by name.
+func filterSessions(sessions []*Session, f SessionFilter) []*Session {
+	type session struct {
+		s          *Session
+		lastActive time.Time
+	}
+	var selected []session
+	for _, s := range sessions {
+		switch {
+		case !strings.HasPrefix(s.Name, f.NamePrefix):
+		case s.cnt < f.MinClients:
+		case f.MaxClients > 0 && s.cnt > f.MaxClients:
+		case f.Active && s.cnt == 0:
+		default:
+			selected = append(selected, session{s, s.LastActive()})
+		}
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		ti, tj := selected[i].lastActive, selected[j].lastActive
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return selected[i].s.Name < selected[j].s.Name
+	})
+	var out []*Session
+	for _, s := range selected {
+		out = append(out, s.s)
+	}
+	return out
+}
+
 func (s *Session) Ping() bool {
 	pid, ok := s.Pid()
 	return ok && syscall.Kill(pid, 0) == nil
 }
 
+// defaultGCThreshold is used when gc_threshold is not set in the
+// configuration file.
+const defaultGCThreshold = time.Minute
+
+// gcThreshold returns how long ago the pid file of a session whose server is
+// not running must have been written before the session is removed.
+func gcThreshold() time.Duration {
+	if config.GCThreshold > 0 {
+		return config.GCThreshold
+	}
+	return defaultGCThreshold
+}
+
+// Stale reports whether s was left behind by a server that is no longer
+// running: its server does not answer Ping and its pid file was written more
+// than threshold ago.  The threshold keeps a session whose server is still
+// starting from being considered stale.
+func (s *Session) Stale(threshold time.Duration) bool {
+	if s.Ping() {
+		return false
+	}
+	fi, err := os.Stat(filepath.Join(s.path, "pid"))
+	return err == nil && time.Since(fi.ModTime()) > threshold
+}
+
 func (s *Session) Check() bool {
 	if !s.Ping() {
 		return false
@@ -188,6 +517,93 @@ func (s *Session) Check() bool {
 	return false
 }
 
+// MultiCommand sends a req message to the session's server and returns the
+// contents of each resp message received up to, but not including, the first
+// empty resp message.  An error is returned, along with the messages received
+// so far, if the empty message is not received within timeout.
+func (s *Session) MultiCommand(req, resp messageKind, timeout time.Duration) ([]string, error) {
+	client, err := s.dialCommand()
+	if err != nil {
+		return nil, err
+	}
+	defer checkClose(client)
+
+	ch := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	r := NewMessengerReader(client, func(kind messageKind, msg []byte) {
+		if kind == resp {
+			select {
+			case ch <- msg:
+			case <-done:
+			}
+		}
+	})
+	go io.Copy(ioutil.Discard, r)
+	NewMessengerWriter(client).Send(req, nil)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var msgs []string
+	for {
+		select {
+		case <-timer.C:
+			return msgs, fmt.Errorf("Session %s timed out", s.Name)
+		case msg := <-ch:
+			if len(msg) == 0 {
+				return msgs, nil
+			}
+			msgs = append(msgs, string(msg))
+		}
+	}
+}
+
+// dialCommand dials s to send it a command.  A session that cannot be dialed
+// is removed unless its address file is unsafe.
+func (s *Session) dialCommand() (net.Conn, error) {
+	client, err := s.Dial()
+	if err == nil {
+		return client, nil
+	}
+	log.Infof("Dialing %s %v", s.Name, err)
+	if errors.Is(err, unsafeErr) {
+		return nil, err
+	}
+	s.Remove()
+	if strings.Contains(err.Error(), "connect: connection refused") {
+		return nil, removedErr
+	}
+	return nil, err
+}
+
+// unsafeErr is returned by Dial when the session's addr file could have been
+// written by another user.
+var unsafeErr = errors.New("unsafe address file")
+
+// checkOwner returns an error wrapping unsafeErr if the file path is not a
+// regular file owned by the current user that only the current user may
+// write.
+func checkOwner(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return fmt.Errorf("%w: %s is owned by uid %d", unsafeErr, path, st.Uid)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%w: %s is not a regular file", unsafeErr, path)
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("%w: %s has mode %v", unsafeErr, path, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// Dial connects to the session's server.  The session's server listens on
+// the loopback address recorded in the session's addr file.  An error is
+// returned if the addr file could have been written by another user, which
+// would let them redirect the connection.
 func (s *Session) Dial() (net.Conn, error) {
 	start := time.Now()
 	for {
@@ -199,23 +615,54 @@ func (s *Session) Dial() (net.Conn, error) {
 		}
 		time.Sleep(time.Second / 10)
 	}
-	addr, err := net.ResolveTCPAddr("tcp", s.Addr())
+	if err := checkOwner(filepath.Join(s.path, "addr")); err != nil {
+		return nil, err
+	}
+	network, hostport := s.netAddr()
+	addr, err := net.ResolveTCPAddr(network, hostport)
 	if err != nil {
 		return nil, err
 	}
-	log.Infof("Dialing %s @ %v", s.Name, addr)
-	return net.DialTCP("tcp", nil, addr)
+	log.Infof("Dialing %s @ %s %v", s.Name, network, addr)
+	return net.DialTCP(network, nil, addr)
 }
 
+// listenTCP is net.ListenTCP.  It is a variable for testing.
+var listenTCP = net.ListenTCP
+
+// loopbacks are the loopback addresses Listen tries, in order.
+var loopbacks = []struct {
+	network string
+	ip      net.IP
+}{
+	{"tcp6", net.IPv6loopback},
+	{"tcp4", net.IPv4(127, 0, 0, 1)},
+}
+
+// Listen listens on the IPv6 loopback address, falling back to the IPv4
+// loopback address if IPv6 is not available, and records the address with
+// SetAddr.  The session is first locked so that only one server can run it;
+// an error is returned if another server holds the lock.
 func (s *Session) Listen() (net.Listener, error) {
-	addr := &net.TCPAddr{
-		IP: net.IPv4(127, 0, 0, 1),
+	// Only one server may listen for a session.
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	var conn *net.TCPListener
+	var network string
+	var err error
+	for _, lb := range loopbacks {
+		network = lb.network
+		conn, err = listenTCP(network, &net.TCPAddr{IP: lb.ip})
+		if err == nil {
+			break
+		}
+		log.Infof("listen %s: %v", network, err)
 	}
-	conn, err := net.ListenTCP("tcp", addr)
 	if err != nil {
 		s.Exitf("server: %v", err)
 	}
-	if err := s.SetAddr(conn.Addr().String()); err != nil {
+	if err := s.SetAddr(network, conn.Addr().String()); err != nil {
 		s.Remove()
 		conn.Close()
 		return nil, err
@@ -228,14 +675,16 @@ func (s *Session) Listen() (net.Listener, error) {
 	return conn, nil
 }
 
+// Command sends a req message to the session's server and returns the
+// contents of the first resp message received.
 func (s *Session) Command(req, resp messageKind) (string, error) {
-	client, err := s.Dial()
+	return s.Request(req, resp, nil)
+}
+
+// Request is like Command but includes data in the req message.
+func (s *Session) Request(req, resp messageKind, data []byte) (string, error) {
+	client, err := s.dialCommand()
 	if err != nil {
-		log.Infof("Dialing %s %v", s.Name, err)
-		s.Remove()
-		if strings.Contains(err.Error(), "connect: connection refused") {
-			return "", removedErr
-		}
 		return "", err
 	}
 	defer func() {
@@ -243,15 +692,15 @@ func (s *Session) Command(req, resp messageKind) (string, error) {
 	}()
 
 	w := NewMessengerWriter(client)
-	w.Sendf(req, "")
+	w.Send(req, data)
 	ch := make(chan []byte, 2)
 
-	r := NewMessengerReader(client, func(kind messageKind, data []byte) {
+	r := NewMessengerReader(client, func(kind messageKind, msg []byte) {
 		switch kind {
 		case startMessage:
-			w.Sendf(req, "")
+			w.Send(req, data)
 		case resp:
-			ch <- data
+			ch <- msg
 		}
 	})
 
@@ -272,6 +721,19 @@ func (s *Session) Command(req, resp messageKind) (string, error) {
 	}
 }
 
+// Run injects cmd into the session's shell as if it had been typed at the
+// prompt.
+func (s *Session) Run(cmd string) error {
+	msg, err := s.Request(runMessage, runMessage, []byte(cmd))
+	if err != nil {
+		return err
+	}
+	if msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
 func (s *Session) PS() string {
 	pid, ok := s.Pid()
 	if ok {
@@ -280,13 +742,37 @@ func (s *Session) PS() string {
 	return ""
 }
 
+// PSForTTY returns the processes whose controlling terminal is the session's
+// pty.  Unlike PS, it leaves out processes started from the session that are
+// no longer attached to its terminal, such as daemons.
+func (s *Session) PSForTTY() string {
+	tty := s.TTY()
+	if tty == "" {
+		return ""
+	}
+	return PSForTTY(tty)
+}
+
+// Info returns information about the session from its server.
+func (s *Session) Info() (*SessionInfo, error) {
+	msg, err := s.Request(listMessage, serverMessage, []byte("-v"))
+	if err != nil {
+		return nil, err
+	}
+	var info SessionInfo
+	if err := json.Unmarshal([]byte(msg), &info); err != nil {
+		return nil, fmt.Errorf("%s: %s", s.Name, strings.TrimSpace(msg))
+	}
+	return &info, nil
+}
+
 func isPipe() bool {
 	st, _ := os.Stdin.Stat()
 	return (uint32(st.Mode()) & uint32(os.ModeNamedPipe)) != 0
 }
 
 func (s *Session) MakeRaw() (err error) {
-	if isPipe() {
+	if isPipe() || !ttyname.IsATTY(0) {
 		return nil
 	}
 	if s.ostate != nil {
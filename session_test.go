@@ -0,0 +1,703 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFilterSessions(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	var sessions []*Session
+	for _, s := range []struct {
+		name string
+		cnt  int
+		age  time.Duration
+	}{
+		{"alpha", 0, time.Hour},
+		{"beta", 1, time.Minute},
+		{"alpine", 2, time.Second},
+	} {
+		session := &Session{Name: s.name, cnt: s.cnt, path: dir + "/@" + s.name}
+		if err := os.Mkdir(session.path, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := session.SetLastActive(now.Add(-s.age)); err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, session)
+	}
+	// A session that has never been active sorts last.
+	idle := &Session{Name: "idle", path: dir + "/@idle"}
+	sessions = append(sessions, idle)
+
+	for _, tt := range []struct {
+		name   string
+		filter SessionFilter
+		want   []string
+	}{
+		{"all", SessionFilter{}, []string{"alpine", "beta", "alpha", "idle"}},
+		{"prefix", SessionFilter{NamePrefix: "al"}, []string{"alpine", "alpha"}},
+		{"active", SessionFilter{Active: true}, []string{"alpine", "beta"}},
+		{"min", SessionFilter{MinClients: 2}, []string{"alpine"}},
+		{"max", SessionFilter{MaxClients: 1}, []string{"beta", "alpha", "idle"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range filterSessions(sessions, tt.filter) {
+				got = append(got, s.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	const sh = "/bin/sh"
+	if _, err := os.Stat(sh); err != nil {
+		t.Skipf("no %s", sh)
+	}
+	dir := t.TempDir()
+	newSession := func(name string) *Session {
+		s := &Session{Name: name, path: filepath.Join(dir, "@"+name)}
+		if err := os.Mkdir(s.path, 0700); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	// The original shell only needs to be a process with an environment.
+	orig := NewShell(newSession("orig"))
+	orig.Env = append(orig.Env, "MYVAR=test")
+	orig.cmd = exec.Command("sleep", "30")
+	orig.cmd.Env = orig.Env
+	if err := orig.cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer orig.cmd.Process.Kill()
+	// The environment is not in /proc until sleep has been exec'd.
+	var env []string
+	found := false
+	for start := time.Now(); !found && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		env = orig.Environ()
+		for _, kv := range env {
+			found = found || kv == "MYVAR=test"
+		}
+	}
+	if !found {
+		t.Fatalf("MYVAR=test not in environment %q", env)
+	}
+
+	clone := newSession("clone")
+	if err := clone.setCloneEnv(env); err != nil {
+		t.Fatal(err)
+	}
+	s := newSessionShell(clone)
+	if _, err := clone.cloneEnv(); !os.IsNotExist(err) {
+		t.Errorf("cloned environment not removed: %v", err)
+	}
+	s.Shell = sh
+	s.Args = []string{"sh"}
+	startShell(t, s)
+	var out writeRecorder
+	c := NewClient(&out)
+	defer c.Close()
+	s.Attach(c)
+	if err := s.RunCommand("echo $MYVAR"); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		out.mu.Lock()
+		got := strings.Join(out.writes, "")
+		out.mu.Unlock()
+		if strings.Contains(got, "\ntest") {
+			return
+		}
+	}
+	t.Errorf("clone did not inherit MYVAR")
+}
+
+func TestValidSessionName(t *testing.T) {
+	defer func(chars string) { config.AllowedNameChars = chars }(config.AllowedNameChars)
+	for _, tt := range []struct {
+		chars string
+		name  string
+		want  bool
+	}{
+		{"", "work", true},
+		{"", "my_session-1.2", true},
+		{"", "project/component", false},
+		{"", "log", false},
+		{"", ".", false},
+		{"", "..", false},
+		{".:_-", "project:component.1", true},
+		{".:_-", "a+b", false},
+		{".:_-", ".", false},
+		{"/.:_-", "project/component", false},
+		{"/.:_-", "/project", false},
+	} {
+		config.AllowedNameChars = tt.chars
+		if got := ValidSessionName(tt.name); got != tt.want {
+			t.Errorf("ValidSessionName(%q) with %q got %v, want %v", tt.name, tt.chars, got, tt.want)
+		}
+	}
+}
+
+func TestSessionTimes(t *testing.T) {
+	s := &Session{Name: "test", path: filepath.Join(t.TempDir(), "@test")}
+	s.create()
+	created := s.CreatedAt()
+	if created.IsZero() {
+		t.Fatalf("created_at not set")
+	}
+	if !s.LastActive().IsZero() {
+		t.Errorf("new session has a last active time")
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	s.create() // the session already exists
+	if err := s.SetLastActive(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.CreatedAt(); !got.Equal(created) {
+		t.Errorf("created at changed from %v to %v", created, got)
+	}
+	if got := s.LastActive(); !got.After(created) {
+		t.Errorf("last active %v is not after created at %v", got, created)
+	}
+}
+
+func TestAgo(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{5 * time.Second, "5s ago"},
+		{3*time.Minute + 10*time.Second, "3m ago"},
+		{2 * time.Hour, "2h ago"},
+		{50 * time.Hour, "2d ago"},
+	} {
+		if got := ago(tt.d); got != tt.want {
+			t.Errorf("ago(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestValidNamespaceName(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(user.HomeDir, rcdir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(user.HomeDir, rcdir, "history"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{"", true},
+		{"alice", true},
+		{"team-1.dev", true},
+		{"log", false},
+		{".", false},
+		{"..", false},
+		{"a/b", false},
+		{"@work", false},
+		{"history", false},
+	} {
+		if got := ValidNamespaceName(tt.name); got != tt.want {
+			t.Errorf("ValidNamespaceName(%q) got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	const sh = "/bin/sh"
+	if _, err := os.Stat(sh); err != nil {
+		t.Skipf("no %s", sh)
+	}
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(user.HomeDir, rcdir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := MakeSession("alice", "work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := MakeSession("bob", "work", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.path == b.path {
+		t.Fatalf("both sessions use %s", a.path)
+	}
+	fi, err := os.Stat(filepath.Dir(a.path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode() & 0777; mode != 0700 {
+		t.Errorf("namespace directory has mode %v, want 0700", mode)
+	}
+
+	// Only start the session in alice's namespace.
+	conn, err := a.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := NewShell(a)
+	s.Shell = sh
+	s.Args = []string{"sh"}
+	startShell(t, s)
+	go func() {
+		for {
+			c, err := conn.Accept()
+			if err != nil {
+				return
+			}
+			go s.attach(c)
+		}
+	}()
+
+	if !a.Check() {
+		t.Errorf("session work in alice not running")
+	}
+	if b.Check() {
+		t.Errorf("session work in bob is running")
+	}
+	if got := GetSessions("alice"); len(got) != 1 || got[0].Name != "work" || got[0].Namespace != "alice" {
+		t.Errorf("GetSessions(alice) got %v", got)
+	}
+	if got := GetSessions("bob"); len(got) != 0 {
+		t.Errorf("GetSessions(bob) got %v", got)
+	}
+	if got := GetSessions(""); len(got) != 0 {
+		t.Errorf("GetSessions() got %v", got)
+	}
+}
+
+func TestGetSessionsStale(t *testing.T) {
+	defer func(home string) { user.HomeDir = home }(user.HomeDir)
+	user.HomeDir = t.TempDir()
+	if err := os.Mkdir(filepath.Join(user.HomeDir, rcdir), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pid of a process that has exited and been reaped.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("true: %v", err)
+	}
+	deadPid := cmd.Process.Pid
+
+	mksession := func(name string) *Session {
+		s, err := MakeSession("", name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	live := mksession("live")
+	stale := mksession("stale")
+	starting := mksession("starting")
+	for _, s := range []*Session{stale, starting} {
+		if err := s.SetPid(deadPid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * defaultGCThreshold)
+	if err := os.Chtimes(filepath.Join(stale.path, "pid"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := live.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sh := NewShell(live)
+	go func() {
+		for {
+			c, err := conn.Accept()
+			if err != nil {
+				return
+			}
+			go sh.attach(c)
+		}
+	}()
+
+	if got := GetSessions(""); len(got) != 1 || got[0].Name != "live" {
+		t.Errorf("GetSessions got %v, want [live]", got)
+	}
+	if _, err := os.Stat(stale.path); !os.IsNotExist(err) {
+		t.Errorf("stale session was not removed: %v", err)
+	}
+	for _, s := range []*Session{live, starting} {
+		if _, err := os.Stat(s.path); err != nil {
+			t.Errorf("session %s: %v", s.Name, err)
+		}
+	}
+
+	if got := GCSessions(""); len(got) != 0 {
+		t.Errorf("GCSessions removed %v", got)
+	}
+	old = time.Now().Add(-2 * defaultGCThreshold)
+	if err := os.Chtimes(filepath.Join(starting.path, "pid"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got := GCSessions(""); !reflect.DeepEqual(got, []string{"starting"}) {
+		t.Errorf("GCSessions got %v, want [starting]", got)
+	}
+}
+
+func TestMultiCommand(t *testing.T) {
+	s := &Session{Name: "test", path: t.TempDir()}
+	ln, err := s.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// noSentinel is set once the server should stop sending the empty
+	// message that ends the responses.
+	var noSentinel atomic.Bool
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			end := !noSentinel.Load()
+			go func() {
+				defer c.Close()
+				w := NewMessengerWriter(c)
+				r := NewMessengerReader(c, func(kind messageKind, _ []byte) {
+					if kind != listMessage {
+						return
+					}
+					for _, msg := range []string{"one", "two", "three"} {
+						w.Send(serverMessage, []byte(msg))
+					}
+					w.Send(countMessage, []byte("1"))
+					if end {
+						w.Send(serverMessage, nil)
+					}
+				})
+				io.Copy(ioutil.Discard, r)
+			}()
+		}
+	}()
+
+	got, err := s.MultiCommand(listMessage, serverMessage, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	noSentinel.Store(true)
+	got, err = s.MultiCommand(listMessage, serverMessage, 100*time.Millisecond)
+	if err == nil {
+		t.Errorf("did not time out without the empty message")
+	}
+	if len(got) != 3 {
+		t.Errorf("got %q before timing out, want 3 messages", got)
+	}
+}
+
+func TestListSentinel(t *testing.T) {
+	s := &Session{Name: "test", path: t.TempDir()}
+	ln, err := s.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sh := NewShell(s)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go sh.attach(c)
+		}
+	}()
+	got, err := s.MultiCommand(listMessage, serverMessage, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %q, want no clients", got)
+	}
+}
+
+func TestDialUnsafeAddr(t *testing.T) {
+	s := &Session{Name: "test", path: t.TempDir()}
+	ln, err := s.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { ln.Close() }()
+	addr := filepath.Join(s.path, "addr")
+	fi, err := os.Stat(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0600 {
+		t.Errorf("addr has mode %v, want 0600", mode)
+	}
+	c, err := s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	if err := os.Chmod(addr, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := s.Dial(); !errors.Is(err, unsafeErr) {
+		if c != nil {
+			c.Close()
+		}
+		t.Errorf("Dial with mode 0777 got %v, want %v", err, unsafeErr)
+	}
+	// The session is not removed because of an unsafe addr file.
+	if _, err := s.Command(askCountMessage, countMessage); !errors.Is(err, unsafeErr) {
+		t.Errorf("Command got %v, want %v", err, unsafeErr)
+	}
+	if _, err := os.Stat(addr); err != nil {
+		t.Errorf("session removed: %v", err)
+	}
+
+	// Listen corrects the mode.
+	ln.Close()
+	if ln, err = s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := s.Dial(); err != nil {
+		t.Errorf("Dial after Listen: %v", err)
+	} else {
+		c.Close()
+	}
+
+	if err := os.Remove(addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(s.path, "pid"), addr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Dial(); !errors.Is(err, unsafeErr) {
+		t.Errorf("Dial with a symlink got %v, want %v", err, unsafeErr)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	s := &Session{Name: "work", path: filepath.Join(dir, "@work")}
+	if err := s.Verify(); err == nil {
+		t.Errorf("missing directory verified")
+	}
+
+	if err := os.Mkdir(s.path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(s.path, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode != 0700 {
+		t.Errorf("got mode %v, want 0700", mode)
+	}
+
+	file := &Session{Name: "file", path: filepath.Join(dir, "@file")}
+	if err := os.WriteFile(file.path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Verify(); err == nil {
+		t.Errorf("regular file verified")
+	}
+}
+
+func TestListenFallback(t *testing.T) {
+	defer func(f func(string, *net.TCPAddr) (*net.TCPListener, error)) { listenTCP = f }(listenTCP)
+	// failing returns a listenTCP that fails for network.
+	failing := func(network string) func(string, *net.TCPAddr) (*net.TCPListener, error) {
+		return func(n string, addr *net.TCPAddr) (*net.TCPListener, error) {
+			if n == network {
+				return nil, fmt.Errorf("listen %s: address family not supported", n)
+			}
+			return net.ListenTCP(n, addr)
+		}
+	}
+
+	for _, tt := range []struct {
+		fail    string
+		network string
+		host    string
+	}{
+		{"tcp4", "tcp6", "::1"},
+		{"tcp6", "tcp4", "127.0.0.1"},
+	} {
+		listenTCP = failing(tt.fail)
+		s := &Session{Name: "test", path: t.TempDir()}
+		ln, err := s.Listen()
+		if err != nil {
+			if tt.network == "tcp6" {
+				t.Logf("no IPv6 loopback: %v", err)
+				continue
+			}
+			t.Fatal(err)
+		}
+		network, addr := s.netAddr()
+		if network != tt.network {
+			t.Errorf("without %s got network %q, want %q", tt.fail, network, tt.network)
+		}
+		if host, _, err := net.SplitHostPort(addr); err != nil || host != tt.host {
+			t.Errorf("without %s got address %q, want host %s", tt.fail, addr, tt.host)
+		}
+		if s.Addr() != addr {
+			t.Errorf("Addr returned %q, want %q", s.Addr(), addr)
+		}
+		c, err := s.Dial()
+		if err != nil {
+			t.Errorf("without %s: %v", tt.fail, err)
+		} else {
+			c.Close()
+		}
+		ln.Close()
+	}
+}
+
+func TestListenLock(t *testing.T) {
+	dir := t.TempDir()
+	// Each Session stands in for a separate server process.
+	sessions := []*Session{
+		{Name: "test", path: dir},
+		{Name: "test", path: dir},
+	}
+	errs := make([]error, len(sessions))
+	var wg sync.WaitGroup
+	for i, s := range sessions {
+		wg.Add(1)
+		go func(i int, s *Session) {
+			defer wg.Done()
+			var ln net.Listener
+			if ln, errs[i] = s.Listen(); errs[i] == nil {
+				ln.Close()
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil && winner < 0:
+			winner = i
+		case err == nil:
+			t.Fatalf("both servers listened")
+		case !strings.Contains(err.Error(), "lock"):
+			t.Errorf("got error %v, want a lock error", err)
+		}
+	}
+	if winner < 0 {
+		t.Fatalf("neither server listened: %v", errs)
+	}
+
+	// Once the winner removes the session the lock is released.
+	sessions[winner].Remove()
+	loser := sessions[1-winner]
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := loser.Listen()
+	if err != nil {
+		t.Fatalf("after Remove: %v", err)
+	}
+	ln.Close()
+	loser.Remove()
+}
+
+func TestDialNetwork(t *testing.T) {
+	for _, tt := range []struct {
+		network string
+		host    string
+		prefix  bool // record the network in the addr file
+	}{
+		{"tcp6", "::1", true},
+		{"tcp4", "127.0.0.1", true},
+		{"tcp4", "127.0.0.1", false}, // written by an older server
+	} {
+		ln, err := net.Listen(tt.network, net.JoinHostPort(tt.host, "0"))
+		if err != nil {
+			t.Logf("%s: %v", tt.network, err)
+			continue
+		}
+		accepted := make(chan struct{})
+		go func() {
+			if c, err := ln.Accept(); err == nil {
+				c.Close()
+				close(accepted)
+			}
+		}()
+		s := &Session{Name: "test", path: t.TempDir()}
+		if tt.prefix {
+			err = s.SetAddr(tt.network, ln.Addr().String())
+		} else {
+			err = s.writefile("addr", ln.Addr().String())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := s.Dial()
+		if err != nil {
+			t.Errorf("%s: %v", tt.network, err)
+			ln.Close()
+			continue
+		}
+		select {
+		case <-accepted:
+		case <-time.After(5 * time.Second):
+			t.Errorf("%s: connection not accepted", tt.network)
+		}
+		c.Close()
+		ln.Close()
+	}
+}
@@ -16,20 +16,27 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/kr/pty"
 	"github.com/pborman/pty/log"
 	"github.com/pborman/pty/mutex"
+	"golang.org/x/time/rate"
 )
 
 var LoginShell string
@@ -69,29 +76,55 @@ const (
 	psMessage
 	pingMessage
 	ackMessage
-	dumpMessage // Cause the server to dump
+	dumpMessage         // Cause the server to dump
+	runMessage          // Command to inject into the shell
+	ratelimitMessage    // Set the output rate limit
+	statsMessage        // Request the shell's statistics
+	escstatsMessage     // Request the escape buffer's metrics
+	envMessage          // Request the shell's environment
+	notifyMessage       // Toggle bell notifications for the client
+	bellMessage         // The shell rang the bell
+	setenvMessage       // Set an environment variable in the shell
+	limitMessage        // Set the maximum number of attached clients
+	diffMessage         // Compare the screen with a saved screen
+	cancelMessage       // Cancel a pending exclusive detach
+	broadcastEnvMessage // NAME\0VALUE sent to every client
+	priorityMessage     // Set the client's priority
 )
 
 var messageNames = map[messageKind]string{
-	dataMessage:      "dataMessage",
-	ttysizeMessage:   "ttysizeMessage",
-	ttynameMessage:   "ttynameMessage",
-	serverMessage:    "serverMessage",
-	startMessage:     "startMessage",
-	waitMessage:      "waitMessage",
-	listMessage:      "listMessage",
-	countMessage:     "countMessage",
-	askCountMessage:  "askCountMessage",
-	exclusiveMessage: "exclusiveMessage",
-	saveMessage:      "saveMessage",
-	escapeMessage:    "escapeMessage",
-	preemptMessage:   "preemptMessage",
-	primaryMessage:   "primaryMessage",
-	forwardMessage:   "forwardMessage",
-	psMessage:        "psMessage",
-	pingMessage:      "pingMessage",
-	ackMessage:       "ackMessage",
-	dumpMessage:      "dumpMessage",
+	dataMessage:         "dataMessage",
+	ttysizeMessage:      "ttysizeMessage",
+	ttynameMessage:      "ttynameMessage",
+	serverMessage:       "serverMessage",
+	startMessage:        "startMessage",
+	waitMessage:         "waitMessage",
+	listMessage:         "listMessage",
+	countMessage:        "countMessage",
+	askCountMessage:     "askCountMessage",
+	exclusiveMessage:    "exclusiveMessage",
+	saveMessage:         "saveMessage",
+	escapeMessage:       "escapeMessage",
+	preemptMessage:      "preemptMessage",
+	primaryMessage:      "primaryMessage",
+	forwardMessage:      "forwardMessage",
+	psMessage:           "psMessage",
+	pingMessage:         "pingMessage",
+	ackMessage:          "ackMessage",
+	dumpMessage:         "dumpMessage",
+	runMessage:          "runMessage",
+	ratelimitMessage:    "ratelimitMessage",
+	statsMessage:        "statsMessage",
+	escstatsMessage:     "escstatsMessage",
+	envMessage:          "envMessage",
+	notifyMessage:       "notifyMessage",
+	bellMessage:         "bellMessage",
+	setenvMessage:       "setenvMessage",
+	limitMessage:        "limitMessage",
+	diffMessage:         "diffMessage",
+	cancelMessage:       "cancelMessage",
+	broadcastEnvMessage: "broadcastEnvMessage",
+	priorityMessage:     "priorityMessage",
 }
 
 func (m messageKind) String() string {
@@ -107,14 +140,17 @@ func (m messageKind) String() string {
 const (
 	scasb   = "\033[?1049h" // save cursor, switch to alternate screen buffer
 	nsbrc   = "\033[?1049l" // switch to normal screen buffer, restore cursor
-	edb0    = "\033[J"  // Erase below
-	edb1    = "\033[0J" // Erase below
-	eda     = "\033[1J" // Erase above
-	edall   = "\033[2J" // Erase all
-	edsaved = "\033[3J" // Erase Saved Lines
+	edb0    = "\033[J"      // Erase below
+	edb1    = "\033[0J"     // Erase below
+	eda     = "\033[1J"     // Erase above
+	edall   = "\033[2J"     // Erase all
+	edsaved = "\033[3J"     // Erase Saved Lines
 	cls     = nsbrc + edb0 + edsaved + edb0
 	home    = "\033[H"
 	sendSSH = "\033[z"
+	bel     = "\007"
+	bsu     = "\033[?2026h" // begin synchronized update
+	esu     = "\033[?2026l" // end synchronized update
 )
 
 // A ShellClient can be attached to a Shell.
@@ -140,56 +176,166 @@ type ShellClient interface {
 	Close()
 }
 
+// maxSyncOutput is the most output held for clients during a synchronized
+// update.
+const maxSyncOutput = 1024 * 1024
+
+// A BytesPerSecond is a data rate.
+type BytesPerSecond int
+
 // A Shell represents an actual running shell.  There may be zero or more
 // clients attached to the shell.  The Shell parameter is the name of the shell
 // to start when Start is called.  Args are the arguments to pass to the shell.
-// If not empty, Args must start with arg0.
+// If not empty, Args must start with arg0.  If OutputRateLimit is greater than
+// 0 then output from the shell is sent to the clients at no more than
+// OutputRateLimit bytes per second.  If WriteRateLimit is greater than 0 then
+// input from each client is written to the shell at no more than
+// WriteRateLimit bytes per second.  Up to WriteQueueSize bytes of pending
+// input are held for each client (1MB if 0).  If IdleTimeout is greater than 0
+// then the shell exits once no clients are attached and there has been no
+// input for IdleTimeout.
 type Shell struct {
-	Shell      string
-	Args       []string
-	Env        []string
-	cmd        *exec.Cmd
-	pty        *os.File
-	session    *Session
-	started    chan struct{}
-	done       chan struct{}
-	wg         sync.WaitGroup
-	mu         *mutex.Mutex
-	clients    map[*Client]struct{}
-	pids       map[int]*Client
-	eb         *EscapeBuffer
-	exiting    bool
-	rows, cols int
-}
-
-// NewShell returns a newly initialized, but not started, Shell.  By default,
-// Shell.Shell is set to LoginShell and Args is set to the basename of the
-// LoginShell with a "-" prepended (to indicate it is a login shell).
-func NewShell(session *Session) *Shell {
+	Shell           string
+	Args            []string
+	Env             []string
+	OutputRateLimit BytesPerSecond
+	WriteRateLimit  BytesPerSecond
+	WriteQueueSize  int
+	IdleTimeout     time.Duration
+	maxClients      int // 0 for no limit
+	scrollback      int // maximum bytes in each screen buffer
+	cmd             *exec.Cmd
+	pty             *os.File
+	session         *Session
+	started         chan struct{}
+	done            chan struct{}
+	wg              sync.WaitGroup
+	mu              *mutex.Mutex
+	clients         map[*Client]struct{}
+	pids            map[int]*Client
+	eb              *EscapeBuffer
+	exiting         bool
+	rows, cols      int
+	limiter         *rate.Limiter
+	syncOut         []byte        // output held during a synchronized update
+	exported        []string      // NAME=VALUE pairs set by Export
+	lastActive      time.Time     // when last_active was last written
+	auditLog        *auditLog     // nil if not auditing
+	titles          *titleTracker // nil if not tracking titles
+	titleTimer      *time.Timer   // flushes output held by titles
+
+	// statistics
+	startTime      time.Time
+	bytesFromShell uint64 // accessed atomically
+	bytesToClients uint64 // accessed atomically
+	peakClients    int
+}
+
+// ShellStats contains statistics about a Shell.
+type ShellStats struct {
+	StartTime      time.Time     // When the shell was started
+	Uptime         time.Duration // How long the shell has been running
+	BytesFromShell uint64        // Bytes read from the shell
+	BytesToClients uint64        // Bytes sent to all clients
+	PeakClients    int           // Most clients attached at one time
+	CurrentClients int           // Clients currently attached
+}
+
+// A ShellOption is an option passed to NewShell.
+type ShellOption func(*Shell)
+
+// WithScrollbackSize sets the maximum number of bytes kept in each of the
+// shell's screen buffers.  The default is 1MB.
+func WithScrollbackSize(n int) ShellOption {
+	return func(s *Shell) { s.scrollback = n }
+}
+
+// WithOutputRateLimit sets the shell's OutputRateLimit to bps bytes per
+// second.
+func WithOutputRateLimit(bps int) ShellOption {
+	return func(s *Shell) { s.OutputRateLimit = BytesPerSecond(bps) }
+}
+
+// WithIdleTimeout sets the shell's IdleTimeout to d.
+func WithIdleTimeout(d time.Duration) ShellOption {
+	return func(s *Shell) { s.IdleTimeout = d }
+}
+
+// WithShell sets the path of the shell to start.
+func WithShell(shell string) ShellOption {
+	return func(s *Shell) { s.Shell = shell }
+}
+
+// WithArgs sets the arguments, starting with arg0, passed to the shell.
+func WithArgs(args ...string) ShellOption {
+	return func(s *Shell) { s.Args = args }
+}
+
+// WithInitialSize sets the size of the shell's pty when it is started.  By
+// default the size of standard input is used, if it is a terminal.
+func WithInitialSize(rows, cols int) ShellOption {
+	return func(s *Shell) { s.rows, s.cols = rows, cols }
+}
+
+// NewShell returns a newly initialized, but not started, Shell configured by
+// opts.  By default, Shell.Shell is set to LoginShell and Args is set to the
+// basename of the Shell with a "-" prepended (to indicate it is a login
+// shell).
+func NewShell(session *Session, opts ...ShellOption) *Shell {
 	s := &Shell{
-		mu:      mutex.New("Shell " + session.Name),
-		started: make(chan struct{}),
-		done:    make(chan struct{}),
-		clients: map[*Client]struct{}{},
-		pids:    map[int]*Client{},
-		Shell:   LoginShell,
-		Args:    []string{"-" + path.Base(LoginShell)},
-		Env:     os.Environ(),
-		eb:      NewEscapeBuffer(0),
-		session: session,
-	}
-	s.eb.AddSequence(sendSSH, func(eb *EscapeBuffer) bool {
+		mu:        mutex.New("Shell " + session.Name),
+		started:   make(chan struct{}),
+		done:      make(chan struct{}),
+		clients:   map[*Client]struct{}{},
+		pids:      map[int]*Client{},
+		Shell:     LoginShell,
+		Env:       os.Environ(),
+		session:   session,
+		startTime: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.Args == nil {
+		s.Args = []string{"-" + path.Base(s.Shell)}
+	}
+	s.eb = NewEscapeBuffer(EscapeBufferOptions{MaxBytes: s.scrollback})
+	addSequence := func(seq string, f func(*EscapeBuffer) bool) {
+		if err := s.eb.AddSequence(seq, f); err != nil {
+			log.Errorf("adding sequence %q: %v", seq, err)
+		}
+	}
+	addSequence(sendSSH, func(eb *EscapeBuffer) bool {
+		return false
+	})
+	addSequence(bel, func(eb *EscapeBuffer) bool {
+		if !eb.inOSC() {
+			s.bell()
+		}
+		return true
+	})
+	addSequence(bsu, func(eb *EscapeBuffer) bool {
+		eb.beginSync()
+		return false
+	})
+	addSequence(esu, func(eb *EscapeBuffer) bool {
+		eb.endSync()
 		return false
 	})
-	s.eb.AddSequence(scasb, func(eb *EscapeBuffer) bool {
+	addSequence(scasb, func(eb *EscapeBuffer) bool {
+		eb.flushSync()
+		eb.hasCursor = false
 		eb.inalt = true
 		return false
 	})
-	s.eb.AddSequence(nsbrc, func(eb *EscapeBuffer) bool {
+	addSequence(nsbrc, func(eb *EscapeBuffer) bool {
+		eb.flushSync()
+		eb.hasCursor = false
 		eb.inalt = false
 		return false
 	})
-	s.eb.AddSequence(edsaved, func(eb *EscapeBuffer) bool {
+	addSequence(edsaved, func(eb *EscapeBuffer) bool {
+		eb.flushSync()
 		if !eb.inalt {
 			eb.normal = eb.normal[:0]
 			eb.normal = append(eb.normal, []byte(nsbrc)...)
@@ -197,7 +343,8 @@ func NewShell(session *Session) *Shell {
 		}
 		return false
 	})
-	s.eb.AddSequence(edall, func(eb *EscapeBuffer) bool {
+	addSequence(edall, func(eb *EscapeBuffer) bool {
+		eb.flushSync()
 		if eb.inalt {
 			eb.alt = eb.alt[:0]
 			eb.alt = append(eb.alt, []byte(home)...)
@@ -240,35 +387,279 @@ func (s *Shell) Setenv(key, value string) {
 	s.Env = append(s.Env, value)
 }
 
+// Environ returns the environment the shell was started with, updated by any
+// calls to Export.  If the shell has not been started then the environment it
+// will be started with is returned.
+func (s *Shell) Environ() []string {
+	unlock := s.mu.Lock("Environ")
+	cmd := s.cmd
+	env := append([]string{}, s.Env...)
+	exported := append([]string{}, s.exported...)
+	unlock()
+	if cmd == nil || cmd.Process == nil {
+		return env
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", cmd.Process.Pid))
+	if err != nil {
+		return env
+	}
+	env = env[:0]
+	for _, kv := range strings.Split(string(data), "\x00") {
+		if kv != "" {
+			env = append(env, kv)
+		}
+	}
+	for _, kv := range exported {
+		env = setenv(env, kv)
+	}
+	return env
+}
+
+// envName matches valid environment variable names.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Export sets the environment variable name to value in the running shell by
+// typing an export command at the shell's prompt.  This assumes the shell is
+// a Bourne style shell that is waiting at a prompt.  The variable is also
+// set in s.Env.
+func (s *Shell) Export(name, value string) error {
+	if !envName.MatchString(name) {
+		return fmt.Errorf("invalid variable name %q", name)
+	}
+	s.Setenv(name, value)
+	unlock := s.mu.Lock("Export")
+	s.exported = setenv(s.exported, name+"="+value)
+	unlock()
+	return s.RunCommand("export " + name + "=" + quoteShell(value))
+}
+
+// exportVars exports each variable in vars to the shell as Export does.  The
+// variables are exported in sorted order.  No variables are set if any name is
+// invalid.  If the shell has not been started then only its environment is
+// updated.
+func (s *Shell) exportVars(vars map[string]string) error {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		if !envName.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if s.pty == nil {
+			s.Setenv(name, vars[name])
+			continue
+		}
+		if err := s.Export(name, vars[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergeEnv merges vars into the shell's environment.  Variables that already
+// have their value in s.Env are left alone, the rest are exported as by
+// exportVars so the running shell, and any shell started later, sees them.
+// Invalid names and other errors are logged rather than returned.
+func (s *Shell) MergeEnv(vars map[string]string) {
+	changed := map[string]string{}
+	for name, value := range vars {
+		if v, ok := s.lookupEnv(name); ok && v == value {
+			continue
+		}
+		if !envName.MatchString(name) {
+			log.Warnf("merge env: invalid variable name %q", name)
+			continue
+		}
+		changed[name] = value
+	}
+	if err := s.exportVars(changed); err != nil {
+		log.Warnf("merge env: %v", err)
+	}
+}
+
+// GetEnv returns the value of key in s.Env, or "" if it is not set.  Changes
+// made by the shell itself are not seen.
+func (s *Shell) GetEnv(key string) string {
+	v, _ := s.lookupEnv(key)
+	return v
+}
+
+// lookupEnv returns the value of name in s.Env and whether it is set.
+func (s *Shell) lookupEnv(name string) (string, bool) {
+	prefix := name + "="
+	defer s.mu.Lock("lookupEnv")()
+	for _, v := range s.Env {
+		if strings.HasPrefix(v, prefix) {
+			return v[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// setenv returns env with the NAME=VALUE pair kv replacing any existing value
+// for NAME.
+func setenv(env []string, kv string) []string {
+	prefix := kv[:strings.IndexByte(kv, '=')+1]
+	for i, v := range env {
+		if strings.HasPrefix(v, prefix) {
+			env[i] = kv
+			return env
+		}
+	}
+	return append(env, kv)
+}
+
+// SetRateLimit limits output from the shell to limit bytes per second.  A
+// limit of 0 removes the limit.
+func (s *Shell) SetRateLimit(limit BytesPerSecond) {
+	defer s.mu.Lock("SetRateLimit")()
+	s.OutputRateLimit = limit
+	s.limiter = nil
+	if limit <= 0 {
+		return
+	}
+	s.limiter = rate.NewLimiter(rate.Limit(limit), int(limit))
+	// Start with an empty bucket so we never exceed limit.
+	s.limiter.AllowN(time.Now(), int(limit))
+}
+
+// SetMaxClients sets the maximum number of clients that may be attached to s
+// at one time.  A limit of 0 means no limit.  Clients already attached are
+// not detached.  The limit is recorded in the session so pty --list can
+// display it.
+func (s *Shell) SetMaxClients(n int) {
+	unlock := s.mu.Lock("SetMaxClients")
+	s.maxClients = n
+	unlock()
+	if s.session != nil {
+		if err := s.session.writefile("max_clients", strconv.Itoa(n)); err != nil {
+			log.Errorf("recording client limit: %v", err)
+		}
+	}
+}
+
+// MaxClients returns the maximum number of clients that may be attached to
+// s, or 0 if there is no limit.
+func (s *Shell) MaxClients() int {
+	defer s.mu.Lock("MaxClients")()
+	return s.maxClients
+}
+
+// throttle blocks until n more bytes may be sent to the clients.  Output is
+// not dropped, a program that writes faster than the limit will end up
+// blocking on its writes to the pty.
+func (s *Shell) throttle(n int) {
+	unlock := s.mu.Lock("throttle")
+	l := s.limiter
+	unlock()
+	if l == nil {
+		return
+	}
+	for n > 0 {
+		c := n
+		if c > l.Burst() {
+			c = l.Burst()
+		}
+		l.WaitN(context.Background(), c)
+		n -= c
+	}
+}
+
+// Attach attaches c to s and returns the number of other clients attached.
+// If s already has its maximum number of clients, c is sent a rejection
+// and -1 is returned.
 func (s *Shell) Attach(c *Client) int {
 	log.Infof("attach new client")
 	defer s.mu.Lock("Attach")()
+	if s.maxClients > 0 && len(s.clients) >= s.maxClients {
+		log.Warnf("rejecting client, %d clients attached (limit %d)", len(s.clients), s.maxClients)
+		c.Send(serverMessage, []byte(fmt.Sprintf("\r\nSession already has %d clients (limit %d)\r\n", len(s.clients), s.maxClients)))
+		return -1
+	}
 	c.Send(startMessage, nil)
-	buf := append([]byte(cls), s.eb.normal...)
-	if !c.Output(buf) {
+	// Start the replay on a clear screen and then put the cursor back
+	// where the shell's output left it.
+	// A Client queues its output to be written later while the escape
+	// buffers are reused in place, so the client must be given a copy.
+	var buf bytes.Buffer
+	s.eb.RestoreAfter(&buf, []byte(cls+home+edall))
+	if !c.Output(buf.Bytes()) {
 		log.Infof("new client write failure")
 		return len(s.clients)
 	}
-	if s.eb.inalt {
-		c.Output([]byte(scasb))
-		buf := append([]byte{}, s.eb.alt...)
-		if !c.Output(buf) {
-			log.Infof("new client write failure")
-			return len(s.clients)
-		}
-	}
 	// Don't take ownership here, wait
 	// until the first input from the client
 	// arrived.
 	s.wg.Add(1)
 	s.clients[c] = struct{}{}
+	if len(s.clients) > s.peakClients {
+		s.peakClients = len(s.clients)
+	}
 	return len(s.clients) - 1
 }
 
+// Stats returns the current statistics of s.
+func (s *Shell) Stats() ShellStats {
+	unlock := s.mu.Lock("Stats")
+	stats := ShellStats{
+		StartTime:      s.startTime,
+		PeakClients:    s.peakClients,
+		CurrentClients: len(s.clients),
+	}
+	unlock()
+	stats.Uptime = time.Since(stats.StartTime)
+	stats.BytesFromShell = atomic.LoadUint64(&s.bytesFromShell)
+	stats.BytesToClients = atomic.LoadUint64(&s.bytesToClients)
+	return stats
+}
+
+// SaveStats writes the statistics of s, as JSON, to the stats file in the
+// session directory.  The JSON is also returned.
+func (s *Shell) SaveStats() ([]byte, error) {
+	data, err := json.MarshalIndent(s.Stats(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return data, s.session.writefile("stats", string(data)+"\n")
+}
+
+// saveStats calls SaveStats once a minute until the shell exits.
+func (s *Shell) saveStats() {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if _, err := s.SaveStats(); err != nil {
+				log.Errorf("saving stats: %v", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// reapInterval is how often reapClients checks for inactive clients.
+var reapInterval = 30 * time.Second // so tests can change it
+
+// clientList returns the clients currently attached to s.
+func (s *Shell) clientList() []*Client {
+	defer s.mu.Lock("clientList")()
+	clients := make([]*Client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// CountClients returns the number of active clients attached to s.  As
+// IsActive may need to ping a client, CountClients does not hold the shell's
+// lock while checking clients.
 func (s *Shell) CountClients() int {
-	defer s.mu.Lock("CountClients")()
 	cnt := 0
-	for c := range s.clients {
+	for _, c := range s.clientList() {
 		if c.IsActive() {
 			cnt++
 		}
@@ -276,32 +667,95 @@ func (s *Shell) CountClients() int {
 	return cnt
 }
 
-func (s *Shell) Take(c *Client, requestSize bool) {
-	defer c.mu.Lock("Take1")()
-	if c.primary {
-		return
+// reapClients detaches inactive clients, as determined by IsActive, every
+// reapInterval until the shell exits.  The connection to a detached client is
+// closed.
+func (s *Shell) reapClients() {
+	tick := time.NewTicker(reapInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			for _, c := range s.clientList() {
+				if c.IsActive() {
+					continue
+				}
+				log.Warnf("detaching inactive client %s", c.Name())
+				s.Detach(c)
+				checkClose(c.out)
+			}
+		case <-s.done:
+			return
+		}
 	}
-	defer s.mu.Lock("Take2")()
-	log.Infof("client %s takes the session", c.Name())
+}
+
+// Take makes c the primary client of s.  It returns false if c could not take
+// the session because a client with a higher priority is the primary client.
+// As elsewhere, s.mu is locked before the client locks.
+func (s *Shell) Take(c *Client, requestSize bool) bool {
+	defer s.mu.Lock("Take1")()
+	cunlock := c.mu.Lock("Take2")
+	primary, priority := c.primary, c.priority
+	cunlock()
+	if primary {
+		return true
+	}
+	// A client cannot take the session from a higher priority client.
 	for oc := range s.clients {
 		if oc == c {
 			continue
 		}
 		unlock := oc.mu.Lock("Take3")
+		higher := oc.primary && oc.priority > priority
+		unlock()
+		if higher {
+			return false
+		}
+	}
+	log.Infof("client %s takes the session", c.Name())
+	for oc := range s.clients {
+		if oc == c {
+			continue
+		}
+		unlock := oc.mu.Lock("Take4")
 		if oc.primary {
 			oc.primary = false
 			oc.SendLocked(preemptMessage, nil)
 		}
 		unlock()
 	}
+	defer c.mu.Lock("Take5")()
 	c.primary = true
 	c.SendLocked(primaryMessage, nil) // The client should reforward things
+	return true
 }
 
+// Detach detaches c from s.  If c was the primary client then the remaining
+// client with the highest priority becomes the primary client.
 func (s *Shell) Detach(c *Client) {
 	log.Infof("detach client %s", c.Name())
-	defer s.mu.Lock("Detach")()
+	unlock := s.mu.Lock("Detach")
 	s.detach(c)
+	cunlock := c.mu.Lock("Detach")
+	wasPrimary := c.primary
+	c.primary = false
+	cunlock()
+	var next *Client
+	if wasPrimary {
+		priority := 0
+		for oc := range s.clients {
+			ounlock := oc.mu.Lock("Detach")
+			if next == nil || oc.priority > priority {
+				next, priority = oc, oc.priority
+			}
+			ounlock()
+		}
+	}
+	unlock()
+	if next != nil {
+		s.Take(next, true)
+	}
 }
 
 func (s *Shell) detach(c *Client) {
@@ -311,6 +765,19 @@ func (s *Shell) detach(c *Client) {
 	}
 }
 
+// RunCommand writes cmd, followed by a newline, to the shell as if it had been
+// typed at the prompt.  An error is returned if cmd contains a newline.
+func (s *Shell) RunCommand(cmd string) error {
+	if strings.ContainsAny(cmd, "\r\n") {
+		return errors.New("command contains a newline")
+	}
+	if s.pty == nil {
+		return errors.New("shell not started")
+	}
+	_, err := s.Write([]byte(cmd + "\n"))
+	return err
+}
+
 func (s *Shell) Write(buf []byte) (int, error) {
 	n, err := s.pty.Write(buf)
 	if err != nil {
@@ -319,6 +786,45 @@ func (s *Shell) Write(buf []byte) (int, error) {
 	return n, err
 }
 
+// bell sends a bellMessage to each client that has enabled notifications.
+// bell is called with s.mu held.
+func (s *Shell) bell() {
+	for c := range s.clients {
+		if c.Notify() {
+			c.Send(bellMessage, nil)
+		}
+	}
+}
+
+// audit records a message of kind with n bytes of data from client in the
+// audit log, if there is one.
+func (s *Shell) audit(client *Client, kind messageKind, n int) {
+	if s.auditLog == nil {
+		return
+	}
+	if err := s.auditLog.Record(client.Name(), kind, n); err != nil {
+		log.Errorf("audit: %v", err)
+	}
+}
+
+// lastActiveInterval is how often a session's last_active file is updated.
+const lastActiveInterval = time.Second
+
+// markActive records that a client has sent data to the shell.
+func (s *Shell) markActive() {
+	now := time.Now()
+	unlock := s.mu.Lock("markActive")
+	if now.Sub(s.lastActive) < lastActiveInterval {
+		unlock()
+		return
+	}
+	s.lastActive = now
+	unlock()
+	if err := s.session.SetLastActive(now); err != nil {
+		log.Warnf("setting last active: %v", err)
+	}
+}
+
 func (s *Shell) Wait() {
 	<-s.done
 	return
@@ -338,20 +844,26 @@ func (s *Shell) runout() {
 	r, err := s.pty.Read(buf[:])
 	close(s.started)
 	for {
+		if r > 0 {
+			s.throttle(r)
+		}
 		if func() bool {
 			unlock := s.mu.Lock("runout1")
 			defer func() { unlock() }()
 
+			var out []byte
 			if r > 0 {
-				s.eb.Write(buf[:r])
-				nbuf := append([]byte{}, buf[:r]...)
-				for c := range s.clients {
-					if !c.Output(nbuf) {
-						log.Infof("write to client %s failed", c.Name())
-						s.detach(c)
-					}
+				atomic.AddUint64(&s.bytesFromShell, uint64(r))
+				out = buf[:r]
+				if s.titles != nil {
+					out = s.titles.filter(out)
+					s.startTitleTimer()
 				}
 			}
+			if err != nil && s.titles != nil {
+				out = append(out, s.titles.flush()...)
+			}
+			s.output(out, err != nil)
 			if err != nil {
 				log.Infof("deleting all clients")
 				for c := range s.clients {
@@ -363,9 +875,9 @@ func (s *Shell) runout() {
 				}
 				unlock()
 				s.wg.Wait()
+				// The deferred function will unlock this lock.
 				unlock = s.mu.Lock("runout2")
 				close(s.done)
-				unlock()
 				return true
 			}
 			return false
@@ -379,6 +891,50 @@ func (s *Shell) runout() {
 	}
 }
 
+// output writes out, the filtered output of the shell, to the escape buffer
+// and sends it to the clients.  During a synchronized update the output is
+// held, unless flush is set, so clients receive the entire update in one
+// write.  s.mu must be held.
+func (s *Shell) output(out []byte, flush bool) {
+	if len(out) > 0 {
+		s.eb.Write(out)
+		s.syncOut = append(s.syncOut, out...)
+	}
+	if len(s.syncOut) == 0 || (!flush && len(s.syncOut) < maxSyncOutput && s.eb.InSync()) {
+		return
+	}
+	nbuf := s.syncOut
+	s.syncOut = nil
+	for c := range s.clients {
+		if !c.Output(nbuf) {
+			log.RateLimitedErrorf("write to client "+c.Name(), time.Second, "write to client %s failed", c.Name())
+			s.detach(c)
+			continue
+		}
+		atomic.AddUint64(&s.bytesToClients, uint64(len(nbuf)))
+	}
+}
+
+// startTitleTimer arranges for the output held by s.titles to be flushed if
+// the rest of a title sequence does not arrive within titleFlushDelay.  s.mu
+// must be held.
+func (s *Shell) startTitleTimer() {
+	if !s.titles.hasPending() {
+		return
+	}
+	if s.titleTimer == nil {
+		s.titleTimer = time.AfterFunc(titleFlushDelay, s.flushTitles)
+		return
+	}
+	s.titleTimer.Reset(titleFlushDelay)
+}
+
+// flushTitles writes any output held by s.titles.
+func (s *Shell) flushTitles() {
+	defer s.mu.Lock("flushTitles")()
+	s.output(s.titles.flush(), false)
+}
+
 func (s *Shell) Start(debug bool) error {
 	s.Setenv("_PTY_NAME", s.session.Name)
 	s.Setenv("_PTY_SHELL", "true")
@@ -407,6 +963,17 @@ func (s *Shell) Start(debug bool) error {
 	if err != nil {
 		return err
 	}
+	if s.rows <= 0 || s.cols <= 0 {
+		if rows, cols, err := pty.Getsize(os.Stdin); err == nil {
+			s.rows, s.cols = rows, cols
+		}
+	}
+	if s.rows > 0 && s.cols > 0 {
+		s.eb.SetSize(s.rows, s.cols)
+		if err := setsize(fd, s.rows, s.cols); err != nil {
+			log.Warnf("setting initial size to (%dx%d): %v", s.cols, s.rows, err)
+		}
+	}
 
 	defer func() {
 		checkClose(tty)
@@ -423,19 +990,73 @@ func (s *Shell) Start(debug bool) error {
 		checkClose(fd)
 		return err
 	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- s.cmd.Wait()
+	}()
+
+	// Give the shell a chance to change the tty settings.  A shell that
+	// exits this quickly could not be started.
+	select {
+	case err := <-exited:
+		checkClose(fd)
+		if err == nil {
+			err = errors.New("exited")
+		}
+		return fmt.Errorf("%s: %v", s.Shell, err)
+	case <-time.After(time.Second / 10):
+	}
 	s.pty = fd
+	if err := s.session.SetTTY(tty.Name()); err != nil {
+		log.Warnf("recording tty: %v", err)
+	}
+
+	s.SetRateLimit(s.OutputRateLimit)
+
+	unlock := s.mu.Lock("Start")
+	s.startTime = time.Now()
+	unlock()
 
-	// Give the shell a chance to change the tty settings
-	time.Sleep(time.Second / 10)
 	go s.runout()
+	go s.saveStats()
+	go s.reapClients()
+	if s.IdleTimeout > 0 {
+		go s.exitWhenIdle()
+	}
 	<-s.started
 	go func() {
-		err = s.cmd.Wait()
+		<-exited
 		s.Exit()
 	}()
 	return nil
 }
 
+// exitWhenIdle exits the shell once no clients are attached and there has
+// been no input for s.IdleTimeout.
+func (s *Shell) exitWhenIdle() {
+	tick := time.NewTicker(s.IdleTimeout / 4)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			unlock := s.mu.Lock("exitWhenIdle")
+			since := s.startTime
+			if s.lastActive.After(since) {
+				since = s.lastActive
+			}
+			idle := len(s.clients) == 0 && time.Since(since) >= s.IdleTimeout
+			unlock()
+			if idle {
+				log.Infof("exiting after being idle for %v", s.IdleTimeout)
+				s.Exit()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
 func (s *Shell) Exit() {
 	unlock := s.mu.Lock("Exit")
 	if s.exiting {
@@ -455,6 +1076,65 @@ func (s *Shell) Exit() {
 	s.session.Exit(0)
 }
 
+// Shutdown warns all clients that the shell is shutting down and waits up to
+// grace for them to detach.  Any clients remaining after grace are closed.
+func (s *Shell) Shutdown(grace time.Duration) {
+	msg := []byte(fmt.Sprintf("\r\nSession %s shutting down in %v\r\n", s.session.Name, grace))
+	s.Broadcast(msg)
+
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); time.Sleep(time.Second / 10) {
+		unlock := s.mu.Lock("Shutdown2")
+		n := len(s.clients)
+		unlock()
+		if n == 0 {
+			return
+		}
+	}
+
+	unlock := s.mu.Lock("Shutdown3")
+	var clients []*Client
+	for c := range s.clients {
+		clients = append(clients, c)
+		s.detach(c)
+	}
+	unlock()
+	for _, c := range clients {
+		log.Infof("closing client %s", c.Name())
+		c.Close()
+	}
+}
+
+// Broadcast sends msg as a serverMessage to every client attached to s.
+// Broadcast does not block on the clients as Send only queues the message.
+// The caller must not hold the lock of any client.
+func (s *Shell) Broadcast(msg []byte) {
+	s.broadcast(nil, serverMessage, msg)
+}
+
+// broadcast sends a message of kind with msg to every client attached to s
+// other than except, which may be nil.
+func (s *Shell) broadcast(except *Client, kind messageKind, msg []byte) {
+	defer s.mu.Lock("Broadcast")()
+	for c := range s.clients {
+		if c != except {
+			c.Send(kind, msg)
+		}
+	}
+}
+
+// DetachOthers detaches and closes every client attached to s other than
+// client, telling them they were detached by client.
+func (s *Shell) DetachOthers(client *Client) {
+	for _, oc := range s.clientList() {
+		if oc == client {
+			continue
+		}
+		s.Detach(oc)
+		oc.Output([]byte(fmt.Sprintf("\r\nDetached by client %s\r\n", client.Name())))
+		checkClose(oc)
+	}
+}
+
 func (s *Shell) List(me *Client) {
 	defer s.mu.Lock("List")()
 	lines := make([]string, 0, len(s.clients))
@@ -466,13 +1146,55 @@ func (s *Shell) List(me *Client) {
 		lines = append(lines, name)
 	}
 	sort.Strings(lines)
-	var buf bytes.Buffer
 	for _, line := range lines {
-		fmt.Fprintf(&buf, "%s\r\n", line)
+		me.Send(serverMessage, []byte(line+"\r\n"))
+	}
+	// An empty message marks the end of the list (see MultiCommand).
+	me.Send(serverMessage, nil)
+}
+
+// A SessionInfo describes a running session.  It is sent as JSON in reply to
+// a listMessage containing "-v".
+type SessionInfo struct {
+	Name      string
+	Created   time.Time     // when the session was created
+	Age       time.Duration // time since Created
+	LastInput time.Time     // when a client last wrote to the shell, zero if never
+	Idle      time.Duration // time since LastInput, or since the shell started
+	LastLine  string        // most recent non-empty line of output
+	Clients   []string      // names of the attached clients, sorted
+}
+
+// Info returns a description of s.
+func (s *Shell) Info() SessionInfo {
+	snap := s.eb.Snapshot()
+	unlock := s.mu.Lock("Info")
+	info := SessionInfo{
+		Name:      s.session.Name,
+		Created:   s.startTime,
+		LastInput: s.lastActive,
+	}
+	for c := range s.clients {
+		info.Clients = append(info.Clients, c.Name())
+	}
+	unlock()
+	sort.Strings(info.Clients)
+
+	if created := s.session.CreatedAt(); !created.IsZero() {
+		info.Created = created
+	}
+	now := time.Now()
+	info.Age = now.Sub(info.Created)
+	if info.LastInput.IsZero() {
+		info.Idle = now.Sub(s.startTime)
+	} else {
+		info.Idle = now.Sub(info.LastInput)
 	}
-	me.Send(serverMessage, buf.Bytes())
+	info.LastLine = lastLine(snap.Normal)
+	return info
 }
 
 func (s *Shell) Setsize(rows, cols int) error {
+	s.eb.SetSize(rows, cols)
 	return setsize(s.pty, rows, cols)
 }
@@ -0,0 +1,573 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kr/pty"
+)
+
+func TestRunCommand(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	s := NewShell(&Session{Name: "test"})
+	s.pty = w
+	if err := s.RunCommand("echo hello"); err != nil {
+		t.Fatal(err)
+	}
+	var buf [64]byte
+	n, err := r.Read(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), "echo hello\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if err := s.RunCommand("echo a\necho b"); err == nil {
+		t.Errorf("RunCommand with newline did not fail")
+	}
+}
+
+func TestExportVars(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	s := NewShell(&Session{Name: "test"})
+	if err := s.exportVars(map[string]string{"A": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.lookupEnv("A"); v != "1" {
+		t.Errorf("before start got A=%q, want 1", v)
+	}
+
+	s.pty = w
+	if err := s.exportVars(map[string]string{"B": "two words", "A": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "export A=\"x\"\nexport B=\"two words\"\n"
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if v, _ := s.lookupEnv("B"); v != "two words" {
+		t.Errorf("got B=%q, want two words", v)
+	}
+
+	for _, name := range []string{"A=B", "1A", "A B", ""} {
+		if err := s.exportVars(map[string]string{"C": "c", name: "x"}); err == nil {
+			t.Errorf("exportVars accepted %q", name)
+		}
+	}
+	if _, ok := s.lookupEnv("C"); ok {
+		t.Errorf("C was set by a failed exportVars")
+	}
+}
+
+func TestMergeEnv(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	s := NewShell(&Session{Name: "test"})
+	s.Env = []string{"KEEP=same"}
+	s.pty = w
+	s.MergeEnv(map[string]string{"FOO": "bar", "KEEP": "same", "BAD-NAME": "x"})
+	if got := s.GetEnv("FOO"); got != "bar" {
+		t.Errorf("GetEnv(FOO) = %q, want bar", got)
+	}
+	if got := s.GetEnv("BAD-NAME"); got != "" {
+		t.Errorf("GetEnv(BAD-NAME) = %q, want \"\"", got)
+	}
+	if got := s.GetEnv("MISSING"); got != "" {
+		t.Errorf("GetEnv(MISSING) = %q, want \"\"", got)
+	}
+
+	// Only FOO changed so it is the only variable exported.
+	w.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "export FOO=\"bar\"\n"; string(data) != want {
+		t.Errorf("shell got %q, want %q", data, want)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	const limit = 10000
+	data := bytes.Repeat([]byte("y\n"), limit/4)
+
+	s := NewShell(&Session{Name: "test"})
+	s.pty = r
+	s.SetRateLimit(limit)
+
+	var out bytes.Buffer
+	c := NewClient(&out)
+	s.Attach(c)
+
+	start := time.Now()
+	go s.runout()
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	<-s.done
+	c.Close()
+	if d, want := time.Since(start), time.Second*time.Duration(len(data))/limit; d < want {
+		t.Errorf("output took %v, want at least %v", d, want)
+	}
+	if !bytes.HasSuffix(out.Bytes(), data) {
+		t.Errorf("client did not receive all the output")
+	}
+}
+
+func TestStats(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	c1 := NewClient(ioutil.Discard)
+	c2 := NewClient(ioutil.Discard)
+	defer c1.Close()
+	defer c2.Close()
+
+	s.Attach(c1)
+	s.Attach(c2)
+	s.Detach(c1)
+	stats := s.Stats()
+	if stats.PeakClients != 2 {
+		t.Errorf("got %d peak clients, want 2", stats.PeakClients)
+	}
+	if stats.CurrentClients != 1 {
+		t.Errorf("got %d current clients, want 1", stats.CurrentClients)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	var clients []*Client
+	for p := 1; p <= 3; p++ {
+		c := NewClient(ioutil.Discard)
+		defer c.Close()
+		c.SetName(fmt.Sprintf("c%d", p))
+		c.SetPriority(p)
+		s.Attach(c)
+		clients = append(clients, c)
+	}
+	primary := func() string {
+		var names []string
+		for _, c := range clients {
+			unlock := c.mu.Lock("test")
+			if c.primary {
+				names = append(names, c.name)
+			}
+			unlock()
+		}
+		return strings.Join(names, ",")
+	}
+
+	if !s.Take(clients[2], true) {
+		t.Errorf("c3 could not take the session")
+	}
+	if s.Take(clients[0], true) || s.Take(clients[1], true) {
+		t.Errorf("a lower priority client took the session")
+	}
+	if got := primary(); got != "c3" {
+		t.Errorf("primary is %q, want c3", got)
+	}
+	s.Detach(clients[2])
+	if got := primary(); got != "c2" {
+		t.Errorf("after detaching c3 primary is %q, want c2", got)
+	}
+}
+
+func TestTakeLockOrder(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	a, b := NewClient(ioutil.Discard), NewClient(ioutil.Discard)
+	defer a.Close()
+	defer b.Close()
+	s.Attach(a)
+	s.Attach(b)
+	s.Take(b, true)
+
+	// Output is sent to clients while holding s.mu, so Take must not
+	// hold a client's lock while it waits for s.mu.
+	unlock := s.mu.Lock("test")
+	took := make(chan struct{})
+	go func() {
+		s.Take(a, true)
+		close(took)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		a.mu.Lock("test")()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("Take holds the client lock while waiting for the shell lock")
+	}
+	unlock()
+	<-took
+}
+
+func TestReapClients(t *testing.T) {
+	defer func(t, r time.Duration) {
+		clientActiveTimeout, reapInterval = t, r
+	}(clientActiveTimeout, reapInterval)
+	clientActiveTimeout = 50 * time.Millisecond
+	reapInterval = 20 * time.Millisecond
+
+	s := NewShell(&Session{Name: "test"})
+	defer close(s.done)
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	go s.attach(sc)
+
+	// The client reads from the server until stuck is closed.
+	stuck := make(chan struct{})
+	go func() {
+		var buf [1024]byte
+		for {
+			select {
+			case <-stuck:
+				return
+			default:
+			}
+			if _, err := cc.Read(buf[:]); err != nil {
+				return
+			}
+		}
+	}()
+	NewMessengerWriter(cc).Sendf(ttynameMessage, "%d:test", os.Getpid())
+	for start := time.Now(); len(s.clientList()) != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("client did not attach")
+		}
+	}
+	c := s.clientList()[0]
+
+	go s.reapClients()
+	time.Sleep(2 * reapInterval)
+	if !c.IsActive() {
+		t.Fatalf("client is not active")
+	}
+	time.Sleep(2 * clientActiveTimeout)
+	if !c.IsActive() {
+		t.Fatalf("client did not respond to ping")
+	}
+	if n := s.CountClients(); n != 1 {
+		t.Fatalf("got %d active clients, want 1", n)
+	}
+
+	close(stuck)
+	for start := time.Now(); len(s.clientList()) > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("stuck client was not detached")
+		}
+	}
+	if n := s.CountClients(); n != 0 {
+		t.Errorf("got %d active clients, want 0", n)
+	}
+}
+
+// A writeRecorder records each call to Write.
+type writeRecorder struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (w *writeRecorder) Write(buf []byte) (int, error) {
+	w.mu.Lock()
+	w.writes = append(w.writes, string(buf))
+	w.mu.Unlock()
+	return len(buf), nil
+}
+
+func TestSynchronizedUpdate(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	s := NewShell(&Session{Name: "test"})
+	s.pty = r
+
+	var out writeRecorder
+	c := NewClient(&out)
+	s.Attach(c)
+
+	frame := []string{bsu, home, "line 1", "\033[2;1H", "line 2", "\033[3;1H", "line 3", esu}
+	go s.runout()
+	for _, p := range frame {
+		if _, err := w.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if p == home && !s.eb.InSync() {
+			t.Errorf("not in a synchronized update")
+		}
+		if p != esu && s.eb.Len() != 0 {
+			t.Errorf("screen buffer updated during a synchronized update")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if s.eb.InSync() {
+		t.Errorf("synchronized update did not end")
+	}
+	w.Close()
+	<-s.done
+	c.Close()
+
+	// Attach clears the client's screen before any output.
+	want := []string{cls + home + edall, strings.Join(frame, "")}
+	if !reflect.DeepEqual(out.writes, want) {
+		t.Errorf("got writes %q, want %q", out.writes, want)
+	}
+	if got, want := string(s.eb.normal), strings.Join(frame[1:len(frame)-1], ""); got != want {
+		t.Errorf("screen buffer got %q, want %q", got, want)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	sc, cc := net.Pipe()
+	defer cc.Close()
+	c := NewClient(NewMessengerWriter(sc))
+	s.Attach(c)
+
+	msgs := make(chan string, 10)
+	r := NewMessengerReader(cc, func(kind messageKind, data []byte) {
+		if kind == serverMessage {
+			msgs <- string(data)
+		}
+	})
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, r)
+		close(closed)
+	}()
+
+	const grace = time.Second / 2
+	start := time.Now()
+	go s.Shutdown(grace)
+	select {
+	case msg := <-msgs:
+		if !strings.Contains(msg, "shutting down") {
+			t.Errorf("got message %q", msg)
+		}
+	case <-time.After(grace):
+		t.Errorf("did not get shutdown warning")
+	}
+	select {
+	case <-closed:
+		if d := time.Since(start); d < grace {
+			t.Errorf("client closed after %v, before the grace period", d)
+		}
+	case <-time.After(2 * grace):
+		t.Errorf("client not closed after the grace period")
+	}
+	if n := s.Stats().CurrentClients; n != 0 {
+		t.Errorf("got %d clients after shutdown, want 0", n)
+	}
+}
+
+func TestAttachReplay(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	s.eb.Write([]byte("prompt$ " + scasb + "\033[2;1Hstatus\033[5;1Hhello"))
+
+	var out writeRecorder
+	c := NewClient(&out)
+	s.Attach(c)
+	c.Close()
+	if len(out.writes) != 1 {
+		t.Fatalf("got writes %q", out.writes)
+	}
+	got := out.writes[0]
+	if !strings.HasPrefix(got, cls+home+edall) {
+		t.Errorf("replay does not start with a clear screen: %q", got)
+	}
+	// The cursor is put back after hello.
+	if want := "\033[5;1Hhello\033[5;6H"; !strings.HasSuffix(got, want) {
+		t.Errorf("replay %q does not end with %q", got, want)
+	}
+}
+
+func TestShellOptions(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	if s.Shell != LoginShell || len(s.Args) != 1 || s.Args[0] != "-"+path.Base(LoginShell) {
+		t.Errorf("default shell %q with args %q", s.Shell, s.Args)
+	}
+	if got := cap(s.eb.normal); got != 1024*1024 {
+		t.Errorf("default scrollback is %d", got)
+	}
+
+	s = NewShell(&Session{Name: "test"},
+		WithScrollbackSize(1024),
+		WithOutputRateLimit(300),
+		WithIdleTimeout(time.Hour),
+		WithShell("/bin/sh"),
+	)
+	if got := cap(s.eb.normal); got != 1024 {
+		t.Errorf("normal scrollback is %d, want 1024", got)
+	}
+	if got := cap(s.eb.alt); got != 1024 {
+		t.Errorf("alternate scrollback is %d, want 1024", got)
+	}
+	if s.OutputRateLimit != 300 {
+		t.Errorf("OutputRateLimit is %d, want 300", s.OutputRateLimit)
+	}
+	if s.IdleTimeout != time.Hour {
+		t.Errorf("IdleTimeout is %v, want 1h", s.IdleTimeout)
+	}
+	if s.Shell != "/bin/sh" || len(s.Args) != 1 || s.Args[0] != "-sh" {
+		t.Errorf("shell %q with args %q, want /bin/sh with [-sh]", s.Shell, s.Args)
+	}
+
+	s = NewShell(&Session{Name: "test"}, WithArgs("sh", "-i"), WithShell("/bin/sh"))
+	if !reflect.DeepEqual(s.Args, []string{"sh", "-i"}) {
+		t.Errorf("args %q, want [sh -i]", s.Args)
+	}
+}
+
+func TestStartExits(t *testing.T) {
+	const sh = "/bin/false"
+	if _, err := os.Stat(sh); err != nil {
+		t.Skipf("no %s", sh)
+	}
+	s := NewShell(&Session{Name: "test"}, WithShell(sh))
+	start := time.Now()
+	if err := s.Start(false); err == nil {
+		t.Fatalf("Start of %s did not fail", sh)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Start took %v to fail", d)
+	}
+}
+
+// startShell starts s and kills its shell when t ends.  osExit is replaced
+// until then so the shell exiting does not exit the test.
+func startShell(t *testing.T, s *Shell) {
+	t.Helper()
+	exited := make(chan int, 1)
+	saved := osExit
+	osExit = func(code int) { exited <- code }
+	t.Cleanup(func() { osExit = saved })
+	if err := s.Start(false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.cmd.Process.Kill()
+		select {
+		case <-exited:
+		case <-time.After(5 * time.Second):
+			t.Error("shell did not exit")
+		}
+	})
+}
+
+func TestInitialSize(t *testing.T) {
+	const sh = "/bin/sh"
+	if _, err := os.Stat(sh); err != nil {
+		t.Skipf("no %s", sh)
+	}
+	s := NewShell(&Session{Name: "test", path: t.TempDir()},
+		WithShell(sh),
+		WithArgs("sh"),
+		WithInitialSize(30, 100),
+	)
+	startShell(t, s)
+	if s.rows != 30 || s.cols != 100 {
+		t.Errorf("shell size is %dx%d, want 30x100", s.rows, s.cols)
+	}
+	rows, cols, err := pty.Getsize(s.pty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows != 30 || cols != 100 {
+		t.Errorf("pty size is %dx%d, want 30x100", rows, cols)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	s := NewShell(&Session{Name: "test"})
+	var outs []*bytes.Buffer
+	var clients []*Client
+	for i := 0; i < 3; i++ {
+		var out bytes.Buffer
+		c := NewClient(NewMessengerWriter(&out))
+		s.Attach(c)
+		outs = append(outs, &out)
+		clients = append(clients, c)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Broadcast([]byte("hello"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast deadlocked")
+	}
+
+	for i, c := range clients {
+		c.Close() // flushes the client's output
+		var got []string
+		r := NewMessengerReader(outs[i], func(kind messageKind, data []byte) {
+			if kind == serverMessage {
+				got = append(got, string(data))
+			}
+		})
+		io.Copy(ioutil.Discard, r)
+		if len(got) != 1 || got[0] != "hello" {
+			t.Errorf("client %d got server messages %q, want [hello]", i, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"time"
+)
+
+// maxTitleSequence is the longest OSC title sequence a titleTracker will
+// hold waiting for its terminator.  Longer sequences are passed through.
+const maxTitleSequence = 4096
+
+// titleFlushDelay is how long the output held by a titleTracker waits for the
+// rest of a title sequence before it is flushed.
+const titleFlushDelay = 100 * time.Millisecond
+
+// A titleTracker removes the OSC 0, 1, and 2 sequences, which set the window
+// title and icon name, from the output of a shell.  The title from each
+// sequence is passed to set.  Sequences are terminated by BEL or ST (ESC \).
+type titleTracker struct {
+	set     func(title string)
+	last    string // last title passed to set
+	pending []byte // a possibly incomplete title sequence
+}
+
+// newTitleTracker returns a titleTracker that calls set with each new title.
+func newTitleTracker(set func(title string)) *titleTracker {
+	return &titleTracker{set: set}
+}
+
+// isTitlePrefix reports if buf, which is shorter than a title sequence
+// introducer, could be the start of one.
+func isTitlePrefix(buf []byte) bool {
+	switch {
+	case len(buf) > 2 && (buf[2] < '0' || buf[2] > '2'):
+		return false
+	case len(buf) > 1 && buf[1] != ']':
+		return false
+	}
+	return len(buf) > 0 && buf[0] == '\033'
+}
+
+// filter returns buf with the title sequences removed.  The end of buf is
+// held until the next call to filter or flush if it might be the start of a
+// title sequence.  A sequence that is not terminated within maxTitleSequence
+// bytes is passed through and the bytes following its introducer are
+// filtered as usual.
+func (t *titleTracker) filter(buf []byte) []byte {
+	if len(t.pending) > 0 {
+		buf = append(t.pending, buf...)
+		t.pending = nil
+	}
+	var out []byte
+	for {
+		x := bytes.IndexByte(buf, '\033')
+		if x < 0 {
+			return append(out, buf...)
+		}
+		out = append(out, buf[:x]...)
+		buf = buf[x:]
+		if len(buf) < 4 {
+			if isTitlePrefix(buf) {
+				t.pending = append([]byte{}, buf...)
+				return out
+			}
+			return append(out, buf...)
+		}
+		if !isTitlePrefix(buf[:3]) || buf[3] != ';' {
+			out = append(out, buf[0])
+			buf = buf[1:]
+			continue
+		}
+		end, tlen := bytes.IndexByte(buf[4:], '\007'), 1
+		if st := bytes.Index(buf[4:], []byte("\033\\")); st >= 0 && (end < 0 || st < end) {
+			end, tlen = st, 2
+		}
+		if (end < 0 && len(buf) > maxTitleSequence) || 4+end+tlen > maxTitleSequence {
+			out = append(out, buf[0])
+			buf = buf[1:]
+			continue
+		}
+		if end < 0 {
+			t.pending = append([]byte{}, buf...)
+			return out
+		}
+		if title := string(buf[4 : 4+end]); title != t.last {
+			t.last = title
+			t.set(title)
+		}
+		buf = buf[4+end+tlen:]
+	}
+}
+
+// hasPending reports if t is holding output that might be the start of a title
+// sequence.
+func (t *titleTracker) hasPending() bool {
+	return len(t.pending) > 0
+}
+
+// flush returns the output held by t, if any, and forgets it.
+func (t *titleTracker) flush() []byte {
+	out := t.pending
+	t.pending = nil
+	return out
+}
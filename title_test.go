@@ -0,0 +1,175 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTitleTracker(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		in     []string // successive writes
+		out    string
+		titles []string
+	}{
+		{
+			name: "none",
+			in:   []string{"plain \033[1mtext\033[m"},
+			out:  "plain \033[1mtext\033[m",
+		},
+		{
+			name:   "bel",
+			in:     []string{"a\033]2;title\007b"},
+			out:    "ab",
+			titles: []string{"title"},
+		},
+		{
+			name:   "st",
+			in:     []string{"a\033]0;title\033\\b"},
+			out:    "ab",
+			titles: []string{"title"},
+		},
+		{
+			name:   "icon",
+			in:     []string{"\033]1;icon\007"},
+			titles: []string{"icon"},
+		},
+		{
+			name: "other osc",
+			in:   []string{"\033]7;file:///tmp\007"},
+			out:  "\033]7;file:///tmp\007",
+		},
+		{
+			name:   "split",
+			in:     []string{"a\033", "]", "2", ";ti", "tle\033", "\\b"},
+			out:    "ab",
+			titles: []string{"title"},
+		},
+		{
+			name: "split other",
+			in:   []string{"a\033", "[1m", "b\033]", "3;x\007"},
+			out:  "a\033[1mb\033]3;x\007",
+		},
+		{
+			name:   "repeated",
+			in:     []string{"\033]2;one\007\033]2;one\007\033]2;two\007"},
+			titles: []string{"one", "two"},
+		},
+		{
+			name: "too long",
+			in:   []string{"\033]2;" + strings.Repeat("x", maxTitleSequence)},
+			out:  "\033]2;" + strings.Repeat("x", maxTitleSequence),
+		},
+		{
+			name:   "too long then title",
+			in:     []string{"\033]2;" + strings.Repeat("x", maxTitleSequence), "\033]2;t\007"},
+			out:    "\033]2;" + strings.Repeat("x", maxTitleSequence),
+			titles: []string{"t"},
+		},
+		{
+			name:   "too long with title",
+			in:     []string{"\033]2;" + strings.Repeat("x", maxTitleSequence) + "\033]2;t\007"},
+			out:    "\033]2;" + strings.Repeat("x", maxTitleSequence),
+			titles: []string{"t"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var titles []string
+			tr := newTitleTracker(func(title string) {
+				titles = append(titles, title)
+			})
+			var out []byte
+			for _, in := range tt.in {
+				out = append(out, tr.filter([]byte(in))...)
+			}
+			if string(out) != tt.out {
+				t.Errorf("got output %q, want %q", out, tt.out)
+			}
+			if strings.Join(titles, "|") != strings.Join(tt.titles, "|") {
+				t.Errorf("got titles %q, want %q", titles, tt.titles)
+			}
+		})
+	}
+}
+
+func TestTitleTrackerFlush(t *testing.T) {
+	tr := newTitleTracker(func(string) {})
+	if out := tr.filter([]byte("a\033")); string(out) != "a" {
+		t.Errorf("got output %q, want \"a\"", out)
+	}
+	if !tr.hasPending() {
+		t.Fatal("trailing ESC is not held")
+	}
+	if out := tr.flush(); string(out) != "\033" {
+		t.Errorf("flush got %q, want ESC", out)
+	}
+	if tr.hasPending() {
+		t.Error("output still held after flush")
+	}
+	if out := tr.filter([]byte("]2;x\007")); string(out) != "]2;x\007" {
+		t.Errorf("after flush got %q", out)
+	}
+}
+
+func TestShellFlushTitles(t *testing.T) {
+	session := &Session{Name: "test", path: t.TempDir()}
+	s := newSessionShell(session)
+	var out writeRecorder
+	c := NewClient(&out)
+	s.Attach(c)
+	defer c.Close()
+
+	unlock := s.mu.Lock("test")
+	s.output(s.titles.filter([]byte("$ \033")), false)
+	s.startTitleTimer()
+	unlock()
+	deadline := time.Now().Add(10 * titleFlushDelay)
+	for {
+		out.mu.Lock()
+		got := strings.Join(out.writes, "")
+		out.mu.Unlock()
+		if strings.HasSuffix(got, "$ \033") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("held ESC was not flushed: %q", got)
+		}
+		time.Sleep(titleFlushDelay / 10)
+	}
+}
+
+func TestTitleTracking(t *testing.T) {
+	session := &Session{Name: "test", path: t.TempDir()}
+	s := newSessionShell(session)
+	if s.titles == nil {
+		t.Fatal("titles are not tracked")
+	}
+	if out := s.titles.filter([]byte("$ \033]2;vi main.go\007")); string(out) != "$ " {
+		t.Errorf("got output %q, want \"$ \"", out)
+	}
+	if title := session.Title(); title != "vi main.go" {
+		t.Errorf("got title %q, want \"vi main.go\"", title)
+	}
+
+	defer func(b *bool) { noTitleTrack = b }(noTitleTrack)
+	no := true
+	noTitleTrack = &no
+	if s := newSessionShell(session); s.titles != nil {
+		t.Errorf("titles are tracked with --no-title-track")
+	}
+}
@@ -17,6 +17,7 @@
 //
 //	name, err := ttyname.File(os.Stdin)
 //	name, err := ttyname.Fileno(0)
+//	name, err := ttyname.Name(0)
 package ttyname
 
 import (
@@ -26,6 +27,8 @@ import (
 	"os"
 	"path/filepath"
 	"syscall"
+
+	"golang.org/x/term"
 )
 
 // ttydirs is the list of possible directories the tty device is found in.
@@ -83,6 +86,38 @@ func File(tty *os.File) (string, error) {
 	if !ok {
 		return "", fmt.Errorf("unsupported sys stat type %T", sys)
 	}
+	return search(sys)
+}
+
+// Name returns the device name of the tty attached to the file descriptor fd.
+// The link /proc/self/fd/FD is tried first, and ttydirs are searched if the
+// link does not name the device.  If fd is not attached to a tty, ErrNotTTY
+// is returned.  Unlike Fileno, Name does not need to dup fd.
+func Name(fd uintptr) (string, error) {
+	if !IsATTY(fd) {
+		return "", ErrNotTTY
+	}
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(int(fd), &stat); err != nil {
+		return "", err
+	}
+	if path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd)); err == nil {
+		var pstat syscall.Stat_t
+		if syscall.Stat(path, &pstat) == nil && pstat.Rdev == stat.Rdev {
+			return path, nil
+		}
+	}
+	return search(&stat)
+}
+
+// IsATTY reports whether the file descriptor fd is attached to a tty.
+func IsATTY(fd uintptr) bool {
+	return term.IsTerminal(int(fd))
+}
+
+// search returns the path of the tty device in ttydirs with the same raw
+// device number as in stat.
+func search(sys *syscall.Stat_t) (string, error) {
 	for _, dir := range ttydirs {
 		name, _ := searchDir(dir, sys)
 		if name != "" {
@@ -0,0 +1,59 @@
+//   Copyright 2023 Paul Borman
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package ttyname
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kr/pty"
+)
+
+func TestName(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("cannot open a pty: %v", err)
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if !IsATTY(tty.Fd()) {
+		t.Errorf("IsATTY(pty) returned false")
+	}
+	if IsATTY(r.Fd()) {
+		t.Errorf("IsATTY(pipe) returned true")
+	}
+
+	name, err := Name(tty.Fd())
+	if err != nil {
+		t.Fatalf("Name(pty): %v", err)
+	}
+	if name == "" {
+		t.Errorf("Name(pty) returned an empty name")
+	}
+	if name != tty.Name() {
+		t.Errorf("Name(pty) returned %q, want %q", name, tty.Name())
+	}
+	if _, err := Name(r.Fd()); err != ErrNotTTY {
+		t.Errorf("Name(pipe) returned %v, want %v", err, ErrNotTTY)
+	}
+}
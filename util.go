@@ -48,6 +48,10 @@ func debugf(format string, v ...interface{}) {
 	}
 }
 
+// osExit is called by exit.  Tests that start a shell replace it so the
+// shell exiting does not end the test.
+var osExit = os.Exit
+
 // exit is the only path to os.Exit after the init functions have run
 // and the flags have been parsed.
 func exit(code int) {
@@ -63,7 +67,7 @@ func exit(code int) {
 		// This is all the goroutines
 		log.DumpGoroutines()
 	}
-	os.Exit(code)
+	osExit(code)
 }
 
 func exitf(format string, v ...interface{}) {